@@ -0,0 +1,133 @@
+package gossdb
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Value cached for a key the loader did not find
+const notFoundMarker = "\x00gossdb:not_found\x00"
+
+// Returned to the callers waiting for a load whose loader panicked
+var errLoaderPanic = fmt.Errorf("cache: loader panicked")
+
+// Loader reads the value of a key from the source of truth, it returns
+// ErrNotFound when the key does not exist
+type Loader func(key string) (string, error)
+
+// Cache is a read-through cache: a missing key is loaded once however many
+// goroutines ask for it at the same time and stored with Setx. The cache is
+// best effort, when SSDB fails the value is loaded and returned anyway.
+type Cache struct {
+	c      KV
+	loader Loader
+	ttl    time.Duration
+	// jitter is the fraction of ttl added at random so keys cached together
+	// do not expire together
+	jitter      float64
+	negativeTTL time.Duration
+	mutex       sync.Mutex
+	calls       map[string]*cacheCall
+	rand        *rand.Rand
+}
+
+// A load in flight, the callers asking for the same key wait for it
+type cacheCall struct {
+	wg  sync.WaitGroup
+	val string
+	err error
+}
+
+func NewCache(c KV, ttl time.Duration, loader Loader) *Cache {
+	return &Cache{
+		c:      c,
+		loader: loader,
+		ttl:    ttl,
+		jitter: 0.1,
+		calls:  make(map[string]*cacheCall),
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// SetJitter sets the fraction of the ttl added at random, 0.1 by default
+func (c *Cache) SetJitter(fraction float64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.jitter = fraction
+}
+
+// SetNegativeTTL caches the keys the loader did not find for d, 0 (the
+// default) disables it
+func (c *Cache) SetNegativeTTL(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.negativeTTL = d
+}
+
+// Get returns the cached value of key, loading it when it is missing. It
+// returns ErrNotFound when the loader did not find the key. A panic of the
+// loader reaches the caller running it, the callers waiting for it get an
+// error.
+func (c *Cache) Get(key string) (string, error) {
+	if val, err := c.c.Get(key); err == nil && val != nil {
+		if s, ok := val.(string); ok {
+			if s == notFoundMarker {
+				return "", ErrNotFound
+			}
+			return s, nil
+		}
+	}
+	return c.load(key)
+}
+
+// Del removes key from the cache so the next Get loads it
+func (c *Cache) Del(key string) (bool, error) {
+	return c.c.Del(key)
+}
+
+func (c *Cache) load(key string) (string, error) {
+	c.mutex.Lock()
+	if call, found := c.calls[key]; found {
+		c.mutex.Unlock()
+		call.wg.Wait()
+		return call.val, call.err
+	}
+	call := new(cacheCall)
+	call.wg.Add(1)
+	c.calls[key] = call
+	negativeTTL := c.negativeTTL
+	c.mutex.Unlock()
+	// release the waiters even when the loader panics
+	defer func() {
+		c.mutex.Lock()
+		delete(c.calls, key)
+		c.mutex.Unlock()
+		call.wg.Done()
+	}()
+
+	call.err = errLoaderPanic
+	call.val, call.err = c.loader(key)
+	switch {
+	case call.err == nil:
+		c.c.Setx(key, call.val, c.expiry(c.ttl))
+	case errors.Is(call.err, ErrNotFound) && negativeTTL > 0:
+		c.c.Setx(key, notFoundMarker, c.expiry(negativeTTL))
+	}
+	return call.val, call.err
+}
+
+// ttl in seconds with its jitter, at least a second
+func (c *Cache) expiry(ttl time.Duration) int32 {
+	c.mutex.Lock()
+	if c.jitter > 0 {
+		ttl += time.Duration(c.rand.Float64() * c.jitter * float64(ttl))
+	}
+	c.mutex.Unlock()
+	if ttl < time.Second {
+		return 1
+	}
+	return int32(ttl / time.Second)
+}
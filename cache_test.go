@@ -0,0 +1,180 @@
+package gossdb_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bububa/gossdb"
+)
+
+func TestCacheDedup(t *testing.T) {
+	_, c := newTestClient(t)
+	var loads int32
+	release := make(chan struct{})
+	cache := gossdb.NewCache(c, time.Minute, func(key string) (string, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return "v:" + key, nil
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := cache.Get("k"); v != "v:k" || err != nil {
+				t.Errorf("get = %q, %v", v, err)
+			}
+		}()
+	}
+	// let the callers queue behind the first load
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if v, err := cache.Get("k"); v != "v:k" || err != nil {
+		t.Fatalf("cached get = %q, %v", v, err)
+	}
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Fatalf("%d loads, want 1", n)
+	}
+	if v, _ := c.Get("k"); v != "v:k" {
+		t.Fatalf("stored %v", v)
+	}
+	if _, err := cache.Del("k"); err != nil {
+		t.Fatal(err)
+	}
+	cache.Get("k")
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Fatalf("%d loads after del, want 2", n)
+	}
+}
+
+func TestCacheJitter(t *testing.T) {
+	_, c := newTestClient(t)
+	cache := gossdb.NewCache(c, 100*time.Second, func(key string) (string, error) {
+		return "v", nil
+	})
+	cache.SetJitter(0.5)
+	spread := make(map[int64]bool)
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("k%d", i)
+		cache.Get(key)
+		ttl, err := c.TTL(key)
+		if err != nil || ttl < 100 || ttl > 150 {
+			t.Fatalf("ttl = %d, %v, want it in [100, 150]", ttl, err)
+		}
+		spread[ttl] = true
+	}
+	if len(spread) < 2 {
+		t.Fatalf("every ttl is %v, want them spread", spread)
+	}
+
+	cache.SetJitter(0)
+	cache.Get("exact")
+	if ttl, _ := c.TTL("exact"); ttl != 100 {
+		t.Fatalf("ttl without jitter = %d, want 100", ttl)
+	}
+}
+
+// The settings change while keys load, run with -race
+func TestCacheSettersRace(t *testing.T) {
+	_, c := newTestClient(t)
+	cache := gossdb.NewCache(c, time.Minute, func(key string) (string, error) {
+		return "", gossdb.ErrNotFound
+	})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			cache.SetJitter(float64(i) / 20)
+			cache.SetNegativeTTL(time.Duration(i) * time.Second)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		cache.Get(fmt.Sprintf("k%d", i))
+	}
+	wg.Wait()
+}
+
+func TestCacheNegative(t *testing.T) {
+	srv, c := newTestClient(t)
+	var loads int32
+	cache := gossdb.NewCache(c, time.Minute, func(key string) (string, error) {
+		atomic.AddInt32(&loads, 1)
+		return "", fmt.Errorf("%s: %w", key, gossdb.ErrNotFound)
+	})
+	// not cached by default
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Get("missing"); err == nil {
+			t.Fatal("get of a missing key succeeded")
+		}
+	}
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Fatalf("%d loads, want 2", n)
+	}
+
+	cache.SetNegativeTTL(10 * time.Second)
+	cache.Get("missing")
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Get("missing"); err != gossdb.ErrNotFound {
+			t.Fatalf("cached miss error = %v, want %v", err, gossdb.ErrNotFound)
+		}
+	}
+	if n := atomic.LoadInt32(&loads); n != 3 {
+		t.Fatalf("%d loads, want the miss cached", n)
+	}
+	srv.FastForward(11 * time.Second)
+	cache.Get("missing")
+	if n := atomic.LoadInt32(&loads); n != 4 {
+		t.Fatalf("%d loads after the negative ttl, want 4", n)
+	}
+}
+
+func TestCacheLoaderError(t *testing.T) {
+	_, c := newTestClient(t)
+	fail := true
+	cache := gossdb.NewCache(c, time.Minute, func(key string) (string, error) {
+		if fail {
+			return "", fmt.Errorf("source down")
+		}
+		return "v", nil
+	})
+	if _, err := cache.Get("k"); err == nil {
+		t.Fatal("loader error lost")
+	}
+	fail = false
+	if v, err := cache.Get("k"); v != "v" || err != nil {
+		t.Fatalf("get after the error = %q, %v", v, err)
+	}
+}
+
+func TestCacheLoaderPanic(t *testing.T) {
+	_, c := newTestClient(t)
+	release := make(chan struct{})
+	cache := gossdb.NewCache(c, time.Minute, func(key string) (string, error) {
+		<-release
+		panic("loader")
+	})
+	panicked := make(chan interface{})
+	go func() {
+		defer func() { panicked <- recover() }()
+		cache.Get("k")
+	}()
+	time.Sleep(20 * time.Millisecond)
+	waiter := make(chan error)
+	go func() {
+		_, err := cache.Get("k")
+		waiter <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	if p := <-panicked; p != "loader" {
+		t.Fatalf("recovered %v, want the loader panic", p)
+	}
+	if err := <-waiter; err == nil {
+		t.Fatal("waiter of a panicked load got no error")
+	}
+}
@@ -0,0 +1,205 @@
+package gossdb_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bububa/gossdb"
+	"github.com/bububa/gossdb/ssdbtest"
+)
+
+func TestClientKV(t *testing.T) {
+	srv, c := newTestClient(t)
+	if ok, err := c.Set("a", "1"); !ok || err != nil {
+		t.Fatalf("set = %v, %v", ok, err)
+	}
+	if v, err := c.Get("a"); v != "1" || err != nil {
+		t.Fatalf("get = %v, %v", v, err)
+	}
+	if v, err := c.Get("missing"); v != nil || err != nil {
+		t.Fatalf("get missing = %v, %v", v, err)
+	}
+	if v, err := c.Getset("a", "2"); v != "1" || err != nil {
+		t.Fatalf("getset = %v, %v", v, err)
+	}
+	if n, err := c.Incr("n", 5); n != 5 || err != nil {
+		t.Fatalf("incr = %d, %v", n, err)
+	}
+	if n, err := c.Decr("n", 2); n != 3 || err != nil {
+		t.Fatalf("decr = %d, %v", n, err)
+	}
+	if ok, err := c.Exists("a"); !ok || err != nil {
+		t.Fatalf("exists = %v, %v", ok, err)
+	}
+	if _, err := c.Del("a"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := c.Exists("a"); ok || err != nil {
+		t.Fatalf("exists after del = %v, %v", ok, err)
+	}
+
+	if _, err := c.Setx("tmp", "v", 10); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, err := c.TTL("tmp"); ttl <= 0 || ttl > 10 || err != nil {
+		t.Fatalf("ttl = %d, %v", ttl, err)
+	}
+	srv.FastForward(11 * time.Second)
+	if v, err := c.Get("tmp"); v != nil || err != nil {
+		t.Fatalf("get expired = %v, %v", v, err)
+	}
+}
+
+func TestClientMultiKV(t *testing.T) {
+	_, c := newTestClient(t)
+	if _, err := c.MultiSet(gossdb.NewKVPair("a", "1"), gossdb.NewKVPair("b", "2"), gossdb.NewKVPair("c", "3")); err != nil {
+		t.Fatal(err)
+	}
+	ordered, err := c.MultiGetOrdered("c", "missing", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*gossdb.KVResult{{Key: "c", Value: "3", Found: true}, {Key: "missing"}, {Key: "a", Value: "1", Found: true}}
+	if !reflect.DeepEqual(ordered, want) {
+		t.Fatalf("multi_get ordered = %v, want %v", ordered, want)
+	}
+	m, err := c.MultiGetMap("a", "b", "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, map[string]interface{}{"a": "1", "b": "2"}) {
+		t.Fatalf("multi_get map = %v", m)
+	}
+	kvs, err := c.Scan("a", "", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(kvs, [][2]string{{"b", "2"}, {"c", "3"}}) {
+		t.Fatalf("scan = %v", kvs)
+	}
+	if _, err := c.MultiDel("a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := c.MultiGetMap("a", "b", "c"); len(m) != 1 {
+		t.Fatalf("multi_get after multi_del = %v", m)
+	}
+}
+
+func TestClientHash(t *testing.T) {
+	_, c := newTestClient(t)
+	if _, err := c.MultiHSet("h", map[string]string{"a": "1", "b": "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.HSet("h", "c", "3"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.HGet("h", "b"); v != "2" || err != nil {
+		t.Fatalf("hget = %v, %v", v, err)
+	}
+	if n, err := c.HIncr("h", "a", 9); n != 10 || err != nil {
+		t.Fatalf("hincr = %d, %v", n, err)
+	}
+	if n, err := c.HSize("h"); n != 3 || err != nil {
+		t.Fatalf("hsize = %d, %v", n, err)
+	}
+	keys, err := c.HKeys("h", "", "", -1)
+	if err != nil || !reflect.DeepEqual(keys, []string{"a", "b", "c"}) {
+		t.Fatalf("hkeys = %v, %v", keys, err)
+	}
+	fvs, err := c.HRScan("h", "", "", 2)
+	if err != nil || !reflect.DeepEqual(fvs, [][2]string{{"c", "3"}, {"b", "2"}}) {
+		t.Fatalf("hrscan = %v, %v", fvs, err)
+	}
+	m, err := c.MultiHGet("h", []string{"a", "c", "missing"})
+	if err != nil || !reflect.DeepEqual(m, map[string]string{"a": "10", "c": "3"}) {
+		t.Fatalf("multi_hget = %v, %v", m, err)
+	}
+	names, err := c.HList("", "", -1)
+	if err != nil || !reflect.DeepEqual(names, []string{"h"}) {
+		t.Fatalf("hlist = %v, %v", names, err)
+	}
+	if _, err := c.HClear("h"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := c.HSize("h"); n != 0 || err != nil {
+		t.Fatalf("hsize after hclear = %d, %v", n, err)
+	}
+}
+
+func TestClientZSet(t *testing.T) {
+	_, c := newTestClient(t)
+	if _, err := c.MultiZSet("z", map[string]int{"a": 3, "b": 1, "c": 2}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := c.ZIncr("z", "b", 10); n != 11 || err != nil {
+		t.Fatalf("zincr = %d, %v", n, err)
+	}
+	if r, err := c.ZRank("z", "a"); r != 1 || err != nil {
+		t.Fatalf("zrank = %d, %v", r, err)
+	}
+	keys, err := c.ZKeys("z", "", 0, 100, -1)
+	if err != nil || !reflect.DeepEqual(keys, []string{"c", "a", "b"}) {
+		t.Fatalf("zkeys = %v, %v", keys, err)
+	}
+	scores, err := c.MultiZGet("z", []string{"a", "missing"})
+	if err != nil || !reflect.DeepEqual(scores, map[string]int64{"a": 3}) {
+		t.Fatalf("multi_zget = %v, %v", scores, err)
+	}
+	if n, err := c.ZSize("z"); n != 3 || err != nil {
+		t.Fatalf("zsize = %d, %v", n, err)
+	}
+	if _, err := c.ZDel("z", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := c.ZExists("z", "c"); ok || err != nil {
+		t.Fatalf("zexists after zdel = %v, %v", ok, err)
+	}
+}
+
+func TestClientQueue(t *testing.T) {
+	_, c := newTestClient(t)
+	for _, item := range []string{"b", "c"} {
+		if _, err := c.QPushBack("q", item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.QPushFront("q", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.QFront("q"); v != "a" || err != nil {
+		t.Fatalf("qfront = %v, %v", v, err)
+	}
+	if v, err := c.QBack("q"); v != "c" || err != nil {
+		t.Fatalf("qback = %v, %v", v, err)
+	}
+	items, err := c.QSlice("q", 0, -1)
+	if err != nil || !reflect.DeepEqual(items, []string{"a", "b", "c"}) {
+		t.Fatalf("qslice = %v, %v", items, err)
+	}
+	if v, err := c.QPopFront("q"); v != "a" || err != nil {
+		t.Fatalf("qpop_front = %v, %v", v, err)
+	}
+	if v, err := c.QPopBack("q"); v != "c" || err != nil {
+		t.Fatalf("qpop_back = %v, %v", v, err)
+	}
+	if n, err := c.QSize("q"); n != 1 || err != nil {
+		t.Fatalf("qsize = %d, %v", n, err)
+	}
+}
+
+func TestClientAuth(t *testing.T) {
+	srv := ssdbtest.NewServer()
+	defer srv.Close()
+	srv.SetPassword("secret")
+	c := gossdb.NewClient(nil, srv.Addr())
+	defer c.Close()
+	c.SetAuth("wrong")
+	if err := c.Reconnect(); err != gossdb.ErrAuthFailed {
+		t.Fatalf("reconnect error = %v, want %v", err, gossdb.ErrAuthFailed)
+	}
+	c.SetAuth("secret")
+	if _, err := c.Set("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,40 +1,219 @@
 package gossdb
 
 import (
+	"context"
 	"crypto/sha1"
-	"fmt"
 	"net"
-	"strconv"
-	"strings"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Cluster struct {
-	shards []*Client
+	*cluster
+	// ctx is given to the shard clients, see WithContext
+	ctx context.Context
+}
+
+// cluster is the state shared by a Cluster and its WithContext copies
+type cluster struct {
+	mutex sync.RWMutex
+	// update serializes the topology updates
+	update       sync.Mutex
+	ring         *ring
+	strict       bool
+	replicaReads bool
+	// setup is replayed on the clients created by UpdateTopology
+	setup  []func(*Client)
+	tracer Tracer
+	codec  Codec
+}
+
+// shard is a master with its optional read replicas
+type shard struct {
+	name     string
+	master   *Client
+	replicas []*Client
+	next     uint32
+}
+
+// ring is an immutable snapshot of the cluster topology
+type ring struct {
+	shards []*shard
+	// slots maps the hash space to shard ids, a shard owns weight slots
+	slots []int
 }
 
 func NewCluster(shardsAddr []string) (*Cluster, error) {
-	c := &Cluster{}
-	for _, addr := range shardsAddr {
-		h := strings.Split(addr, ":")
-		port, err := strconv.ParseInt(h[1], 10, 64)
-		if err != nil {
-			return nil, err
+	return NewClusterFromTopology(NewTopology(shardsAddr))
+}
+
+func NewClusterFromTopology(t *Topology) (*Cluster, error) {
+	c := &Cluster{cluster: &cluster{}}
+	if err := c.UpdateTopology(t); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// UpdateTopology switches the cluster to a new topology. Connections to
+// servers present in both topologies are kept, the others are closed once
+// the requests already sent to them are complete.
+func (c *Cluster) UpdateTopology(t *Topology) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	c.update.Lock()
+	defer c.update.Unlock()
+
+	// the new servers are dialled before the ring is locked, so the
+	// commands routed meanwhile are not held
+	c.mutex.RLock()
+	reuse := make(map[string]*Client)
+	if c.ring != nil {
+		for _, s := range c.ring.shards {
+			for _, cli := range s.clients() {
+				reuse[cli.addr.String()+"/"+cli.auth] = cli
+			}
 		}
-		tcpAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%d", h[0], port))
-		if err != nil {
-			return nil, err
+	}
+	setup := c.setup
+	c.mutex.RUnlock()
+
+	r := &ring{}
+	kept := make(map[*Client]bool)
+	var created []*Client
+	for i, cfg := range t.Shards {
+		s := &shard{name: cfg.Name}
+		if s.name == "" {
+			s.name = cfg.Master
 		}
-		s, err := Connect(tcpAddr)
-		if err != nil {
-			s = NewClient(nil, tcpAddr)
+		for j, addr := range append([]string{cfg.Master}, cfg.Replicas...) {
+			tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+			if err != nil {
+				for _, cli := range created {
+					cli.Close()
+				}
+				return err
+			}
+			cli, ok := reuse[tcpAddr.String()+"/"+cfg.Auth]
+			if !ok {
+				cli = NewClient(nil, tcpAddr)
+				cli.SetAuth(cfg.Auth)
+				for _, fn := range setup {
+					fn(cli)
+				}
+				cli.Reconnect()
+				created = append(created, cli)
+			}
+			kept[cli] = true
+			if j == 0 {
+				s.master = cli
+			} else {
+				s.replicas = append(s.replicas, cli)
+			}
+		}
+		weight := cfg.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		for j := 0; j < weight; j++ {
+			r.slots = append(r.slots, i)
+		}
+		r.shards = append(r.shards, s)
+	}
+
+	c.mutex.Lock()
+	// the settings applied while the new clients were dialled
+	for _, fn := range c.setup[len(setup):] {
+		for _, cli := range created {
+			fn(cli)
+		}
+	}
+	c.ring = r
+	c.mutex.Unlock()
+
+	for _, cli := range reuse {
+		if !kept[cli] {
+			// requests routed with the previous ring may still hold the
+			// client, it closes its connection after each of them
+			go cli.retire()
+		}
+	}
+	return nil
+}
+
+// SetReplicaReads sends read commands to the replicas of a shard when it has some
+func (c *Cluster) SetReplicaReads(enabled bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.replicaReads = enabled
+}
+
+func (c *Cluster) readsReplicas() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.replicaReads
+}
+
+// Apply fn to every client of the cluster, now and after topology updates
+func (c *Cluster) configure(fn func(*Client)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.setup = append(c.setup, fn)
+	for _, s := range c.ring.shards {
+		for _, cli := range s.clients() {
+			fn(cli)
 		}
-		c.shards = append(c.shards, s)
 	}
-	return c, nil
+}
+
+func (c *Cluster) SetLogger(l Logger) {
+	c.configure(func(cli *Client) { cli.SetLogger(l) })
+}
+
+func (c *Cluster) SetLogLevels(levels LogLevels) {
+	c.configure(func(cli *Client) { cli.SetLogLevels(levels) })
+}
+
+func (c *Cluster) SetTimeout(d time.Duration) {
+	c.configure(func(cli *Client) { cli.SetTimeout(d) })
+}
+
+func (c *Cluster) SetMaxReplySize(n int) {
+	c.configure(func(cli *Client) { cli.SetMaxReplySize(n) })
+}
+
+func (c *Cluster) SetSlowThreshold(d time.Duration) {
+	c.configure(func(cli *Client) { cli.SetSlowThreshold(d) })
+}
+
+// SetCodec sets the codec of the typed helpers such as GetAs, DefaultCodec
+// by default
+func (c *Cluster) SetCodec(codec Codec) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.codec = codec
+}
+
+func (c *Cluster) Codec() Codec {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.codec == nil {
+		return DefaultCodec
+	}
+	return c.codec
+}
+
+func (c *Cluster) topology() *ring {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.ring
 }
 
 // Locate the ID of shard containing a key
-func (c *Cluster) locate(k []byte) uint16 {
+func (r *ring) locate(k []byte) int {
 	h := sha1.New()
 	for len(k) > 0 {
 		n, err := h.Write(k)
@@ -44,179 +223,582 @@ func (c *Cluster) locate(k []byte) uint16 {
 		k = k[n:]
 	}
 	s := h.Sum(nil)
-	pos := ((uint16(s[0]) << 0) | (uint16(s[1]) << 8)) % uint16(len(c.shards))
-	return pos
+	pos := (int(s[0]) | int(s[1])<<8) % len(r.slots)
+	return r.slots[pos]
 }
 
 // Locate the IDs of shard containting the keys
-func (c *Cluster) locateKeys(ks ...string) map[int][]string {
+func (r *ring) locateKeys(ks ...string) map[int][]string {
 	res := make(map[int][]string)
 	for _, k := range ks {
-		loc := int(c.locate([]byte(k)))
+		loc := r.locate([]byte(k))
 		res[loc] = append(res[loc], k)
 	}
 	return res
 }
 
-func (c *Cluster) locatePairs(ps ...*KVPair) map[int][]*KVPair {
-	res := make(map[int][]*KVPair)
-	for _, p := range ps {
-		loc := int(c.locate([]byte(p.Key)))
-		res[loc] = append(res[loc], p)
+func (s *shard) clients() []*Client {
+	return append([]*Client{s.master}, s.replicas...)
+}
+
+// Pick the client serving reads, replicas are used in round-robin order
+func (s *shard) reader(replicaReads bool) *Client {
+	if !replicaReads || len(s.replicas) == 0 {
+		return s.master
+	}
+	n := atomic.AddUint32(&s.next, 1)
+	return s.replicas[n%uint32(len(s.replicas))]
+}
+
+// WithContext returns a cluster sharing the shards of c whose commands
+// carry ctx through the middleware chain, e.g. to link tracing spans
+func (c *Cluster) WithContext(ctx context.Context) *Cluster {
+	return &Cluster{cluster: c.cluster, ctx: ctx}
+}
+
+func (c *Cluster) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// Give the context of the cluster to a shard client
+func (c *Cluster) bind(cli *Client) *Client {
+	if c.ctx == nil {
+		return cli
+	}
+	return cli.WithContext(c.ctx)
+}
+
+// The client receiving writes for a key
+func (c *Cluster) master(key string) *Client {
+	return c.Route(key, false).Client
+}
+
+// The client serving reads for a key
+func (c *Cluster) reader(key string) *Client {
+	return c.Route(key, true).Client
+}
+
+// ShardClient is a shard of a cluster with the client to send commands to
+type ShardClient struct {
+	Name   string
+	Client *Client
+}
+
+// Route returns the shard owning key, with the same hashing as the typed
+// commands, so raw commands can be sent with Do. The client is a replica
+// when read is set and replica reads are enabled.
+func (c *Cluster) Route(key string, read bool) ShardClient {
+	r := c.topology()
+	s := r.shards[r.locate([]byte(key))]
+	if read {
+		return ShardClient{s.name, c.bind(s.reader(c.readsReplicas()))}
+	}
+	return ShardClient{s.name, c.bind(s.master)}
+}
+
+// ShardClients returns every shard with its master, or its reader when read
+// is set
+func (c *Cluster) ShardClients(read bool) []ShardClient {
+	var res []ShardClient
+	for _, s := range c.topology().shards {
+		if read {
+			res = append(res, ShardClient{s.name, c.bind(s.reader(c.readsReplicas()))})
+		} else {
+			res = append(res, ShardClient{s.name, c.bind(s.master)})
+		}
 	}
 	return res
 }
 
 func (c *Cluster) Set(key string, val string) (bool, error) {
-	return c.shards[c.locate([]byte(key))].Set(key, val)
+	return c.master(key).Set(key, val)
 }
 
 func (c *Cluster) Setx(key string, val string, ttl int32) (bool, error) {
-	return c.shards[c.locate([]byte(key))].Setx(key, val, ttl)
+	return c.master(key).Setx(key, val, ttl)
 }
 
 func (c *Cluster) Setnx(key string, val string) (bool, error) {
-	return c.shards[c.locate([]byte(key))].Setnx(key, val)
+	return c.master(key).Setnx(key, val)
 }
 
 func (c *Cluster) Get(key string) (interface{}, error) {
-	return c.shards[c.locate([]byte(key))].Get(key)
+	return c.reader(key).Get(key)
+}
+
+func (c *Cluster) Getset(key string, val string) (interface{}, error) {
+	return c.master(key).Getset(key, val)
 }
 
 func (c *Cluster) Del(key string) (bool, error) {
-	return c.shards[c.locate([]byte(key))].Del(key)
+	return c.master(key).Del(key)
 }
 
-func (c *Cluster) MultiGet(ks ...string) []*KVPair {
+// MultiGet fetches keys from their shards. When a shard fails the pairs of
+// the healthy shards are still returned together with a MultiError, unless
+// the cluster is strict in which case no pairs are returned.
+func (c *Cluster) MultiGet(ks ...string) ([]*KVPair, error) {
 	if len(ks) == 0 {
-		return nil
+		return nil, nil
 	}
-	parts := c.locateKeys(ks...)
-	ch := make(chan []*KVPair, len(parts))
-	for i, part := range parts {
-		go func(idx int, keys []string, shard *Client) {
-			ps, err := shard.MultiGet(keys...)
-			if err == nil && ps != nil {
-				ch <- ps
-			} else {
-				ch <- nil
-			}
-		}(i, part, c.shards[i])
+	res := c.MultiGetResult(ks...)
+	if err := res.Err(); err != nil {
+		if c.isStrict() {
+			return nil, err
+		}
+		return res.Pairs, err
 	}
+	return res.Pairs, nil
+}
 
-	var ps []*KVPair
-	for i := 0; i < len(parts); i++ {
-		pairs := <-ch
-		for _, v := range pairs {
-			if v == nil {
-				continue
-			}
-			ps = append(ps, v)
-		}
+// MultiGetResult fetches keys from their shards and reports per shard errors
+func (c *Cluster) MultiGetResult(ks ...string) *MultiResult {
+	return c.multi("multi_get", ks, true, func(shard *Client, keys []string) ([]*KVPair, error) {
+		return shard.MultiGet(keys...)
+	})
+}
+
+// MultiGetOrdered returns one result per requested key, in request order.
+// Keys of failed shards are reported as not found along with the error.
+func (c *Cluster) MultiGetOrdered(ks ...string) ([]*KVResult, error) {
+	pairs, err := c.MultiGet(ks...)
+	if err != nil && c.isStrict() {
+		return nil, err
 	}
-	return ps
+	return alignPairs(ks, pairs), err
 }
 
-func (c *Cluster) MultiSet(ps ...*KVPair) (ks []string, err error) {
+// MultiGetMap returns the values of the existing keys indexed by key
+func (c *Cluster) MultiGetMap(ks ...string) (map[string]interface{}, error) {
+	pairs, err := c.MultiGet(ks...)
+	if err != nil && c.isStrict() {
+		return nil, err
+	}
+	return pairsMap(pairs), err
+}
+
+func (c *Cluster) MultiSet(ps ...*KVPair) (bool, error) {
 	if len(ps) == 0 {
-		return nil, nil
+		return false, ErrNotEnoughParams
 	}
-	parts := c.locatePairs(ps...)
-	ch := make(chan int, len(parts))
-	for i, part := range parts {
-		go func(idx int, pairs []*KVPair, shard *Client) {
-			success, err2 := shard.MultiSet(pairs...)
-			if err2 == nil && success {
-				ch <- idx
-			} else {
-				if err2 != nil {
-					err = err2
-				}
-				ch <- -1
-			}
-		}(i, part, c.shards[i])
+	if err := c.MultiSetResult(ps...).Err(); err != nil {
+		return false, err
 	}
+	return true, nil
+}
 
-	for i := 0; i < len(parts); i++ {
-		if id := <-ch; id >= 0 {
-			for _, p := range parts[id] {
-				ks = append(ks, p.Key)
-			}
-		}
+// MultiSetResult writes pairs to their shards and reports per shard errors
+func (c *Cluster) MultiSetResult(ps ...*KVPair) *MultiResult {
+	pairs := make(map[string]*KVPair, len(ps))
+	ks := make([]string, 0, len(ps))
+	for _, p := range ps {
+		pairs[p.Key] = p
+		ks = append(ks, p.Key)
 	}
-	return ks, err
+	return c.multi("multi_set", ks, false, func(shard *Client, keys []string) ([]*KVPair, error) {
+		var part []*KVPair
+		for _, k := range keys {
+			part = append(part, pairs[k])
+		}
+		_, err := shard.MultiSet(part...)
+		return nil, err
+	})
 }
 
-func (c *Cluster) MultiDel(ks ...string) (res []string, err error) {
+func (c *Cluster) MultiDel(ks ...string) (bool, error) {
 	if len(ks) == 0 {
-		return nil, nil
+		return false, ErrNotEnoughParams
+	}
+	if err := c.MultiDelResult(ks...).Err(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// MultiDelResult deletes keys from their shards and reports per shard errors
+func (c *Cluster) MultiDelResult(ks ...string) *MultiResult {
+	return c.multi("multi_del", ks, false, func(shard *Client, keys []string) ([]*KVPair, error) {
+		_, err := shard.MultiDel(keys...)
+		return nil, err
+	})
+}
+
+// SetStrict makes MultiGet fail as a whole when any shard fails instead of
+// returning the pairs of the healthy shards
+func (c *Cluster) SetStrict(strict bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.strict = strict
+}
+
+func (c *Cluster) isStrict() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.strict
+}
+
+type shardReply struct {
+	idx   int
+	pairs []*KVPair
+	err   error
+}
+
+// Run fn on the shards owning the keys and collect the replies
+func (c *Cluster) multi(name string, ks []string, read bool, fn func(shard *Client, keys []string) ([]*KVPair, error)) *MultiResult {
+	r := c.topology()
+	parts := r.locateKeys(ks...)
+	ctx := c.context()
+	c.mutex.RLock()
+	tracer := c.tracer
+	c.mutex.RUnlock()
+	var span Span
+	if tracer != nil {
+		ctx, span = tracer.Start(ctx, "ssdb.cluster."+name)
+		span.SetAttributes(
+			Attribute{Key: "db.system", Value: "ssdb"},
+			Attribute{Key: "db.operation", Value: name},
+			Attribute{Key: "ssdb.keys", Value: len(ks)},
+			Attribute{Key: "ssdb.shards", Value: len(parts)},
+		)
+		defer span.End()
 	}
-	parts := c.locateKeys(ks...)
-	ch := make(chan int, len(parts))
+	ch := make(chan shardReply, len(parts))
 	for i, part := range parts {
+		cli := r.shards[i].master
+		if read {
+			cli = r.shards[i].reader(c.readsReplicas())
+		}
+		cli = cli.WithContext(ctx)
 		go func(idx int, keys []string, shard *Client) {
-			success, err2 := shard.MultiDel(keys...)
-			if err2 == nil && success {
-				ch <- idx
-			} else {
-				if err2 != nil {
-					err = err2
-				}
-				ch <- -1
-			}
-		}(i, part, c.shards[i])
+			ps, err := fn(shard, keys)
+			ch <- shardReply{idx: idx, pairs: ps, err: err}
+		}(i, part, cli)
 	}
 
+	res := &MultiResult{}
 	for i := 0; i < len(parts); i++ {
-		if id := <-ch; id >= 0 {
-			res = append(res, parts[id]...)
+		reply := <-ch
+		if reply.err != nil {
+			res.Errors = append(res.Errors, &ShardError{
+				Shard: reply.idx,
+				Addr:  r.shards[reply.idx].master.addr.String(),
+				Keys:  parts[reply.idx],
+				Err:   reply.err,
+			})
+			continue
+		}
+		res.Keys = append(res.Keys, parts[reply.idx]...)
+		for _, p := range reply.pairs {
+			if p != nil {
+				res.Pairs = append(res.Pairs, p)
+			}
 		}
 	}
-	return res, err
+	if span != nil && len(res.Errors) > 0 {
+		span.RecordError(res.Err())
+	}
+	return res
 }
 
 func (c *Cluster) Exists(key string) (bool, error) {
-	return c.shards[c.locate([]byte(key))].Exists(key)
+	return c.reader(key).Exists(key)
 }
 
 func (c *Cluster) Expire(key string, ttl int) (int, error) {
-	return c.shards[c.locate([]byte(key))].Expire(key, ttl)
+	return c.master(key).Expire(key, ttl)
+}
+
+func (c *Cluster) TTL(key string) (int64, error) {
+	return c.reader(key).TTL(key)
 }
 
 func (c *Cluster) Incr(key string, num int) (int64, error) {
-	return c.shards[c.locate([]byte(key))].Incr(key, num)
+	return c.master(key).Incr(key, num)
 }
 
 func (c *Cluster) Decr(key string, num int) (int64, error) {
-	return c.shards[c.locate([]byte(key))].Decr(key, num)
+	return c.master(key).Decr(key, num)
+}
+
+// Scan the key range on every shard and merge the results in key order
+func (c *Cluster) Scan(startKey string, endKey string, limit int) ([][2]string, error) {
+	var (
+		mutex  sync.Mutex
+		kvList [][2]string
+	)
+	err := c.each(func(shard *Client) error {
+		res, err := shard.Scan(startKey, endKey, limit)
+		if err != nil {
+			return err
+		}
+		mutex.Lock()
+		kvList = append(kvList, res...)
+		mutex.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(kvList, func(i, j int) bool { return kvList[i][0] < kvList[j][0] })
+	if limit >= 0 && len(kvList) > limit {
+		kvList = kvList[:limit]
+	}
+	return kvList, nil
 }
 
 func (c *Cluster) HSet(name string, key string, val string) (bool, error) {
-	return c.shards[c.locate([]byte(name))].HSet(name, key, val)
+	return c.master(name).HSet(name, key, val)
 }
 
 func (c *Cluster) HGet(name string, key string) (interface{}, error) {
-	return c.shards[c.locate([]byte(name))].HGet(name, key)
+	return c.reader(name).HGet(name, key)
 }
 
 func (c *Cluster) HDel(name string, key string) (bool, error) {
-	return c.shards[c.locate([]byte(name))].HDel(name, key)
+	return c.master(name).HDel(name, key)
 }
 
 func (c *Cluster) HIncr(name string, key string, num int) (int64, error) {
-	return c.shards[c.locate([]byte(name))].HIncr(name, key, num)
+	return c.master(name).HIncr(name, key, num)
 }
 
 func (c *Cluster) HExists(name string, key string) (bool, error) {
-	return c.shards[c.locate([]byte(name))].HExists(name, key)
+	return c.reader(name).HExists(name, key)
 }
 
-func (c *Cluster) Close() error {
-	for _, conn := range c.shards {
-		err := conn.Close()
+func (c *Cluster) HDecr(name string, key string, num int) (int64, error) {
+	return c.master(name).HDecr(name, key, num)
+}
+
+func (c *Cluster) HSize(name string) (int64, error) {
+	return c.reader(name).HSize(name)
+}
+
+// List the hash names of every shard and merge them in order
+func (c *Cluster) HList(startKey, endKey string, limit int) ([]string, error) {
+	return c.list(func(shard *Client) ([]string, error) {
+		return shard.HList(startKey, endKey, limit)
+	}, limit)
+}
+
+func (c *Cluster) HKeys(name, startField, endField string, limit int) ([]string, error) {
+	return c.reader(name).HKeys(name, startField, endField, limit)
+}
+
+func (c *Cluster) HScan(name, startField, endField string, limit int) ([][2]string, error) {
+	return c.reader(name).HScan(name, startField, endField, limit)
+}
+
+func (c *Cluster) HRScan(name, startField, endField string, limit int) ([][2]string, error) {
+	return c.reader(name).HRScan(name, startField, endField, limit)
+}
+
+func (c *Cluster) HClear(name string) (bool, error) {
+	return c.master(name).HClear(name)
+}
+
+func (c *Cluster) MultiHSet(name string, fvMap map[string]string) (bool, error) {
+	return c.master(name).MultiHSet(name, fvMap)
+}
+
+func (c *Cluster) MultiHGet(name string, fieldList []string) (map[string]string, error) {
+	return c.reader(name).MultiHGet(name, fieldList)
+}
+
+func (c *Cluster) MultiHDel(name string, fieldList []string) (bool, error) {
+	return c.master(name).MultiHDel(name, fieldList)
+}
+
+func (c *Cluster) ZSet(name, ele string, score int) (bool, error) {
+	return c.master(name).ZSet(name, ele, score)
+}
+
+func (c *Cluster) ZGet(name, ele string) (interface{}, error) {
+	return c.reader(name).ZGet(name, ele)
+}
+
+func (c *Cluster) ZDel(name, ele string) (bool, error) {
+	return c.master(name).ZDel(name, ele)
+}
+
+func (c *Cluster) ZIncr(name, ele string, num int) (int64, error) {
+	return c.master(name).ZIncr(name, ele, num)
+}
+
+func (c *Cluster) ZSize(name string) (int64, error) {
+	return c.reader(name).ZSize(name)
+}
+
+func (c *Cluster) ZExists(name, ele string) (bool, error) {
+	return c.reader(name).ZExists(name, ele)
+}
+
+// List the zset names of every shard and merge them in order
+func (c *Cluster) ZList(startKey, endKey string, limit int) ([]string, error) {
+	return c.list(func(shard *Client) ([]string, error) {
+		return shard.ZList(startKey, endKey, limit)
+	}, limit)
+}
+
+func (c *Cluster) ZKeys(name, startEle string, scoreStart, scoreEnd, limit int) ([]string, error) {
+	return c.reader(name).ZKeys(name, startEle, scoreStart, scoreEnd, limit)
+}
+
+func (c *Cluster) ZScan(name, startEle string, scoreStart, scoreEnd, limit int) (map[string]int64, error) {
+	return c.reader(name).ZScan(name, startEle, scoreStart, scoreEnd, limit)
+}
+
+func (c *Cluster) ZRScan(name, startEle string, scoreStart, scoreEnd, limit int) (map[string]int64, error) {
+	return c.reader(name).ZRScan(name, startEle, scoreStart, scoreEnd, limit)
+}
+
+func (c *Cluster) ZRank(name, ele string) (int64, error) {
+	return c.reader(name).ZRank(name, ele)
+}
+
+func (c *Cluster) ZRRank(name, ele string) (int64, error) {
+	return c.reader(name).ZRRank(name, ele)
+}
+
+func (c *Cluster) ZRange(name string, offset, limit int) ([][2]interface{}, error) {
+	return c.reader(name).ZRange(name, offset, limit)
+}
+
+func (c *Cluster) ZRRange(name string, offset, limit int) ([][2]interface{}, error) {
+	return c.reader(name).ZRRange(name, offset, limit)
+}
+
+func (c *Cluster) ZClear(name string) (bool, error) {
+	return c.master(name).ZClear(name)
+}
+
+func (c *Cluster) MultiZSet(name string, esMap map[string]int) (bool, error) {
+	return c.master(name).MultiZSet(name, esMap)
+}
+
+func (c *Cluster) MultiZGet(name string, eleList []string) (map[string]int64, error) {
+	return c.reader(name).MultiZGet(name, eleList)
+}
+
+func (c *Cluster) MultiZDel(name string, eleList []string) (bool, error) {
+	return c.master(name).MultiZDel(name, eleList)
+}
+
+func (c *Cluster) QSize(name string) (int64, error) {
+	return c.reader(name).QSize(name)
+}
+
+// QSzie is kept for compatibility, use QSize instead.
+func (c *Cluster) QSzie(name string) (int64, error) {
+	return c.QSize(name)
+}
+
+func (c *Cluster) QClear(name string) (bool, error) {
+	return c.master(name).QClear(name)
+}
+
+func (c *Cluster) QFront(name string) (string, error) {
+	return c.reader(name).QFront(name)
+}
+
+func (c *Cluster) QBack(name string) (string, error) {
+	return c.reader(name).QBack(name)
+}
+
+func (c *Cluster) QGet(name string, index int) (interface{}, error) {
+	return c.reader(name).QGet(name, index)
+}
+
+func (c *Cluster) QSlice(name string, begin, end int) ([]string, error) {
+	return c.reader(name).QSlice(name, begin, end)
+}
+
+// List the queue names of every shard and merge them in order
+func (c *Cluster) QList(startKey, endKey string, limit int) ([]string, error) {
+	return c.list(func(shard *Client) ([]string, error) {
+		return shard.QList(startKey, endKey, limit)
+	}, limit)
+}
+
+func (c *Cluster) QPush(name, item string) (bool, error) {
+	return c.master(name).QPush(name, item)
+}
+
+func (c *Cluster) QPushFront(name, item string) (bool, error) {
+	return c.master(name).QPushFront(name, item)
+}
+
+func (c *Cluster) QPushBack(name, item string) (bool, error) {
+	return c.master(name).QPushBack(name, item)
+}
+
+func (c *Cluster) QPop(name string) (interface{}, error) {
+	return c.master(name).QPop(name)
+}
+
+func (c *Cluster) QPopFront(name string) (interface{}, error) {
+	return c.master(name).QPopFront(name)
+}
+
+func (c *Cluster) QPopBack(name string) (interface{}, error) {
+	return c.master(name).QPopBack(name)
+}
+
+// Run fn on the reader of every shard concurrently, returning the first error
+func (c *Cluster) each(fn func(shard *Client) error) error {
+	r := c.topology()
+	ch := make(chan error, len(r.shards))
+	for _, s := range r.shards {
+		go func(shard *Client) {
+			ch <- fn(shard)
+		}(c.bind(s.reader(c.readsReplicas())))
+	}
+	var err error
+	for i := 0; i < len(r.shards); i++ {
+		if err2 := <-ch; err2 != nil && err == nil {
+			err = err2
+		}
+	}
+	return err
+}
+
+// Merge the sorted name lists returned by every shard
+func (c *Cluster) list(fn func(shard *Client) ([]string, error), limit int) ([]string, error) {
+	var (
+		mutex sync.Mutex
+		names []string
+	)
+	err := c.each(func(shard *Client) error {
+		res, err := fn(shard)
 		if err != nil {
 			return err
 		}
+		mutex.Lock()
+		names = append(names, res...)
+		mutex.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	if limit >= 0 && len(names) > limit {
+		names = names[:limit]
+	}
+	return names, nil
+}
+
+func (c *Cluster) Close() error {
+	for _, s := range c.topology().shards {
+		for _, conn := range s.clients() {
+			err := conn.Close()
+			if err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -0,0 +1,201 @@
+package gossdb_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/bububa/gossdb"
+	"github.com/bububa/gossdb/ssdbtest"
+)
+
+// Start n shards and a cluster over them
+func newTestCluster(t *testing.T, n int) ([]*ssdbtest.Server, *gossdb.Cluster) {
+	t.Helper()
+	var (
+		servers []*ssdbtest.Server
+		addrs   []string
+	)
+	for i := 0; i < n; i++ {
+		srv := ssdbtest.NewServer()
+		t.Cleanup(func() { srv.Close() })
+		servers = append(servers, srv)
+		addrs = append(addrs, srv.String())
+	}
+	c, err := gossdb.NewCluster(addrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return servers, c
+}
+
+// The keys owned by the shard of srv
+func onShard(c *gossdb.Cluster, srv *ssdbtest.Server, keys ...string) []string {
+	var res []string
+	for _, key := range keys {
+		if c.Route(key, false).Client.Addr() == srv.String() {
+			res = append(res, key)
+		}
+	}
+	return res
+}
+
+// Connect to a shard directly
+func shardClient(t *testing.T, srv *ssdbtest.Server) *gossdb.Client {
+	t.Helper()
+	c, err := gossdb.Connect(srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestClusterRouting(t *testing.T) {
+	servers, c := newTestCluster(t, 3)
+	shards := make(map[string]*gossdb.Client)
+	for _, srv := range servers {
+		shards[srv.String()] = shardClient(t, srv)
+	}
+	used := make(map[string]bool)
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprintf("key:%d", i)
+		if _, err := c.Set(key, "v"); err != nil {
+			t.Fatal(err)
+		}
+		addr := c.Route(key, false).Client.Addr()
+		used[addr] = true
+		for a, shard := range shards {
+			v, _ := shard.Get(key)
+			if (v != nil) != (a == addr) {
+				t.Fatalf("%s on %s = %v, routed to %s", key, a, v, addr)
+			}
+		}
+	}
+	if len(used) != 3 {
+		t.Fatalf("keys spread over %d shards, want 3", len(used))
+	}
+}
+
+func TestClusterMergedLists(t *testing.T) {
+	_, c := newTestCluster(t, 3)
+	var keys []string
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("k%02d", i)
+		keys = append(keys, key)
+		if _, err := c.Set(key, key); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.HSet("h"+key, "f", "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kvs, err := c.Scan("k04", "", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]string{{"k05", "k05"}, {"k06", "k06"}, {"k07", "k07"}, {"k08", "k08"}, {"k09", "k09"}}
+	if !reflect.DeepEqual(kvs, want) {
+		t.Fatalf("scan = %v, want %v", kvs, want)
+	}
+	names, err := c.HList("", "", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 20 || !sort.StringsAreSorted(names) {
+		t.Fatalf("hlist = %v", names)
+	}
+	m, err := c.MultiGetMap(keys...)
+	if err != nil || len(m) != 20 {
+		t.Fatalf("multi_get = %d pairs, %v", len(m), err)
+	}
+}
+
+func TestClusterPartialFailure(t *testing.T) {
+	servers, c := newTestCluster(t, 2)
+	var keys []string
+	down := ""
+	for i := 0; len(keys) < 10; i++ {
+		key := fmt.Sprintf("key:%d", i)
+		if _, err := c.Set(key, "v"); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+	servers[1].Close()
+	for _, key := range keys {
+		if c.Route(key, true).Client.Addr() == servers[1].String() {
+			down = key
+		}
+	}
+	if down == "" {
+		t.Fatal("no key on the second shard")
+	}
+
+	res := c.MultiGetResult(keys...)
+	var merr gossdb.MultiError
+	if err := res.Err(); !errors.As(err, &merr) || len(merr) != 1 || merr[0].Addr != servers[1].String() {
+		t.Fatalf("error = %v, want a failure of %s", err, servers[1])
+	}
+	if _, found := res.KeyErrors()[down]; !found {
+		t.Fatalf("no error for %s", down)
+	}
+	if len(res.Pairs)+len(merr[0].Keys) != len(keys) {
+		t.Fatalf("%d pairs and %d failed keys for %d keys", len(res.Pairs), len(merr[0].Keys), len(keys))
+	}
+	pairs, err := c.MultiGet(keys...)
+	if err == nil || len(pairs) != len(res.Pairs) {
+		t.Fatalf("multi_get = %d pairs, %v", len(pairs), err)
+	}
+
+	c.SetStrict(true)
+	if pairs, err := c.MultiGet(keys...); err == nil || pairs != nil {
+		t.Fatalf("strict multi_get = %v, %v", pairs, err)
+	}
+}
+
+func TestClusterReplicaReads(t *testing.T) {
+	master, replica := ssdbtest.NewServer(), ssdbtest.NewServer()
+	defer master.Close()
+	defer replica.Close()
+	topo := &gossdb.Topology{Shards: []gossdb.ShardConfig{{Master: master.String(), Replicas: []string{replica.String()}}}}
+	c, err := gossdb.NewClusterFromTopology(topo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := shardClient(t, replica).Set("k", "replica"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Set("k", "master"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := c.Get("k"); v != "master" {
+		t.Fatalf("get = %v, want the master value", v)
+	}
+	c.SetReplicaReads(true)
+	if v, _ := c.Get("k"); v != "replica" {
+		t.Fatalf("get = %v, want the replica value", v)
+	}
+	if addr := c.Route("k", false).Client.Addr(); addr != master.String() {
+		t.Fatalf("writes routed to %s, want %s", addr, master)
+	}
+}
+
+func TestClusterAuth(t *testing.T) {
+	srv := ssdbtest.NewServer()
+	defer srv.Close()
+	srv.SetPassword("secret")
+	topo := &gossdb.Topology{Shards: []gossdb.ShardConfig{{Master: srv.String(), Auth: "secret"}}}
+	c, err := gossdb.NewClusterFromTopology(topo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Set("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+}
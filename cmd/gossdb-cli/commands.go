@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Reply shapes used to print the replies of the commands
+const (
+	replyValue = iota
+	replyList
+	replyPairs
+	replyScores
+)
+
+// commands maps the known command names to the shape of their reply
+var commands = map[string]int{
+	"auth": replyValue, "ping": replyValue, "info": replyList, "dbsize": replyValue, "flushdb": replyValue,
+
+	"set": replyValue, "setx": replyValue, "setnx": replyValue, "get": replyValue, "getset": replyValue,
+	"del": replyValue, "incr": replyValue, "decr": replyValue, "exists": replyValue, "expire": replyValue,
+	"ttl": replyValue, "strlen": replyValue, "substr": replyValue, "getbit": replyValue, "setbit": replyValue,
+	"countbit": replyValue, "keys": replyList, "rkeys": replyList, "scan": replyPairs, "rscan": replyPairs,
+	"multi_set": replyValue, "multi_get": replyPairs, "multi_del": replyValue, "multi_exists": replyPairs,
+
+	"hset": replyValue, "hget": replyValue, "hdel": replyValue, "hincr": replyValue, "hdecr": replyValue,
+	"hexists": replyValue, "hsize": replyValue, "hlist": replyList, "hrlist": replyList, "hkeys": replyList,
+	"hgetall": replyPairs, "hscan": replyPairs, "hrscan": replyPairs, "hclear": replyValue,
+	"multi_hset": replyValue, "multi_hget": replyPairs, "multi_hdel": replyValue,
+
+	"zset": replyValue, "zget": replyValue, "zdel": replyValue, "zincr": replyValue, "zdecr": replyValue,
+	"zexists": replyValue, "zsize": replyValue, "zlist": replyList, "zrlist": replyList, "zkeys": replyList,
+	"zscan": replyScores, "zrscan": replyScores, "zrank": replyValue, "zrrank": replyValue,
+	"zrange": replyScores, "zrrange": replyScores, "zclear": replyValue, "zcount": replyValue,
+	"zsum": replyValue, "zavg": replyValue, "zremrangebyrank": replyValue, "zremrangebyscore": replyValue,
+	"zpop_front": replyScores, "zpop_back": replyScores,
+	"multi_zset": replyValue, "multi_zget": replyScores, "multi_zdel": replyValue,
+
+	"qsize": replyValue, "qclear": replyValue, "qfront": replyValue, "qback": replyValue, "qget": replyValue,
+	"qset": replyValue, "qslice": replyList, "qrange": replyList, "qlist": replyList, "qrlist": replyList,
+	"qpush": replyValue, "qpush_front": replyValue, "qpush_back": replyValue,
+	"qpop": replyList, "qpop_front": replyList, "qpop_back": replyList,
+	"qtrim_front": replyValue, "qtrim_back": replyValue,
+}
+
+// Commands handled by the cli itself
+var builtins = []string{"help", "quit", "exit"}
+
+// Names offered by tab completion, sorted
+func completions() []string {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	names = append(names, builtins...)
+	sort.Strings(names)
+	return names
+}
+
+// Names starting with prefix
+func complete(prefix string) []string {
+	var res []string
+	for _, name := range completions() {
+		if strings.HasPrefix(name, prefix) {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+var errUnterminated = errors.New("unterminated quote")
+
+// Split a command line into words. Quotes group words, double quotes
+// understand the \n, \t, \\, \" and \xNN escapes.
+func split(line string) ([]string, error) {
+	var (
+		words []string
+		word  []byte
+		in    bool
+		quote byte
+	)
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case quote == '"' && ch == '\\' && i+1 < len(line):
+			i++
+			switch line[i] {
+			case 'n':
+				word = append(word, '\n')
+			case 't':
+				word = append(word, '\t')
+			case 'r':
+				word = append(word, '\r')
+			case 'x':
+				if i+2 < len(line) && isHex(line[i+1]) && isHex(line[i+2]) {
+					word = append(word, unhex(line[i+1])<<4|unhex(line[i+2]))
+					i += 2
+				} else {
+					word = append(word, 'x')
+				}
+			default:
+				word = append(word, line[i])
+			}
+		case quote != 0 && ch == quote:
+			quote = 0
+		case quote != 0:
+			word = append(word, ch)
+		case ch == '"' || ch == '\'':
+			quote = ch
+			in = true
+		case ch == ' ' || ch == '\t':
+			if in {
+				words = append(words, string(word))
+				word = word[:0]
+				in = false
+			}
+		default:
+			word = append(word, ch)
+			in = true
+		}
+	}
+	if quote != 0 {
+		return nil, errUnterminated
+	}
+	if in {
+		words = append(words, string(word))
+	}
+	return words, nil
+}
+
+func isHex(ch byte) bool {
+	return (ch >= '0' && ch <= '9') || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+}
+
+func unhex(ch byte) byte {
+	switch {
+	case ch >= 'a':
+		return ch - 'a' + 10
+	case ch >= 'A':
+		return ch - 'A' + 10
+	}
+	return ch - '0'
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// Print a reply for a human: the values are quoted when they are not
+// printable and laid out by the shape of the command
+func printReply(w io.Writer, cmd string, resp []string) {
+	if len(resp) == 0 {
+		fmt.Fprintln(w, "(empty reply)")
+		return
+	}
+	switch resp[0] {
+	case "ok":
+	case "not_found":
+		fmt.Fprintln(w, "(not_found)")
+		return
+	default:
+		fmt.Fprintf(w, "(%s)", resp[0])
+		for _, v := range resp[1:] {
+			fmt.Fprintf(w, " %s", v)
+		}
+		fmt.Fprintln(w)
+		return
+	}
+	values := resp[1:]
+	shape, found := commands[cmd]
+	if !found {
+		shape = replyList
+	}
+	switch {
+	case len(values) == 0:
+		fmt.Fprintln(w, "(ok)")
+	case shape == replyValue && len(values) == 1:
+		fmt.Fprintln(w, quote(values[0]))
+	case (shape == replyPairs || shape == replyScores) && len(values)%2 == 0:
+		printPairs(w, values, shape == replyScores)
+	default:
+		for i, v := range values {
+			fmt.Fprintf(w, "%d) %s\n", i+1, quote(v))
+		}
+	}
+}
+
+// Print key-value or member-score pairs in two aligned columns
+func printPairs(w io.Writer, values []string, scores bool) {
+	width := 0
+	for i := 0; i < len(values); i += 2 {
+		if n := utf8.RuneCountInString(quote(values[i])); n > width {
+			width = n
+		}
+	}
+	for i := 0; i < len(values); i += 2 {
+		k, v := quote(values[i]), values[i+1]
+		if !scores {
+			v = quote(v)
+		}
+		fmt.Fprintf(w, "%-*s  %s\n", width, k, v)
+	}
+	fmt.Fprintf(w, "%d %s\n", len(values)/2, plural(len(values)/2, "pair", "pairs"))
+}
+
+// Print a reply for a script: one value per line, nothing on success
+// without values
+func printRaw(w io.Writer, resp []string) {
+	for _, v := range resp[1:] {
+		fmt.Fprintln(w, v)
+	}
+}
+
+func quote(s string) string {
+	for _, r := range s {
+		if r == utf8.RuneError || r < ' ' || r == '"' || r == '\\' || r == 0x7f {
+			return strconv.Quote(s)
+		}
+	}
+	if s == "" {
+		return `""`
+	}
+	return s
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("(%.3f ms)", float64(d)/float64(time.Millisecond))
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+var errInterrupted = errors.New("interrupted")
+
+// lineEditor reads command lines with history and tab completion of the
+// command names when stdin is a terminal
+type lineEditor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	fd      int
+	tty     bool
+	history []string
+}
+
+func newLineEditor(in *os.File, out io.Writer) *lineEditor {
+	fd := int(in.Fd())
+	return &lineEditor{in: bufio.NewReader(in), out: out, fd: fd, tty: isTerminal(fd)}
+}
+
+// readLine returns the next line, io.EOF at the end of the input and
+// errInterrupted when the line is cancelled with ctrl-c
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	if !e.tty {
+		return e.readPlain(prompt)
+	}
+	state, err := makeRaw(e.fd)
+	if err != nil {
+		return e.readPlain(prompt)
+	}
+	defer restore(e.fd, state)
+	line, err := e.edit(prompt)
+	if err == nil && strings.TrimSpace(line) != "" {
+		if len(e.history) == 0 || e.history[len(e.history)-1] != line {
+			e.history = append(e.history, line)
+		}
+	}
+	return line, err
+}
+
+func (e *lineEditor) readPlain(prompt string) (string, error) {
+	if e.tty {
+		fmt.Fprint(e.out, prompt)
+	}
+	line, err := e.in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// The editing state of the current line
+type editState struct {
+	prompt string
+	buf    []rune
+	pos    int
+}
+
+func (e *lineEditor) redraw(s *editState) {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", s.prompt, string(s.buf))
+	if back := len(s.buf) - s.pos; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
+
+func (e *lineEditor) edit(prompt string) (string, error) {
+	s := &editState{prompt: prompt}
+	hist := len(e.history)
+	e.redraw(s)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(s.buf), nil
+		case 3: // ctrl-c
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupted
+		case 4: // ctrl-d
+			if len(s.buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+		case 1: // ctrl-a
+			s.pos = 0
+		case 5: // ctrl-e
+			s.pos = len(s.buf)
+		case 21: // ctrl-u
+			s.buf, s.pos = s.buf[:0], 0
+		case 127, 8: // backspace
+			if s.pos > 0 {
+				s.buf = append(s.buf[:s.pos-1], s.buf[s.pos:]...)
+				s.pos--
+			}
+		case '\t':
+			e.complete(s)
+		case 27: // escape sequence
+			switch e.escape() {
+			case 'A':
+				if hist > 0 {
+					hist--
+					s.buf = []rune(e.history[hist])
+					s.pos = len(s.buf)
+				}
+			case 'B':
+				if hist < len(e.history) {
+					hist++
+					s.buf = nil
+					if hist < len(e.history) {
+						s.buf = []rune(e.history[hist])
+					}
+					s.pos = len(s.buf)
+				}
+			case 'C':
+				if s.pos < len(s.buf) {
+					s.pos++
+				}
+			case 'D':
+				if s.pos > 0 {
+					s.pos--
+				}
+			case 'H':
+				s.pos = 0
+			case 'F':
+				s.pos = len(s.buf)
+			case '3':
+				if s.pos < len(s.buf) {
+					s.buf = append(s.buf[:s.pos], s.buf[s.pos+1:]...)
+				}
+			}
+		default:
+			if r < ' ' || r == utf8.RuneError {
+				continue
+			}
+			s.buf = append(s.buf, 0)
+			copy(s.buf[s.pos+1:], s.buf[s.pos:])
+			s.buf[s.pos] = r
+			s.pos++
+		}
+		e.redraw(s)
+	}
+}
+
+// Read the rest of an escape sequence and return its final key: the arrow
+// letters, H and F for home and end, 3 for delete
+func (e *lineEditor) escape() rune {
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return 0
+	}
+	r, _, err = e.in.ReadRune()
+	if err != nil {
+		return 0
+	}
+	if r >= '0' && r <= '9' {
+		// ESC [ n ~
+		if next, _, err := e.in.ReadRune(); err != nil || next != '~' {
+			return 0
+		}
+		switch r {
+		case '1', '7':
+			return 'H'
+		case '4', '8':
+			return 'F'
+		}
+	}
+	return r
+}
+
+// Complete the command name under the cursor, a list of the candidates is
+// printed when there is more than one
+func (e *lineEditor) complete(s *editState) {
+	word := string(s.buf[:s.pos])
+	if strings.ContainsAny(strings.TrimLeft(word, " "), " ") {
+		return
+	}
+	prefix := strings.ToLower(strings.TrimLeft(word, " "))
+	matches := complete(prefix)
+	switch len(matches) {
+	case 0:
+		return
+	case 1:
+		e.insert(s, matches[0][len(prefix):]+" ")
+		return
+	}
+	common := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(common) > len(prefix) {
+		e.insert(s, common[len(prefix):])
+		return
+	}
+	fmt.Fprint(e.out, "\r\n"+strings.Join(matches, "  ")+"\r\n")
+}
+
+func (e *lineEditor) insert(s *editState, text string) {
+	rs := []rune(text)
+	s.buf = append(s.buf[:s.pos], append(rs, s.buf[s.pos:]...)...)
+	s.pos += len(rs)
+}
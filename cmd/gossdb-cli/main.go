@@ -0,0 +1,182 @@
+// Command gossdb-cli is an interactive SSDB client built on gossdb.Client
+// and gossdb.Cluster.
+//
+//	gossdb-cli -h 127.0.0.1 -p 8888
+//	gossdb-cli -topology topology.json
+//	gossdb-cli get key
+//	gossdb-cli --pipe < commands.txt
+//
+// Command names complete with tab, replies are printed by type with the
+// time they took. In pipe mode the commands are read from stdin and the
+// values printed one per line, the exit status is 1 when a command failed.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bububa/gossdb"
+)
+
+func main() {
+	var (
+		host     = flag.String("h", "127.0.0.1", "server host")
+		port     = flag.Int("p", 8888, "server port")
+		password = flag.String("a", "", "password sent with auth")
+		topology = flag.String("topology", "", "JSON topology file of a cluster")
+		shards   = flag.String("shards", "", "comma separated host:port of a cluster")
+		timeout  = flag.Duration("timeout", gossdb.TIMEOUT, "read and write timeout")
+		pipe     = flag.Bool("pipe", false, "read commands from stdin and print raw values")
+		timing   = flag.Bool("timing", true, "print the time taken by each command")
+	)
+	flag.Parse()
+
+	r, name, err := connect(*host, *port, *password, *topology, *shards, *timeout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "connect:", err)
+		os.Exit(1)
+	}
+	defer r.close()
+
+	switch {
+	case flag.NArg() > 0:
+		resp, err := r.do(flag.Args())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		printReply(os.Stdout, strings.ToLower(flag.Arg(0)), resp)
+	case *pipe:
+		if !runPipe(r, os.Stdin, os.Stdout, os.Stderr) {
+			os.Exit(1)
+		}
+	default:
+		repl(r, name, *timing)
+	}
+}
+
+func connect(host string, port int, password, topology, shards string, timeout time.Duration) (runner, string, error) {
+	if topology != "" || shards != "" {
+		var (
+			t   *gossdb.Topology
+			err error
+		)
+		if topology != "" {
+			t, err = gossdb.LoadTopologyFile(topology)
+		} else {
+			t = gossdb.NewTopology(strings.Split(shards, ","))
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		for i := range t.Shards {
+			if t.Shards[i].Auth == "" {
+				t.Shards[i].Auth = password
+			}
+		}
+		c, err := gossdb.NewClusterFromTopology(t)
+		if err != nil {
+			return nil, "", err
+		}
+		c.SetTimeout(timeout)
+		return clusterRunner{c}, fmt.Sprintf("cluster(%d)", len(t.Shards)), nil
+	}
+	addr, err := net.ResolveTCPAddr("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, "", err
+	}
+	c := gossdb.NewClient(nil, addr)
+	c.SetAuth(password)
+	c.SetTimeout(timeout)
+	if err := c.Reconnect(); err != nil {
+		return nil, "", err
+	}
+	return nodeRunner{c}, addr.String(), nil
+}
+
+func repl(r runner, name string, timing bool) {
+	e := newLineEditor(os.Stdin, os.Stdout)
+	prompt := name + "> "
+	for {
+		line, err := e.readLine(prompt)
+		if err == errInterrupted {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		args, err := split(line)
+		if err != nil {
+			fmt.Println("(error)", err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		cmd := strings.ToLower(args[0])
+		switch cmd {
+		case "quit", "exit":
+			return
+		case "help":
+			fmt.Println(strings.Join(completions(), " "))
+			continue
+		}
+		start := time.Now()
+		resp, err := r.do(args)
+		d := time.Since(start)
+		if err != nil {
+			fmt.Println("(error)", err)
+		} else {
+			printReply(os.Stdout, cmd, resp)
+		}
+		if timing {
+			fmt.Println(formatDuration(d))
+		}
+	}
+}
+
+// Run the commands of in, it reports whether they all succeeded
+func runPipe(r runner, in io.Reader, out, errOut io.Writer) bool {
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+	success := true
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, gossdb.MAX_REPLY_SIZE)
+	for n := 1; scanner.Scan(); n++ {
+		args, err := split(scanner.Text())
+		if err == nil && len(args) == 0 {
+			continue
+		}
+		var resp []string
+		if err == nil {
+			resp, err = r.do(args)
+		}
+		if err == nil && len(resp) == 0 {
+			err = gossdb.ErrBadResponse
+		}
+		if err == nil && resp[0] != "ok" && resp[0] != "not_found" {
+			err = fmt.Errorf("%s", strings.Join(resp, " "))
+		}
+		if err != nil {
+			w.Flush()
+			fmt.Fprintf(errOut, "line %d: %v\n", n, err)
+			success = false
+			continue
+		}
+		if resp[0] == "ok" {
+			printRaw(w, resp)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(errOut, err)
+		return false
+	}
+	return success
+}
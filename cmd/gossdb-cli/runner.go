@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bububa/gossdb"
+	"github.com/bububa/gossdb/internal/shardcmd"
+)
+
+// runner sends a command to a server or a cluster and returns the raw reply
+type runner interface {
+	do(args []string) ([]string, error)
+	close() error
+}
+
+func toArgs(args []string) []interface{} {
+	res := make([]interface{}, len(args))
+	for i, arg := range args {
+		res[i] = arg
+	}
+	return res
+}
+
+type nodeRunner struct {
+	c *gossdb.Client
+}
+
+func (r nodeRunner) do(args []string) ([]string, error) {
+	return r.c.Do(0, toArgs(args)...)
+}
+
+func (r nodeRunner) close() error {
+	return r.c.Close()
+}
+
+// clusterRunner sends keyed commands to the shard owning the key and sends
+// the commands spanning shards to every shard, merging the replies
+type clusterRunner struct {
+	c *gossdb.Cluster
+}
+
+func (r clusterRunner) close() error {
+	return r.c.Close()
+}
+
+func (r clusterRunner) do(args []string) ([]string, error) {
+	cmd := strings.ToLower(args[0])
+	if _, found := shardcmd.Ranges[cmd]; found {
+		return r.ranged(cmd, args)
+	}
+	switch cmd {
+	case "ping":
+		return r.each(false, args, func(resp []string) {})
+	case "dbsize":
+		var n int64
+		resp, err := r.each(false, args, func(resp []string) {
+			if len(resp) > 1 {
+				size, _ := strconv.ParseInt(resp[1], 10, 64)
+				n += size
+			}
+		})
+		if err != nil || resp[0] != "ok" {
+			return resp, err
+		}
+		return []string{"ok", strconv.FormatInt(n, 10)}, nil
+	case "multi_get":
+		pairs, err := r.c.MultiGet(args[1:]...)
+		if err != nil {
+			return nil, err
+		}
+		resp := []string{"ok"}
+		for _, p := range pairs {
+			resp = append(resp, p.Key, fmt.Sprint(p.Value))
+		}
+		return resp, nil
+	case "multi_exists":
+		return r.multi(args, 1, true)
+	case "multi_set":
+		return r.multi(args, 2, false)
+	case "multi_del":
+		return r.multi(args, 1, false)
+	case "auth", "info", "flushdb":
+		return clientError(cmd + " is not supported in a cluster"), nil
+	}
+	if len(args) < 2 {
+		return clientError("command needs a key to be routed in a cluster"), nil
+	}
+	_, known := commands[cmd]
+	return r.c.Route(args[1], known && shardcmd.IsRead(cmd)).Client.Do(0, toArgs(args)...)
+}
+
+// Send args to every shard and pass the ok replies to fn, the first other
+// reply is returned
+func (r clusterRunner) each(read bool, args []string, fn func(resp []string)) ([]string, error) {
+	for _, sc := range r.c.ShardClients(read) {
+		resp, err := sc.Client.Do(0, toArgs(args)...)
+		if err != nil {
+			return nil, fmt.Errorf("shard %s: %v", sc.Name, err)
+		}
+		if len(resp) == 0 {
+			return nil, fmt.Errorf("shard %s: %v", sc.Name, gossdb.ErrBadResponse)
+		}
+		if resp[0] != "ok" {
+			return resp, nil
+		}
+		fn(resp)
+	}
+	return []string{"ok"}, nil
+}
+
+// Run a range command on every shard and merge the items in order
+func (r clusterRunner) ranged(cmd string, args []string) ([]string, error) {
+	if len(args) != 4 {
+		return clientError("wrong number of arguments"), nil
+	}
+	limit, err := strconv.Atoi(args[3])
+	if err != nil {
+		return clientError("invalid limit"), nil
+	}
+	shape := shardcmd.Ranges[cmd]
+	var items [][]string
+	resp, err := r.each(true, args, func(resp []string) {
+		values := resp[1:]
+		for i := 0; i+shape.Width <= len(values); i += shape.Width {
+			items = append(items, values[i:i+shape.Width])
+		}
+	})
+	if err != nil || resp[0] != "ok" {
+		return resp, err
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if shape.Reverse {
+			return items[i][0] > items[j][0]
+		}
+		return items[i][0] < items[j][0]
+	})
+	if limit >= 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	for _, item := range items {
+		resp = append(resp, item...)
+	}
+	return resp, nil
+}
+
+// Send the items of a multi-key command to their shards, each item is
+// width values starting with the key. The replies of the reads are
+// concatenated and the counts of the writes summed.
+func (r clusterRunner) multi(args []string, width int, read bool) ([]string, error) {
+	if len(args) == 1 || (len(args)-1)%width != 0 {
+		return clientError("wrong number of arguments"), nil
+	}
+	items := make(map[string][]interface{})
+	var shards []gossdb.ShardClient
+	for i := 1; i < len(args); i += width {
+		sc := r.c.Route(args[i], read)
+		if _, found := items[sc.Name]; !found {
+			shards = append(shards, sc)
+			items[sc.Name] = []interface{}{args[0]}
+		}
+		items[sc.Name] = append(items[sc.Name], toArgs(args[i:i+width])...)
+	}
+	res := []string{"ok"}
+	var n int64
+	for _, sc := range shards {
+		resp, err := sc.Client.Do(0, items[sc.Name]...)
+		if err != nil {
+			return nil, fmt.Errorf("shard %s: %v", sc.Name, err)
+		}
+		if len(resp) == 0 {
+			return nil, fmt.Errorf("shard %s: %v", sc.Name, gossdb.ErrBadResponse)
+		}
+		if resp[0] != "ok" {
+			return resp, nil
+		}
+		if read {
+			res = append(res, resp[1:]...)
+		} else if len(resp) > 1 {
+			count, _ := strconv.ParseInt(resp[1], 10, 64)
+			n += count
+		}
+	}
+	if !read {
+		res = append(res, strconv.FormatInt(n, 10))
+	}
+	return res, nil
+}
+
+func clientError(msg string) []string {
+	return []string{"client_error", msg}
+}
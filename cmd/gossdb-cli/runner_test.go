@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bububa/gossdb/ssdbtest"
+)
+
+// Start n shards with password and a cluster runner connected to them
+func newTestRunner(t *testing.T, n int, password string) runner {
+	t.Helper()
+	var addrs []string
+	for i := 0; i < n; i++ {
+		s := ssdbtest.NewServer()
+		s.SetPassword(password)
+		t.Cleanup(func() { s.Close() })
+		addrs = append(addrs, s.Addr().String())
+	}
+	r, _, err := connect("", 0, password, "", strings.Join(addrs, ","), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.close() })
+	return r
+}
+
+func expect(t *testing.T, r runner, args []string, want ...string) {
+	t.Helper()
+	resp, err := r.do(args)
+	if err != nil || !reflect.DeepEqual(resp, want) {
+		t.Fatalf("%v = %q, %v, want %q", args, resp, err, want)
+	}
+}
+
+func TestClusterRunner(t *testing.T) {
+	r := newTestRunner(t, 3, "secret")
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("k%d", i)
+		expect(t, r, []string{"set", key, "v" + key}, "ok", "1")
+		expect(t, r, []string{"qpush", "q" + key, "item"}, "ok", "1")
+	}
+	expect(t, r, []string{"ping"}, "ok")
+	expect(t, r, []string{"dbsize"}, "ok", "20")
+	expect(t, r, []string{"rscan", "k7", "", "2"}, "ok", "k6", "vk6", "k5", "vk5")
+	expect(t, r, []string{"rkeys", "", "", "3"}, "ok", "k9", "k8", "k7")
+	expect(t, r, []string{"qlist", "qk7", "", "-1"}, "ok", "qk8", "qk9")
+	expect(t, r, []string{"qrlist", "", "", "2"}, "ok", "qk9", "qk8")
+	resp, err := r.do([]string{"multi_exists", "k1", "missing", "k2"})
+	if err != nil || len(resp) != 7 {
+		t.Fatalf("multi_exists = %q, %v", resp, err)
+	}
+	exists := make(map[string]string)
+	for i := 1; i+1 < len(resp); i += 2 {
+		exists[resp[i]] = resp[i+1]
+	}
+	if !reflect.DeepEqual(exists, map[string]string{"k1": "1", "missing": "0", "k2": "1"}) {
+		t.Fatalf("multi_exists = %q", resp)
+	}
+	// the counts replied by the shards are summed
+	expect(t, r, []string{"multi_set", "m1", "1", "m2", "2", "m3", "3", "m4", "4"}, "ok", "4")
+	expect(t, r, []string{"get", "m3"}, "ok", "3")
+	expect(t, r, []string{"multi_del", "m1", "m2", "m3"}, "ok", "3")
+	expect(t, r, []string{"exists", "m2"}, "ok", "0")
+	expect(t, r, []string{"multi_set", "m1", "1", "m2"}, "client_error", "wrong number of arguments")
+	if resp, _ := r.do([]string{"flushdb"}); resp[0] != "client_error" {
+		t.Fatalf("flushdb = %q, want a client error", resp)
+	}
+}
+
+func TestPipe(t *testing.T) {
+	r := newTestRunner(t, 2, "")
+	var out, errOut strings.Builder
+	in := "set a 1\n\nget a\nget missing\nbogus\n"
+	if runPipe(r, strings.NewReader(in), &out, &errOut) {
+		t.Fatal("pipe with a failed command succeeded")
+	}
+	if out.String() != "1\n1\n" {
+		t.Fatalf("output = %q", out.String())
+	}
+	if !strings.HasPrefix(errOut.String(), "line 5:") {
+		t.Fatalf("errors = %q", errOut.String())
+	}
+}
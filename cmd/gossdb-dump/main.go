@@ -0,0 +1,193 @@
+// Command gossdb-dump backs up a server or a cluster to a portable file
+// and restores it, with gossdb.Dump and gossdb.Restore.
+//
+//	gossdb-dump -h 127.0.0.1 -p 8888 dump -o backup.gsdb
+//	gossdb-dump -topology topology.json restore -i backup.gsdb
+//	gossdb-dump verify -i backup.gsdb
+//
+// The dump is written to stdout and restored from stdin without -o and -i.
+// verify reads a dump without connecting and prints what it holds, with
+// -list the records themselves.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bububa/gossdb"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+// run returns the exit status, the deferred closes run before the exit
+func run() int {
+	var (
+		host     = flag.String("h", "127.0.0.1", "server host")
+		port     = flag.Int("p", 8888, "server port")
+		password = flag.String("a", "", "password sent with auth")
+		topology = flag.String("topology", "", "JSON topology file of a cluster")
+		shards   = flag.String("shards", "", "comma separated host:port of a cluster")
+		timeout  = flag.Duration("timeout", gossdb.TIMEOUT, "read and write timeout")
+		output   = flag.String("o", "", "file written by dump, stdout by default")
+		input    = flag.String("i", "", "file read by restore and verify, stdin by default")
+		list     = flag.Bool("list", false, "print the records read by verify")
+	)
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gossdb-dump [flags] dump|restore|verify")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		return 2
+	}
+
+	var err error
+	switch cmd := flag.Arg(0); cmd {
+	case "verify":
+		err = verify(*input, *list)
+	case "dump", "restore":
+		var (
+			c     gossdb.Commander
+			close func() error
+		)
+		c, close, err = connect(*host, *port, *password, *topology, *shards, *timeout)
+		if err != nil {
+			break
+		}
+		defer close()
+		if cmd == "dump" {
+			err = dump(c, *output)
+		} else {
+			err = restore(c, *input)
+		}
+	default:
+		flag.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+func connect(host string, port int, password, topology, shards string, timeout time.Duration) (gossdb.Commander, func() error, error) {
+	if topology != "" || shards != "" {
+		var (
+			t   *gossdb.Topology
+			err error
+		)
+		if topology != "" {
+			t, err = gossdb.LoadTopologyFile(topology)
+		} else {
+			t = gossdb.NewTopology(strings.Split(shards, ","))
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		for i := range t.Shards {
+			if t.Shards[i].Auth == "" {
+				t.Shards[i].Auth = password
+			}
+		}
+		c, err := gossdb.NewClusterFromTopology(t)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.SetTimeout(timeout)
+		return c, c.Close, nil
+	}
+	addr, err := net.ResolveTCPAddr("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, nil, err
+	}
+	c := gossdb.NewClient(nil, addr)
+	c.SetAuth(password)
+	c.SetTimeout(timeout)
+	if err := c.Reconnect(); err != nil {
+		return nil, nil, err
+	}
+	return c, c.Close, nil
+}
+
+func dump(c gossdb.Commander, output string) error {
+	if output == "" {
+		return gossdb.Dump(c, os.Stdout)
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if err := gossdb.Dump(c, f); err != nil {
+		f.Close()
+		os.Remove(output)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func open(input string) (io.ReadCloser, error) {
+	if input == "" {
+		return os.Stdin, nil
+	}
+	return os.Open(input)
+}
+
+func restore(c gossdb.Commander, input string) error {
+	f, err := open(input)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return gossdb.Restore(c, f)
+}
+
+// Read the whole dump to check its checksums and count its records
+func verify(input string, list bool) error {
+	f, err := open(input)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	d, err := gossdb.NewDumpReader(f)
+	if err != nil {
+		return err
+	}
+	var (
+		records int
+		names   = map[byte]map[string]bool{}
+	)
+	for {
+		rec, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("record %d: %v", records+1, err)
+		}
+		records++
+		if names[rec.Kind] == nil {
+			names[rec.Kind] = map[string]bool{}
+		}
+		names[rec.Kind][rec.Name] = true
+		if list {
+			fmt.Println(rec)
+		}
+	}
+	fmt.Printf("ok: %d records, %d keys, %d hashes, %d zsets, %d queues\n", records,
+		len(names[gossdb.DumpKV]), len(names[gossdb.DumpHash]), len(names[gossdb.DumpZSet]), len(names[gossdb.DumpQueue]))
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bububa/gossdb"
+)
+
+var errUnavailable = errors.New("shard unavailable")
+
+// nodeHealth is the state of one server of the cluster
+type nodeHealth struct {
+	Shard     string    `json:"shard"`
+	Addr      string    `json:"addr"`
+	Master    bool      `json:"master"`
+	Up        bool      `json:"up"`
+	Failures  int       `json:"failures"`
+	LastError string    `json:"last_error,omitempty"`
+	LastCheck time.Time `json:"last_check"`
+
+	// the checks use their own connection so they never wait behind the
+	// commands of the clients
+	client *gossdb.Client
+	auth   string
+}
+
+// health pings every server of the cluster. A server is down after
+// maxFailures failed pings in a row and up again after one success.
+type health struct {
+	mutex       sync.RWMutex
+	nodes       map[string]*nodeHealth
+	timeout     time.Duration
+	maxFailures int
+}
+
+// newHealth checks the servers of t, timeout bounds a ping
+func newHealth(t *gossdb.Topology, timeout time.Duration, maxFailures int) (*health, error) {
+	h := &health{nodes: make(map[string]*nodeHealth), timeout: timeout, maxFailures: maxFailures}
+	if err := h.update(t); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// shardServer is a master or a replica of a topology
+type shardServer struct {
+	addr   *net.TCPAddr
+	shard  string
+	master bool
+	auth   string
+}
+
+// The servers of t with their resolved addresses
+func topologyServers(t *gossdb.Topology) ([]shardServer, error) {
+	var res []shardServer
+	for _, cfg := range t.Shards {
+		name := cfg.Name
+		if name == "" {
+			name = cfg.Master
+		}
+		for i, addr := range append([]string{cfg.Master}, cfg.Replicas...) {
+			tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, shardServer{tcpAddr, name, i == 0, cfg.Auth})
+		}
+	}
+	return res, nil
+}
+
+// update switches to the servers of a new topology, the servers already
+// checked keep their state
+func (h *health) update(t *gossdb.Topology) error {
+	servers, err := topologyServers(t)
+	if err != nil {
+		return err
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	nodes := make(map[string]*nodeHealth, len(servers))
+	for _, s := range servers {
+		addr := s.addr.String()
+		n, found := h.nodes[addr]
+		if !found || n.auth != s.auth {
+			cli := gossdb.NewClient(nil, s.addr)
+			cli.SetAuth(s.auth)
+			cli.SetTimeout(h.timeout)
+			n = &nodeHealth{Addr: addr, Up: true, client: cli, auth: s.auth}
+		}
+		n.Shard = s.shard
+		n.Master = s.master
+		nodes[addr] = n
+	}
+	for addr, n := range h.nodes {
+		if nodes[addr] != n {
+			n.client.Close()
+		}
+	}
+	h.nodes = nodes
+	return nil
+}
+
+// up reports whether the server at addr answers, unknown servers are up
+func (h *health) up(addr string) bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	n, found := h.nodes[addr]
+	return !found || n.Up
+}
+
+// run checks the servers every interval until stop is closed
+func (h *health) run(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		h.check()
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (h *health) check() {
+	h.mutex.RLock()
+	nodes := make([]*nodeHealth, 0, len(h.nodes))
+	for _, n := range h.nodes {
+		nodes = append(nodes, n)
+	}
+	h.mutex.RUnlock()
+	var wg sync.WaitGroup
+	for _, n := range nodes {
+		wg.Add(1)
+		go func(n *nodeHealth) {
+			defer wg.Done()
+			// no retries, a failed ping counts as a failure
+			_, err := n.client.Do(gossdb.MAX_RETRIES, "ping")
+			h.mutex.Lock()
+			defer h.mutex.Unlock()
+			n.LastCheck = time.Now()
+			if err == nil {
+				n.Up = true
+				n.Failures = 0
+				n.LastError = ""
+				return
+			}
+			n.Failures++
+			n.LastError = err.Error()
+			if n.Failures >= h.maxFailures {
+				n.Up = false
+			}
+		}(n)
+	}
+	wg.Wait()
+}
+
+// status lists the servers by shard, masters first
+func (h *health) status() []nodeHealth {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	res := make([]nodeHealth, 0, len(h.nodes))
+	for _, n := range h.nodes {
+		res = append(res, *n)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Shard != res[j].Shard {
+			return res[i].Shard < res[j].Shard
+		}
+		if res[i].Master != res[j].Master {
+			return res[i].Master
+		}
+		return res[i].Addr < res[j].Addr
+	})
+	return res
+}
+
+func (h *health) close() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, n := range h.nodes {
+		n.client.Close()
+	}
+}
@@ -0,0 +1,145 @@
+// Command ssdb-proxy speaks the SSDB protocol and routes every command to
+// the shard owning its key, with the same hashing as gossdb.Cluster, so
+// services in any language can use a sharded deployment.
+//
+//	ssdb-proxy -listen :8888 -topology topology.json -stats :8889
+//	ssdb-proxy -listen :8888 -shards 10.0.0.1:8888,10.0.0.2:8888
+//
+// Multi-key and range commands are sent to every shard concurrently and
+// their replies merged. Each server gets -conns connections, so a slow
+// command does not hold the others. The servers are pinged every
+// -health-interval and a shard whose master is down gets an error reply
+// without waiting for a timeout. The stats address serves /stats, /health
+// and /metrics. A SIGHUP reloads the topology file.
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bububa/gossdb"
+	"github.com/bububa/gossdb/server"
+)
+
+func main() {
+	var (
+		listen       = flag.String("listen", ":8888", "address of the proxy")
+		topology     = flag.String("topology", "", "JSON topology file")
+		shards       = flag.String("shards", "", "comma separated host:port of the shards, when there is no topology file")
+		password     = flag.String("password", "", "password the clients must send with auth")
+		statsAddr    = flag.String("stats", "", "address of the stats HTTP endpoint")
+		replicaReads = flag.Bool("replica-reads", false, "send reads to the replicas")
+		timeout      = flag.Duration("timeout", gossdb.TIMEOUT, "connect, read and write timeout of the shard connections")
+		conns        = flag.Int("conns", 8, "connections to each shard server")
+		interval     = flag.Duration("health-interval", 5*time.Second, "time between health checks")
+		failures     = flag.Int("health-failures", 3, "failed checks before a server is marked down")
+	)
+	flag.Parse()
+
+	t, err := loadTopology(*topology, *shards)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cluster, err := gossdb.NewClusterFromTopology(t)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer cluster.Close()
+	metrics := gossdb.NewPrometheusMetrics("ssdb_proxy")
+	cluster.SetMetrics(metrics)
+	cluster.SetTimeout(*timeout)
+	cluster.SetReplicaReads(*replicaReads)
+	if *conns <= 0 {
+		log.Fatal("-conns must be positive")
+	}
+	pools, err := newPools(t, *conns, func(cli *gossdb.Client) {
+		cli.SetMetrics(metrics)
+		cli.SetTimeout(*timeout)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pools.close()
+
+	h, err := newHealth(t, *timeout, *failures)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer h.close()
+	stop := make(chan struct{})
+	go h.run(*interval, stop)
+
+	p := &proxy{cluster: cluster, pools: pools, health: h, stats: newStats()}
+	srv := server.NewServer()
+	srv.SetPassword(*password)
+	p.register(srv)
+
+	if *statsAddr != "" {
+		go func() {
+			log.Fatal(http.ListenAndServe(*statsAddr, statsHandler(p, metrics)))
+		}()
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for s := range sig {
+			if s == syscall.SIGHUP {
+				if err := reload(cluster, pools, h, *topology); err != nil {
+					log.Printf("reload: %v", err)
+				}
+				continue
+			}
+			close(stop)
+			srv.Close()
+			return
+		}
+	}()
+	log.Printf("ssdb-proxy listening on %s, %d shards", *listen, len(t.Shards))
+	if err := srv.ListenAndServe(*listen); err != server.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+func loadTopology(path, shards string) (*gossdb.Topology, error) {
+	if path != "" {
+		return gossdb.LoadTopologyFile(path)
+	}
+	t := gossdb.NewTopology(strings.Split(shards, ","))
+	if shards == "" {
+		t.Shards = nil
+	}
+	return t, t.Validate()
+}
+
+// Switch the cluster, the connections and the health checks to the
+// topology in path
+func reload(cluster *gossdb.Cluster, pools *pools, h *health, path string) error {
+	if path == "" {
+		return errors.New("no topology file")
+	}
+	t, err := gossdb.LoadTopologyFile(path)
+	if err != nil {
+		return err
+	}
+	// the pools first, so the commands routed with the new topology find
+	// the connections of its servers
+	if err := pools.update(t); err != nil {
+		return err
+	}
+	if err := cluster.UpdateTopology(t); err != nil {
+		return err
+	}
+	if err := h.update(t); err != nil {
+		return err
+	}
+	log.Printf("topology reloaded, %d shards", len(t.Shards))
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/bububa/gossdb"
+)
+
+// pools holds the connections the commands of the clients are sent on,
+// several per server so a slow command does not hold the others
+type pools struct {
+	mutex sync.RWMutex
+	// size is the number of connections per server
+	size    int
+	setup   func(*gossdb.Client)
+	servers map[string]*serverPool
+}
+
+type serverPool struct {
+	pool *gossdb.Pool
+	auth string
+}
+
+// newPools opens size connections to every server of t on their first
+// command, setup configures each of them
+func newPools(t *gossdb.Topology, size int, setup func(*gossdb.Client)) (*pools, error) {
+	p := &pools{size: size, setup: setup, servers: make(map[string]*serverPool)}
+	if err := p.update(t); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// update switches to the servers of a new topology, the connections to the
+// servers already known are kept
+func (p *pools) update(t *gossdb.Topology) error {
+	servers, err := topologyServers(t)
+	if err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	pools := make(map[string]*serverPool, len(servers))
+	for _, s := range servers {
+		addr := s.addr.String()
+		sp, found := p.servers[addr]
+		if !found || sp.auth != s.auth {
+			clients := make([]*gossdb.Client, p.size)
+			for i := range clients {
+				clients[i] = gossdb.NewClient(nil, s.addr)
+				clients[i].SetAuth(s.auth)
+				if p.setup != nil {
+					p.setup(clients[i])
+				}
+			}
+			pool, err := gossdb.NewPoolFromClients(clients...)
+			if err != nil {
+				return err
+			}
+			sp = &serverPool{pool: pool, auth: s.auth}
+		}
+		pools[addr] = sp
+	}
+	for addr, sp := range p.servers {
+		if pools[addr] != sp {
+			sp.pool.Close()
+		}
+	}
+	p.servers = pools
+	return nil
+}
+
+// get returns the pool of the server at addr, nil when it is unknown
+func (p *pools) get(addr string) *gossdb.Pool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if sp, found := p.servers[addr]; found {
+		return sp.pool
+	}
+	return nil
+}
+
+func (p *pools) close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, sp := range p.servers {
+		sp.pool.Close()
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/bububa/gossdb"
+	"github.com/bububa/gossdb/internal/shardcmd"
+	"github.com/bububa/gossdb/server"
+)
+
+// proxy routes the commands of its clients to the shards of a cluster
+type proxy struct {
+	cluster *gossdb.Cluster
+	pools   *pools
+	health  *health
+	stats   *stats
+}
+
+func (p *proxy) register(srv *server.Server) {
+	handle := func(cmd string, fn server.HandlerFunc) {
+		srv.HandleFunc(cmd, p.stats.count(fn))
+	}
+	for _, cmd := range shardcmd.Reads {
+		handle(cmd, p.keyed(true))
+	}
+	for _, cmd := range shardcmd.Writes {
+		handle(cmd, p.keyed(false))
+	}
+	for cmd := range shardcmd.Ranges {
+		handle(cmd, p.ranged)
+	}
+	handle("multi_get", p.multi(1, true))
+	handle("multi_exists", p.multi(1, true))
+	handle("multi_del", p.multi(1, false))
+	handle("multi_set", p.multi(2, false))
+	handle("dbsize", p.dbsize)
+	handle("ping", func(req *server.Request) []string {
+		return server.OK()
+	})
+	srv.HandleDefault(p.stats.count(func(req *server.Request) []string {
+		return server.ClientError("command not supported by the proxy: " + req.Cmd)
+	}))
+}
+
+func args(req *server.Request) []interface{} {
+	res := make([]interface{}, 0, len(req.Args)+1)
+	res = append(res, req.Cmd)
+	for _, arg := range req.Args {
+		res = append(res, arg)
+	}
+	return res
+}
+
+// Pick the client for a key, reads fall back to the master when the
+// replica is down
+func (p *proxy) route(key string, read bool) (gossdb.ShardClient, bool) {
+	sc := p.cluster.Route(key, read)
+	if read && !p.health.up(sc.Client.Addr()) {
+		sc = p.cluster.Route(key, false)
+	}
+	return sc, p.health.up(sc.Client.Addr())
+}
+
+// Every shard with the client to use, like route
+func (p *proxy) shards(read bool) []gossdb.ShardClient {
+	res := p.cluster.ShardClients(read)
+	if !read {
+		return res
+	}
+	masters := p.cluster.ShardClients(false)
+	for i, sc := range res {
+		if !p.health.up(sc.Client.Addr()) {
+			res[i] = masters[i]
+		}
+	}
+	return res
+}
+
+// Send a raw command to a shard and count it, it goes through the pool of
+// the server the cluster routed it to
+func (p *proxy) send(sc gossdb.ShardClient, args []interface{}) ([]string, error) {
+	var (
+		resp []string
+		err  error
+	)
+	if pool := p.pools.get(sc.Client.Addr()); pool != nil {
+		resp, err = pool.Do(0, args...)
+	} else {
+		resp, err = sc.Client.Do(0, args...)
+	}
+	p.stats.shard(sc.Name, err)
+	return resp, err
+}
+
+func unavailable(name string) []string {
+	return server.Error("shard " + name + " unavailable")
+}
+
+func (p *proxy) keyed(read bool) server.HandlerFunc {
+	return func(req *server.Request) []string {
+		if len(req.Args) == 0 {
+			return server.ClientError("wrong number of arguments")
+		}
+		sc, up := p.route(req.Args[0], read)
+		if !up {
+			return unavailable(sc.Name)
+		}
+		resp, err := p.send(sc, args(req))
+		if err != nil {
+			return server.Error(err.Error())
+		}
+		return resp
+	}
+}
+
+type shardReply struct {
+	name string
+	resp []string
+	err  error
+}
+
+// Send a command built by fn to every shard concurrently
+func (p *proxy) fanout(shards []gossdb.ShardClient, fn func(sc gossdb.ShardClient) []interface{}) []shardReply {
+	res := make([]shardReply, len(shards))
+	var wg sync.WaitGroup
+	for i, sc := range shards {
+		if !p.health.up(sc.Client.Addr()) {
+			res[i] = shardReply{name: sc.Name, err: errUnavailable}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, sc gossdb.ShardClient) {
+			defer wg.Done()
+			resp, err := p.send(sc, fn(sc))
+			res[i] = shardReply{sc.Name, resp, err}
+		}(i, sc)
+	}
+	wg.Wait()
+	return res
+}
+
+// The first failed reply of a fan-out
+func failed(replies []shardReply) []string {
+	for _, r := range replies {
+		if r.err == errUnavailable {
+			return unavailable(r.name)
+		}
+		if r.err != nil {
+			return server.Error("shard " + r.name + ": " + r.err.Error())
+		}
+		if len(r.resp) == 0 || r.resp[0] != "ok" {
+			return r.resp
+		}
+	}
+	return nil
+}
+
+// Split the keys of a multi-key command by shard, each item is width
+// values starting with the key
+func (p *proxy) multi(width int, read bool) server.HandlerFunc {
+	return func(req *server.Request) []string {
+		if len(req.Args) == 0 || len(req.Args)%width != 0 {
+			return server.ClientError("wrong number of arguments")
+		}
+		items := make(map[string][]interface{})
+		var shards []gossdb.ShardClient
+		for i := 0; i < len(req.Args); i += width {
+			sc, _ := p.route(req.Args[i], read)
+			if _, found := items[sc.Name]; !found {
+				shards = append(shards, sc)
+				items[sc.Name] = []interface{}{req.Cmd}
+			}
+			for _, v := range req.Args[i : i+width] {
+				items[sc.Name] = append(items[sc.Name], v)
+			}
+		}
+		replies := p.fanout(shards, func(sc gossdb.ShardClient) []interface{} {
+			return items[sc.Name]
+		})
+		if resp := failed(replies); resp != nil {
+			return resp
+		}
+		if read {
+			resp := server.OK()
+			for _, r := range replies {
+				resp = append(resp, r.resp[1:]...)
+			}
+			return resp
+		}
+		var n int64
+		for _, r := range replies {
+			if len(r.resp) > 1 {
+				count, _ := strconv.ParseInt(r.resp[1], 10, 64)
+				n += count
+			}
+		}
+		return server.OK(strconv.FormatInt(n, 10))
+	}
+}
+
+// Run a range command on every shard and merge the items in order, the
+// limit is the last argument
+func (p *proxy) ranged(req *server.Request) []string {
+	cmd := shardcmd.Ranges[req.Cmd]
+	if len(req.Args) < 3 {
+		return server.ClientError("wrong number of arguments")
+	}
+	limit, err := strconv.Atoi(req.Args[len(req.Args)-1])
+	if err != nil {
+		return server.ClientError("invalid limit")
+	}
+	replies := p.fanout(p.shards(true), func(sc gossdb.ShardClient) []interface{} {
+		return args(req)
+	})
+	if resp := failed(replies); resp != nil {
+		return resp
+	}
+	var items [][]string
+	for _, r := range replies {
+		values := r.resp[1:]
+		for i := 0; i+cmd.Width <= len(values); i += cmd.Width {
+			items = append(items, values[i:i+cmd.Width])
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if cmd.Reverse {
+			return items[i][0] > items[j][0]
+		}
+		return items[i][0] < items[j][0]
+	})
+	if limit >= 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	resp := server.OK()
+	for _, item := range items {
+		resp = append(resp, item...)
+	}
+	return resp
+}
+
+// Sum the sizes of the shards
+func (p *proxy) dbsize(req *server.Request) []string {
+	replies := p.fanout(p.shards(false), func(sc gossdb.ShardClient) []interface{} {
+		return args(req)
+	})
+	if resp := failed(replies); resp != nil {
+		return resp
+	}
+	var n int64
+	for _, r := range replies {
+		if len(r.resp) > 1 {
+			size, _ := strconv.ParseInt(r.resp[1], 10, 64)
+			n += size
+		}
+	}
+	return server.OK(strconv.FormatInt(n, 10))
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bububa/gossdb"
+	"github.com/bububa/gossdb/server"
+	"github.com/bububa/gossdb/ssdbtest"
+)
+
+// Start n shards and a proxy in front of them, the client talks to the proxy
+func newTestProxy(t *testing.T, n int) ([]*ssdbtest.Server, *proxy, *gossdb.Client) {
+	t.Helper()
+	var (
+		shards []*ssdbtest.Server
+		addrs  []string
+	)
+	for i := 0; i < n; i++ {
+		s := ssdbtest.NewServer()
+		t.Cleanup(func() { s.Close() })
+		shards = append(shards, s)
+		addrs = append(addrs, s.Addr().String())
+	}
+	topology := gossdb.NewTopology(addrs)
+	cluster, err := gossdb.NewClusterFromTopology(topology)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cluster.Close() })
+	h, err := newHealth(topology, time.Second, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.close)
+
+	pools, err := newPools(topology, 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pools.close)
+
+	p := &proxy{cluster: cluster, pools: pools, health: h, stats: newStats()}
+	srv := server.NewServer()
+	p.register(srv)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+
+	c, err := gossdb.Connect(l.Addr().(*net.TCPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return shards, p, c
+}
+
+func TestKeyed(t *testing.T) {
+	_, p, c := newTestProxy(t, 3)
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if _, err := c.Set(key, key); err != nil {
+			t.Fatal(err)
+		}
+		// stored on the shard the cluster routes to
+		if v, err := p.cluster.Route(key, false).Client.Get(key); v != key || err != nil {
+			t.Fatalf("get %s on its shard = %v, %v", key, v, err)
+		}
+		if v, err := c.Get(key); v != key || err != nil {
+			t.Fatalf("get %s = %v, %v", key, v, err)
+		}
+	}
+	resp, err := c.Do(0, "flushdb")
+	if err != nil || len(resp) == 0 || resp[0] != "client_error" {
+		t.Fatalf("unsupported command = %q, %v", resp, err)
+	}
+}
+
+func TestMulti(t *testing.T) {
+	_, _, c := newTestProxy(t, 3)
+	var (
+		pairs []*gossdb.KVPair
+		keys  []string
+	)
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("k%02d", i)
+		pairs = append(pairs, gossdb.NewKVPair(key, key))
+		keys = append(keys, key)
+	}
+	if _, err := c.MultiSet(pairs...); err != nil {
+		t.Fatal(err)
+	}
+	m, err := c.MultiGetMap(append(keys, "missing")...)
+	if err != nil || len(m) != 20 || m["k07"] != "k07" {
+		t.Fatalf("multi_get = %v, %v", m, err)
+	}
+	resp, err := c.Do(0, "multi_del", "k00", "k01", "missing")
+	if err != nil || !reflect.DeepEqual(resp, []string{"ok", "3"}) {
+		t.Fatalf("multi_del = %q, %v", resp, err)
+	}
+}
+
+func TestRanged(t *testing.T) {
+	_, _, c := newTestProxy(t, 3)
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if _, err := c.Set(key, "v"+key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kvs, err := c.Scan("k2", "", 3)
+	want := [][2]string{{"k3", "vk3"}, {"k4", "vk4"}, {"k5", "vk5"}}
+	if err != nil || !reflect.DeepEqual(kvs, want) {
+		t.Fatalf("scan = %v, %v, want %v", kvs, err, want)
+	}
+	resp, err := c.Do(0, "rkeys", "", "", 3)
+	if err != nil || !reflect.DeepEqual(resp, []string{"ok", "k9", "k8", "k7"}) {
+		t.Fatalf("rkeys = %q, %v", resp, err)
+	}
+	resp, err = c.Do(0, "dbsize")
+	if err != nil || len(resp) != 2 || resp[1] == "0" {
+		t.Fatalf("dbsize = %q, %v", resp, err)
+	}
+}
+
+// A slow command holds one connection to its shard, not the others
+func TestSlowCommand(t *testing.T) {
+	shards, _, c := newTestProxy(t, 1)
+	addr, err := net.ResolveTCPAddr("tcp", c.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := gossdb.Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	shards[0].InjectFault(ssdbtest.Fault{Kind: ssdbtest.FaultSlowReply, Delay: time.Second}, 1)
+	slow := make(chan error)
+	go func() {
+		_, err := c.Get("slow")
+		slow <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	if _, err := other.Set("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("set took %v behind a slow command", d)
+	}
+	if err := <-slow; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnavailable(t *testing.T) {
+	shards, p, c := newTestProxy(t, 2)
+	down := shards[0].Addr().String()
+	shards[0].Close()
+	p.health.check()
+	if p.health.up(down) {
+		t.Fatal("closed shard still up")
+	}
+	var key string
+	for i := 0; key == ""; i++ {
+		if k := fmt.Sprintf("k%d", i); p.cluster.Route(k, false).Client.Addr() == down {
+			key = k
+		}
+	}
+	resp, err := c.Do(0, "get", key)
+	if err != nil || len(resp) != 2 || resp[0] != "error" || !strings.Contains(resp[1], "unavailable") {
+		t.Fatalf("get on a down shard = %q, %v", resp, err)
+	}
+	resp, err = c.Do(0, "scan", "", "", 10)
+	if err != nil || len(resp) == 0 || resp[0] != "error" {
+		t.Fatalf("scan with a down shard = %q, %v", resp, err)
+	}
+}
+
+func TestHealthUpdate(t *testing.T) {
+	shards, p, _ := newTestProxy(t, 2)
+	kept := shards[1].Addr().String()
+	shards[0].Close()
+	p.health.check()
+
+	extra := ssdbtest.NewServer()
+	defer extra.Close()
+	topology := gossdb.NewTopology([]string{kept, extra.Addr().String()})
+	if err := p.pools.update(topology); err != nil {
+		t.Fatal(err)
+	}
+	if p.pools.get(shards[0].Addr().String()) != nil || p.pools.get(extra.Addr().String()) == nil {
+		t.Fatal("pools not switched to the new topology")
+	}
+	if err := p.cluster.UpdateTopology(topology); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.health.update(topology); err != nil {
+		t.Fatal(err)
+	}
+	status := p.health.status()
+	if len(status) != 2 {
+		t.Fatalf("status = %+v, want the servers of the new topology", status)
+	}
+	for _, n := range status {
+		if n.Addr == kept && n.LastCheck.IsZero() {
+			t.Fatalf("state of %s lost on update", kept)
+		}
+		if n.Addr == extra.Addr().String() && !n.Up {
+			t.Fatalf("new server down before its first check")
+		}
+	}
+	p.health.check()
+	for _, n := range p.health.status() {
+		if !n.Up {
+			t.Fatalf("%s down after update: %s", n.Addr, n.LastError)
+		}
+	}
+}
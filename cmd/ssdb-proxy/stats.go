@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bububa/gossdb"
+	"github.com/bububa/gossdb/server"
+)
+
+type counter struct {
+	Calls  uint64 `json:"calls"`
+	Errors uint64 `json:"errors"`
+}
+
+// stats counts the commands of the clients and the requests sent to each
+// shard
+type stats struct {
+	mutex    sync.Mutex
+	started  time.Time
+	commands map[string]*counter
+	shards   map[string]*counter
+}
+
+func newStats() *stats {
+	return &stats{
+		started:  time.Now(),
+		commands: make(map[string]*counter),
+		shards:   make(map[string]*counter),
+	}
+}
+
+func (s *stats) command(cmd string, resp []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	c, found := s.commands[cmd]
+	if !found {
+		c = &counter{}
+		s.commands[cmd] = c
+	}
+	c.Calls++
+	if len(resp) == 0 || (resp[0] != "ok" && resp[0] != "not_found") {
+		c.Errors++
+	}
+}
+
+func (s *stats) shard(name string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	c, found := s.shards[name]
+	if !found {
+		c = &counter{}
+		s.shards[name] = c
+	}
+	c.Calls++
+	if err != nil {
+		c.Errors++
+	}
+}
+
+// count wraps a handler to record its replies
+func (s *stats) count(fn server.HandlerFunc) server.HandlerFunc {
+	return func(req *server.Request) []string {
+		resp := fn(req)
+		s.command(req.Cmd, resp)
+		return resp
+	}
+}
+
+// statsHandler serves /stats, /health and the Prometheus metrics of the
+// shard clients on /metrics
+func statsHandler(p *proxy, metrics *gossdb.PrometheusMetrics) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		p.stats.mutex.Lock()
+		body, err := json.MarshalIndent(map[string]interface{}{
+			"uptime_seconds": int64(time.Since(p.stats.started).Seconds()),
+			"commands":       p.stats.commands,
+			"shards":         p.stats.shards,
+			"slowlog":        p.cluster.SlowLog(),
+		}, "", "  ")
+		p.stats.mutex.Unlock()
+		writeJSON(w, http.StatusOK, body, err)
+	})
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		nodes := p.health.status()
+		code := http.StatusOK
+		for _, n := range nodes {
+			if n.Master && !n.Up {
+				code = http.StatusServiceUnavailable
+			}
+		}
+		body, err := json.MarshalIndent(nodes, "", "  ")
+		writeJSON(w, code, body, err)
+	})
+	mux.Handle("/metrics", metrics)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, code int, body []byte, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(body)
+}
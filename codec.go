@@ -0,0 +1,199 @@
+package gossdb
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+)
+
+// Codec marshals the values of the typed helpers such as GetAs and SetAs
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// CodecFuncs makes a Codec of two functions, to plug protobuf or msgpack
+// without this package depending on them:
+//
+//	codec := gossdb.CodecFuncs{
+//		MarshalFunc: func(v interface{}) ([]byte, error) {
+//			return proto.Marshal(v.(proto.Message))
+//		},
+//		UnmarshalFunc: func(data []byte, v interface{}) error {
+//			return proto.Unmarshal(data, v.(proto.Message))
+//		},
+//	}
+type CodecFuncs struct {
+	MarshalFunc   func(v interface{}) ([]byte, error)
+	UnmarshalFunc func(data []byte, v interface{}) error
+}
+
+func (f CodecFuncs) Marshal(v interface{}) ([]byte, error) {
+	return f.MarshalFunc(v)
+}
+
+func (f CodecFuncs) Unmarshal(data []byte, v interface{}) error {
+	return f.UnmarshalFunc(data, v)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+var (
+	JSONCodec Codec = jsonCodec{}
+	// GobCodec stores every value with its gob type description, it suits
+	// Go only consumers
+	GobCodec Codec = gobCodec{}
+	// DefaultCodec is used when no codec was set with SetCodec
+	DefaultCodec = JSONCodec
+)
+
+// ErrNotFound is returned by the typed helpers for a missing key or field
+var ErrNotFound = fmt.Errorf("not found")
+
+// The codec set on c with SetCodec, DefaultCodec otherwise
+func codecOf(c interface{}) Codec {
+	if cc, ok := c.(interface{ Codec() Codec }); ok {
+		if codec := cc.Codec(); codec != nil {
+			return codec
+		}
+	}
+	return DefaultCodec
+}
+
+func marshal(c interface{}, v interface{}) (string, error) {
+	data, err := codecOf(c).Marshal(v)
+	return string(data), err
+}
+
+// Decode a value read by a command, nil when it was not found
+func unmarshal[T any](c interface{}, val interface{}) (T, error) {
+	var v T
+	if val == nil {
+		return v, ErrNotFound
+	}
+	s, ok := val.(string)
+	if !ok {
+		s = fmt.Sprint(val)
+	}
+	err := codecOf(c).Unmarshal([]byte(s), &v)
+	return v, err
+}
+
+// GetAs reads and decodes the value of key, ErrNotFound when it is missing
+func GetAs[T any](c KV, key string) (T, error) {
+	val, err := c.Get(key)
+	if err != nil {
+		var v T
+		return v, err
+	}
+	return unmarshal[T](c, val)
+}
+
+// SetAs encodes v with the codec of c and stores it at key
+func SetAs[T any](c KV, key string, v T) (bool, error) {
+	val, err := marshal(c, v)
+	if err != nil {
+		return false, err
+	}
+	return c.Set(key, val)
+}
+
+// SetxAs is SetAs with a ttl in seconds
+func SetxAs[T any](c KV, key string, v T, ttl int32) (bool, error) {
+	val, err := marshal(c, v)
+	if err != nil {
+		return false, err
+	}
+	return c.Setx(key, val, ttl)
+}
+
+// MultiGetAs reads and decodes several keys, the missing ones are not in
+// the map
+func MultiGetAs[T any](c KV, ks ...string) (map[string]T, error) {
+	pairs, err := c.MultiGet(ks...)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]T, len(pairs))
+	for _, p := range pairs {
+		v, err := unmarshal[T](c, p.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", p.Key, err)
+		}
+		res[p.Key] = v
+	}
+	return res, nil
+}
+
+// MultiSetAs encodes and stores several values
+func MultiSetAs[T any](c KV, values map[string]T) (bool, error) {
+	pairs := make([]*KVPair, 0, len(values))
+	for k, v := range values {
+		val, err := marshal(c, v)
+		if err != nil {
+			return false, fmt.Errorf("%s: %v", k, err)
+		}
+		pairs = append(pairs, NewKVPair(k, val))
+	}
+	return c.MultiSet(pairs...)
+}
+
+// HGetAs reads and decodes a field of a hash, ErrNotFound when it is missing
+func HGetAs[T any](c Hash, key, field string) (T, error) {
+	val, err := c.HGet(key, field)
+	if err != nil {
+		var v T
+		return v, err
+	}
+	return unmarshal[T](c, val)
+}
+
+// HSetAs encodes v with the codec of c and stores it in a field of a hash
+func HSetAs[T any](c Hash, key, field string, v T) (bool, error) {
+	val, err := marshal(c, v)
+	if err != nil {
+		return false, err
+	}
+	return c.HSet(key, field, val)
+}
+
+// MultiHGetAs reads and decodes several fields of a hash, the missing ones
+// are not in the map
+func MultiHGetAs[T any](c Hash, key string, fields ...string) (map[string]T, error) {
+	fvMap, err := c.MultiHGet(key, fields)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]T, len(fvMap))
+	for f, val := range fvMap {
+		v, err := unmarshal[T](c, val)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f, err)
+		}
+		res[f] = v
+	}
+	return res, nil
+}
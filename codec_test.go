@@ -0,0 +1,114 @@
+package gossdb_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bububa/gossdb"
+)
+
+type user struct {
+	Name string
+	Age  int
+	Tags []string
+}
+
+func TestTypedHelpers(t *testing.T) {
+	_, c := newTestClient(t)
+	alice := user{Name: "alice", Age: 30, Tags: []string{"a"}}
+	if _, err := gossdb.SetAs(c, "u:1", alice); err != nil {
+		t.Fatal(err)
+	}
+	// the default codec is JSON
+	if v, _ := c.Get("u:1"); v != `{"Name":"alice","Age":30,"Tags":["a"]}` {
+		t.Fatalf("stored %v", v)
+	}
+	if u, err := gossdb.GetAs[user](c, "u:1"); err != nil || !reflect.DeepEqual(u, alice) {
+		t.Fatalf("get = %+v, %v", u, err)
+	}
+	if _, err := gossdb.GetAs[user](c, "missing"); err != gossdb.ErrNotFound {
+		t.Fatalf("get missing error = %v, want %v", err, gossdb.ErrNotFound)
+	}
+
+	if _, err := gossdb.MultiSetAs(c, map[string]int{"n:1": 1, "n:2": 2}); err != nil {
+		t.Fatal(err)
+	}
+	m, err := gossdb.MultiGetAs[int](c, "n:1", "n:2", "missing")
+	if err != nil || !reflect.DeepEqual(m, map[string]int{"n:1": 1, "n:2": 2}) {
+		t.Fatalf("multi_get = %v, %v", m, err)
+	}
+	if _, err := c.Set("bad", "{"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gossdb.MultiGetAs[int](c, "n:1", "bad"); err == nil || !strings.HasPrefix(err.Error(), "bad:") {
+		t.Fatalf("decode error = %v, want it to name the key", err)
+	}
+
+	if _, err := gossdb.HSetAs(c, "h", "f", []float64{1.5}); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := gossdb.HGetAs[[]float64](c, "h", "f"); err != nil || !reflect.DeepEqual(v, []float64{1.5}) {
+		t.Fatalf("hget = %v, %v", v, err)
+	}
+	if _, err := gossdb.HGetAs[int](c, "h", "missing"); err != gossdb.ErrNotFound {
+		t.Fatalf("hget missing error = %v", err)
+	}
+	fields, err := gossdb.MultiHGetAs[[]float64](c, "h", "f", "missing")
+	if err != nil || len(fields) != 1 {
+		t.Fatalf("multi_hget = %v, %v", fields, err)
+	}
+}
+
+func TestSetCodec(t *testing.T) {
+	_, c := newTestClient(t)
+	c.SetCodec(gossdb.GobCodec)
+	alice := user{Name: "alice", Age: 30}
+	if _, err := gossdb.SetxAs(c, "u", alice, 100); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := c.Get("u"); strings.HasPrefix(v.(string), "{") {
+		t.Fatalf("stored %q with JSON, want gob", v)
+	}
+	// a namespace uses the codec of its client
+	if c.Namespace("x:").Codec() != gossdb.GobCodec {
+		t.Fatal("namespace codec differs from the client")
+	}
+	if u, err := gossdb.GetAs[user](c, "u"); err != nil || u.Name != "alice" || u.Age != 30 {
+		t.Fatalf("get = %+v, %v", u, err)
+	}
+
+	errCodec := errors.New("codec")
+	c.SetCodec(gossdb.CodecFuncs{
+		MarshalFunc: func(v interface{}) ([]byte, error) {
+			return nil, errCodec
+		},
+		UnmarshalFunc: func(data []byte, v interface{}) error {
+			*v.(*string) = "decoded " + string(data)
+			return nil
+		},
+	})
+	if _, err := gossdb.SetAs(c, "k", 1); err != errCodec {
+		t.Fatalf("set error = %v, want %v", err, errCodec)
+	}
+	if _, err := c.Set("k", "raw"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := gossdb.GetAs[string](c, "k"); v != "decoded raw" || err != nil {
+		t.Fatalf("get = %q, %v", v, err)
+	}
+}
+
+func TestClusterCodec(t *testing.T) {
+	_, c := newTestCluster(t, 2)
+	c.SetCodec(gossdb.GobCodec)
+	values := map[string]user{"a": {Name: "a"}, "b": {Name: "b"}, "c": {Name: "c"}}
+	if _, err := gossdb.MultiSetAs(c, values); err != nil {
+		t.Fatal(err)
+	}
+	m, err := gossdb.MultiGetAs[user](c, "a", "b", "c")
+	if err != nil || !reflect.DeepEqual(m, values) {
+		t.Fatalf("multi_get = %v, %v", m, err)
+	}
+}
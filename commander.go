@@ -0,0 +1,100 @@
+package gossdb
+
+// KV is the set of Key-Value commands
+type KV interface {
+	Set(key string, val string) (bool, error)
+	Setx(key string, val string, ttl int32) (bool, error)
+	Setnx(key string, val string) (bool, error)
+	Get(key string) (interface{}, error)
+	Getset(key string, val string) (interface{}, error)
+	Del(key string) (bool, error)
+	MultiSet(pairs ...*KVPair) (bool, error)
+	MultiGet(ks ...string) ([]*KVPair, error)
+	MultiGetOrdered(ks ...string) ([]*KVResult, error)
+	MultiGetMap(ks ...string) (map[string]interface{}, error)
+	MultiDel(ks ...string) (bool, error)
+	Scan(startKey string, endKey string, limit int) ([][2]string, error)
+	Exists(key string) (bool, error)
+	Expire(key string, ttl int) (int, error)
+	TTL(key string) (int64, error)
+	Incr(key string, num int) (int64, error)
+	Decr(key string, num int) (int64, error)
+}
+
+// Hash is the set of Key-Map commands
+type Hash interface {
+	HSet(key, field, val string) (bool, error)
+	HGet(key, field string) (interface{}, error)
+	HDel(key, field string) (bool, error)
+	HIncr(key, field string, num int) (int64, error)
+	HDecr(key, field string, num int) (int64, error)
+	HExists(key, field string) (bool, error)
+	HSize(key string) (int64, error)
+	HList(startKey, endKey string, limit int) ([]string, error)
+	HKeys(key, startField, endField string, limit int) ([]string, error)
+	HScan(key, startField, endField string, limit int) ([][2]string, error)
+	HRScan(key, startField, endField string, limit int) ([][2]string, error)
+	HClear(key string) (bool, error)
+	MultiHSet(key string, fvMap map[string]string) (bool, error)
+	MultiHGet(key string, fieldList []string) (map[string]string, error)
+	MultiHDel(key string, fieldList []string) (bool, error)
+}
+
+// ZSet is the set of Key-Zset commands
+type ZSet interface {
+	ZSet(key, ele string, score int) (bool, error)
+	ZGet(key, ele string) (interface{}, error)
+	ZDel(key, ele string) (bool, error)
+	ZIncr(key, ele string, num int) (int64, error)
+	ZSize(key string) (int64, error)
+	ZExists(key, ele string) (bool, error)
+	ZList(startKey, endKey string, limit int) ([]string, error)
+	ZKeys(key, startEle string, scoreStart, scoreEnd, limit int) ([]string, error)
+	ZScan(key, startEle string, scoreStart, scoreEnd, limit int) (map[string]int64, error)
+	ZRScan(key, startEle string, scoreStart, scoreEnd, limit int) (map[string]int64, error)
+	ZRank(key, ele string) (int64, error)
+	ZRRank(key, ele string) (int64, error)
+	ZRange(key string, offset, limit int) ([][2]interface{}, error)
+	ZRRange(key string, offset, limit int) ([][2]interface{}, error)
+	ZClear(key string) (bool, error)
+	MultiZSet(key string, esMap map[string]int) (bool, error)
+	MultiZGet(key string, eleList []string) (map[string]int64, error)
+	MultiZDel(key string, eleList []string) (bool, error)
+}
+
+// Queue is the set of Key-List/Queue commands
+type Queue interface {
+	QSize(key string) (int64, error)
+	QClear(key string) (bool, error)
+	QFront(key string) (string, error)
+	QBack(key string) (string, error)
+	QGet(key string, index int) (interface{}, error)
+	QSlice(key string, begin, end int) ([]string, error)
+	QList(startKey, endKey string, limit int) ([]string, error)
+	QPush(key, item string) (bool, error)
+	QPushFront(key, item string) (bool, error)
+	QPushBack(key, item string) (bool, error)
+	QPop(key string) (interface{}, error)
+	QPopFront(key string) (interface{}, error)
+	QPopBack(key string) (interface{}, error)
+}
+
+// Commander is implemented by Client, Cluster and Pool so application code
+// can be written once and run against any topology
+type Commander interface {
+	KV
+	Hash
+	ZSet
+	Queue
+	Close() error
+}
+
+var (
+	_ Commander = (*Client)(nil)
+	_ Commander = (*Cluster)(nil)
+	_ Commander = (*Pool)(nil)
+	_ Commander = (*Namespace)(nil)
+	_ Commander = (*Compressor)(nil)
+	_ Commander = (*Encryptor)(nil)
+	_ Commander = (*NearCache)(nil)
+)
@@ -0,0 +1,153 @@
+package gossdb
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// ErrDecompress is returned when a value marked as compressed does not
+// decompress
+var ErrDecompress = fmt.Errorf("decompression failed")
+
+// Compression is the format of a compressed value, it is stored as the
+// first byte of the value
+type Compression byte
+
+const (
+	Gzip Compression = 0x01
+	Zlib Compression = 0x02
+)
+
+// rawMarker starts the values stored uncompressed
+const rawMarker = "\x00"
+
+// DefaultCompressThreshold is the size from which values are compressed
+const DefaultCompressThreshold = 1024
+
+// Compressor compresses the values of the KV and hash commands from a size
+// threshold. Every value it writes starts with a marker byte: the format
+// of a compressed value, or 0x00 for a value stored as it is. A value
+// marked as compressed that does not decompress is an error. Values without
+// a marker are read back as they are, so it can be enabled on existing data
+// whose values do not start with 0x00, 0x01 or 0x02.
+type Compressor struct {
+	*valueFilter
+	format    Compression
+	mutex     sync.RWMutex
+	threshold int
+	level     int
+	// writers of the current level, replaced when it changes
+	writers *sync.Pool
+}
+
+type compressWriter interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+func NewCompressor(c Commander, format Compression) *Compressor {
+	z := &Compressor{format: format, threshold: DefaultCompressThreshold, level: flate.DefaultCompression, writers: &sync.Pool{}}
+	z.valueFilter = &valueFilter{Commander: c, encode: z.compress, decode: z.decompress}
+	return z
+}
+
+// SetThreshold sets the size from which values are compressed,
+// DefaultCompressThreshold by default
+func (z *Compressor) SetThreshold(n int) {
+	z.mutex.Lock()
+	defer z.mutex.Unlock()
+	z.threshold = n
+}
+
+// SetLevel sets the level of compress/flate, from flate.BestSpeed to
+// flate.BestCompression
+func (z *Compressor) SetLevel(level int) error {
+	if _, err := flate.NewWriter(nil, level); err != nil {
+		return err
+	}
+	z.mutex.Lock()
+	defer z.mutex.Unlock()
+	z.level = level
+	// the writers in use go back to the pool of their level
+	z.writers = &sync.Pool{}
+	return nil
+}
+
+func (z *Compressor) writer(w io.Writer, level int, writers *sync.Pool) (compressWriter, error) {
+	if cw, ok := writers.Get().(compressWriter); ok {
+		cw.Reset(w)
+		return cw, nil
+	}
+	if z.format == Zlib {
+		return zlib.NewWriterLevel(w, level)
+	}
+	return gzip.NewWriterLevel(w, level)
+}
+
+// Values that do not shrink are stored uncompressed
+func (z *Compressor) compress(v string) (string, error) {
+	z.mutex.RLock()
+	threshold, level, writers := z.threshold, z.level, z.writers
+	z.mutex.RUnlock()
+	if len(v) < threshold {
+		return rawMarker + v, nil
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(byte(z.format))
+	w, err := z.writer(&buf, level, writers)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.WriteString(w, v); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	writers.Put(w)
+	if buf.Len() > len(v) {
+		return rawMarker + v, nil
+	}
+	return buf.String(), nil
+}
+
+// Values without a marker are returned as they are, values larger than
+// MAX_REPLY_SIZE once decompressed are rejected with ErrReplyTooLarge
+func (z *Compressor) decompress(v string) (string, error) {
+	if len(v) == 0 {
+		return v, nil
+	}
+	if strings.HasPrefix(v, rawMarker) {
+		return v[1:], nil
+	}
+	var (
+		r   io.ReadCloser
+		err error
+	)
+	switch Compression(v[0]) {
+	case Gzip:
+		r, err = gzip.NewReader(strings.NewReader(v[1:]))
+	case Zlib:
+		r, err = zlib.NewReader(strings.NewReader(v[1:]))
+	default:
+		return v, nil
+	}
+	if err != nil {
+		return "", ErrDecompress
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, MAX_REPLY_SIZE+1))
+	if err != nil {
+		return "", ErrDecompress
+	}
+	if len(data) > MAX_REPLY_SIZE {
+		return "", ErrReplyTooLarge
+	}
+	return string(data), nil
+}
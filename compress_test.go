@@ -0,0 +1,212 @@
+package gossdb_test
+
+import (
+	"compress/flate"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bububa/gossdb"
+)
+
+func TestCompressorThreshold(t *testing.T) {
+	_, c := newTestClient(t)
+	z := gossdb.NewCompressor(c, gossdb.Gzip)
+	large := strings.Repeat("compressible ", 200)
+	random := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(random)
+	values := map[string]string{
+		"small":  "small value",
+		"large":  large,
+		"random": string(random),
+	}
+	for k, v := range values {
+		if _, err := z.Set(k, v); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := z.Get(k); got != v || err != nil {
+			t.Fatalf("get %s through the compressor = %.20q, %v", k, got, err)
+		}
+	}
+	stored := func(k string) string {
+		v, _ := c.Get(k)
+		return v.(string)
+	}
+	if stored("small") != "\x00"+values["small"] {
+		t.Fatalf("value under the threshold stored as %q", stored("small"))
+	}
+	if s := stored("large"); s[0] != byte(gossdb.Gzip) || len(s) >= len(large) {
+		t.Fatalf("large value stored in %d bytes, want it compressed", len(s))
+	}
+	// values that do not shrink are stored as they are
+	if stored("random") != "\x00"+values["random"] {
+		t.Fatal("incompressible value stored compressed")
+	}
+
+	z.SetThreshold(len(large) + 1)
+	if _, err := z.Set("large", large); err != nil {
+		t.Fatal(err)
+	}
+	if stored("large") != "\x00"+large {
+		t.Fatal("value under the raised threshold compressed")
+	}
+}
+
+func TestCompressorLegacyValues(t *testing.T) {
+	_, c := newTestClient(t)
+	z := gossdb.NewCompressor(c, gossdb.Zlib)
+	// written before the compressor
+	legacy := map[string]string{
+		"plain": "plain value",
+		"empty": "",
+		"json":  `{"a":1}`,
+	}
+	for k, v := range legacy {
+		if _, err := c.Set(k, v); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.HSet("h", k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for k, v := range legacy {
+		if got, err := z.Get(k); got != v || err != nil {
+			t.Errorf("get %s = %q, %v", k, got, err)
+		}
+		if got, err := z.HGet("h", k); got != v || err != nil {
+			t.Errorf("hget %s = %q, %v", k, got, err)
+		}
+	}
+	kvs, err := z.Scan("", "", -1)
+	if err != nil || len(kvs) != len(legacy) {
+		t.Fatalf("scan = %q, %v", kvs, err)
+	}
+	for _, kv := range kvs {
+		if kv[1] != legacy[kv[0]] {
+			t.Errorf("scan %s = %q", kv[0], kv[1])
+		}
+	}
+}
+
+// User data starting with a format byte is not mistaken for a compressed
+// value, a damaged compressed value is an error
+func TestCompressorMarkers(t *testing.T) {
+	_, c := newTestClient(t)
+	z := gossdb.NewCompressor(c, gossdb.Gzip)
+	for _, v := range []string{"\x01not a gzip stream", "\x02x\x9c", "\x00", "\x01"} {
+		if _, err := z.Set("k", v); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := z.Get("k"); got != v || err != nil {
+			t.Errorf("get of %q = %q, %v", v, got, err)
+		}
+	}
+
+	large := strings.Repeat("damaged ", 200)
+	if _, err := z.Set("k", large); err != nil {
+		t.Fatal(err)
+	}
+	v, _ := c.Get("k")
+	stored := v.(string)
+	damaged := map[string]string{
+		"checksum":  stored[:len(stored)-5] + "\xff" + stored[len(stored)-4:],
+		"truncated": stored[:len(stored)/2],
+		"header":    "\x01not a gzip stream",
+		"zlib":      "\x02x\x9c broken",
+	}
+	for name, s := range damaged {
+		if _, err := c.Set("k", s); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := z.Get("k"); err != gossdb.ErrDecompress {
+			t.Errorf("%s: get = %.20q, %v, want %v", name, got, err, gossdb.ErrDecompress)
+		}
+	}
+}
+
+func TestCompressorLevel(t *testing.T) {
+	_, c := newTestClient(t)
+	z := gossdb.NewCompressor(c, gossdb.Zlib)
+	if err := z.SetLevel(42); err == nil {
+		t.Fatal("level 42 accepted")
+	}
+	large := strings.Repeat("level ", 500)
+	for _, level := range []int{flate.BestSpeed, flate.BestCompression} {
+		if err := z.SetLevel(level); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := z.MultiHSet("h", map[string]string{"f": large}); err != nil {
+			t.Fatal(err)
+		}
+		if m, err := z.MultiHGet("h", []string{"f"}); m["f"] != large || err != nil {
+			t.Fatalf("multi_hget at level %d = %.20q, %v", level, m["f"], err)
+		}
+	}
+}
+
+// The settings may change while values are compressed
+func TestCompressorConcurrentSettings(t *testing.T) {
+	_, c := newTestClient(t)
+	z := gossdb.NewCompressor(c, gossdb.Gzip)
+	large := strings.Repeat("concurrent ", 200)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				key := fmt.Sprintf("k%d", i)
+				if _, err := z.Set(key, large); err != nil {
+					t.Error(err)
+					return
+				}
+				if v, err := z.Get(key); v != large || err != nil {
+					t.Errorf("get %s = %.20q, %v", key, v, err)
+					return
+				}
+			}
+		}(i)
+	}
+	for j := 0; j < 20; j++ {
+		z.SetLevel(flate.BestSpeed + j%9)
+		z.SetThreshold(100 * (j % 3))
+	}
+	wg.Wait()
+}
+
+// The pairs of the healthy shards are decoded and returned with the error
+func TestCompressorPartialFailure(t *testing.T) {
+	servers, c := newTestCluster(t, 2)
+	z := gossdb.NewCompressor(c, gossdb.Gzip)
+	large := strings.Repeat("partial ", 200)
+	var keys []string
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if _, err := z.Set(key, large); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+	up := onShard(c, servers[0], keys...)
+	servers[1].Close()
+
+	var merr gossdb.MultiError
+	pairs, err := z.MultiGet(keys...)
+	if !errors.As(err, &merr) || len(pairs) != len(up) {
+		t.Fatalf("multi_get = %d pairs, %v, want %d pairs and a MultiError", len(pairs), err, len(up))
+	}
+	for _, p := range pairs {
+		if p.Value != large {
+			t.Fatalf("pair %s = %.20q, want it decompressed", p.Key, p.Value)
+		}
+	}
+	if m, err := z.MultiGetMap(keys...); !errors.As(err, &merr) || len(m) != len(up) {
+		t.Fatalf("multi_get map = %d values, %v", len(m), err)
+	}
+	if results, err := z.MultiGetOrdered(keys...); !errors.As(err, &merr) || len(results) != len(keys) {
+		t.Fatalf("ordered multi_get = %d results, %v", len(results), err)
+	}
+}
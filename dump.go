@@ -0,0 +1,489 @@
+package gossdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// A dump starts with the magic and the version, then one record per KV,
+// hash field, zset member or queue item and an end record with the number
+// of records. Every record is kind | uvarint size | payload | crc32.
+const (
+	dumpMagic = "GSDB"
+	// DumpVersion is the version of the dump format written by Dump
+	DumpVersion = 1
+	// Number of items fetched or written per command
+	dumpBatch = 100
+)
+
+// Kinds of dump records
+const (
+	DumpKV    byte = 'k'
+	DumpHash  byte = 'h'
+	DumpZSet  byte = 'z'
+	DumpQueue byte = 'q'
+	dumpEnd   byte = 'E'
+)
+
+var (
+	ErrBadDump       = fmt.Errorf("dump: unknown format or version")
+	ErrDumpCorrupted = fmt.Errorf("dump: checksum mismatch")
+	ErrDumpTruncated = fmt.Errorf("dump: truncated")
+)
+
+// DumpRecord is one entry of a dump
+type DumpRecord struct {
+	Kind byte
+	// Name is the key of a KV or the name of a hash, zset or queue
+	Name string
+	// Field is the hash field or the zset member
+	Field string
+	// Value of a KV, hash field or queue item
+	Value string
+	Score int64
+	// TTL of a KV in seconds, -1 when it does not expire
+	TTL int64
+}
+
+func (c *Client) Dump(w io.Writer) error {
+	return Dump(c, w)
+}
+
+func (c *Client) Restore(r io.Reader) error {
+	return Restore(c, r)
+}
+
+func (c *Cluster) Dump(w io.Writer) error {
+	return Dump(c, w)
+}
+
+func (c *Cluster) Restore(r io.Reader) error {
+	return Restore(c, r)
+}
+
+func (p *Pool) Dump(w io.Writer) error {
+	return Dump(p, w)
+}
+
+func (p *Pool) Restore(r io.Reader) error {
+	return Restore(p, r)
+}
+
+// Dump writes every KV with its ttl, hash, zset and queue of c to w. The
+// data is read with the scan commands while it may change, so a dump is
+// not a snapshot. It stops at the first error of w.
+func Dump(c Commander, w io.Writer) error {
+	d := &dumpWriter{w: bufio.NewWriter(w)}
+	d.w.WriteString(dumpMagic)
+	d.w.WriteByte(DumpVersion)
+	if err := dumpKV(c, d); err != nil {
+		return err
+	}
+	if err := dumpNames(c.HList, func(name string) error { return dumpHash(c, d, name) }); err != nil {
+		return err
+	}
+	if err := dumpNames(c.ZList, func(name string) error { return dumpZSet(c, d, name) }); err != nil {
+		return err
+	}
+	if err := dumpNames(c.QList, func(name string) error { return dumpQueue(c, d, name) }); err != nil {
+		return err
+	}
+	if err := d.end(); err != nil {
+		return err
+	}
+	return d.w.Flush()
+}
+
+func dumpKV(c Commander, d *dumpWriter) error {
+	start := ""
+	for {
+		kvList, err := c.Scan(start, "", dumpBatch)
+		if err != nil {
+			return err
+		}
+		for _, kv := range kvList {
+			ttl, err := c.TTL(kv[0])
+			if err != nil {
+				return err
+			}
+			if err := d.record(&DumpRecord{Kind: DumpKV, Name: kv[0], Value: kv[1], TTL: ttl}); err != nil {
+				return err
+			}
+		}
+		if len(kvList) < dumpBatch {
+			return nil
+		}
+		start = kvList[len(kvList)-1][0]
+	}
+}
+
+// Call fn on every name returned by the list command
+func dumpNames(list func(startKey, endKey string, limit int) ([]string, error), fn func(name string) error) error {
+	start := ""
+	for {
+		names, err := list(start, "", dumpBatch)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if err := fn(name); err != nil {
+				return err
+			}
+		}
+		if len(names) < dumpBatch {
+			return nil
+		}
+		start = names[len(names)-1]
+	}
+}
+
+func dumpHash(c Commander, d *dumpWriter, name string) error {
+	start := ""
+	for {
+		fvList, err := c.HScan(name, start, "", dumpBatch)
+		if err != nil {
+			return err
+		}
+		for _, fv := range fvList {
+			if err := d.record(&DumpRecord{Kind: DumpHash, Name: name, Field: fv[0], Value: fv[1]}); err != nil {
+				return err
+			}
+		}
+		if len(fvList) < dumpBatch {
+			return nil
+		}
+		start = fvList[len(fvList)-1][0]
+	}
+}
+
+func dumpZSet(c Commander, d *dumpWriter, name string) error {
+	start, score := "", math.MinInt
+	for {
+		esMap, err := c.ZScan(name, start, score, math.MaxInt, dumpBatch)
+		if err != nil {
+			return err
+		}
+		// the reply is a map, sort it back in score order to resume after
+		// the last member
+		entries := make([]DumpRecord, 0, len(esMap))
+		for member, s := range esMap {
+			entries = append(entries, DumpRecord{Kind: DumpZSet, Name: name, Field: member, Score: s})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].Score != entries[j].Score {
+				return entries[i].Score < entries[j].Score
+			}
+			return entries[i].Field < entries[j].Field
+		})
+		for i := range entries {
+			if err := d.record(&entries[i]); err != nil {
+				return err
+			}
+		}
+		if len(entries) < dumpBatch {
+			return nil
+		}
+		last := entries[len(entries)-1]
+		start, score = last.Field, int(last.Score)
+	}
+}
+
+func dumpQueue(c Commander, d *dumpWriter, name string) error {
+	size, err := c.QSize(name)
+	if err != nil {
+		return err
+	}
+	for i := 0; int64(i) < size; i += dumpBatch {
+		items, err := c.QSlice(name, i, i+dumpBatch-1)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := d.record(&DumpRecord{Kind: DumpQueue, Name: name, Value: item}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type dumpWriter struct {
+	w     *bufio.Writer
+	count uint64
+	buf   []byte
+	// err is the first error of w, the records after it are dropped
+	err error
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func (d *dumpWriter) record(r *DumpRecord) error {
+	payload := appendString(d.buf[:0], r.Name)
+	switch r.Kind {
+	case DumpKV:
+		payload = appendString(payload, r.Value)
+		payload = binary.AppendVarint(payload, r.TTL)
+	case DumpHash:
+		payload = appendString(payload, r.Field)
+		payload = appendString(payload, r.Value)
+	case DumpZSet:
+		payload = appendString(payload, r.Field)
+		payload = binary.AppendVarint(payload, r.Score)
+	case DumpQueue:
+		payload = appendString(payload, r.Value)
+	}
+	d.count++
+	return d.write(r.Kind, payload)
+}
+
+func (d *dumpWriter) end() error {
+	return d.write(dumpEnd, binary.AppendUvarint(d.buf[:0], d.count))
+}
+
+func (d *dumpWriter) write(kind byte, payload []byte) error {
+	d.buf = payload
+	if d.err != nil {
+		return d.err
+	}
+	var head [1 + binary.MaxVarintLen64]byte
+	head[0] = kind
+	n := binary.PutUvarint(head[1:], uint64(len(payload)))
+	crc := crc32.ChecksumIEEE(head[:1])
+	crc = crc32.Update(crc, crc32.IEEETable, payload)
+	var tail [4]byte
+	binary.BigEndian.PutUint32(tail[:], crc)
+	for _, b := range [][]byte{head[:1+n], payload, tail[:]} {
+		if _, err := d.w.Write(b); err != nil {
+			d.err = err
+			return err
+		}
+	}
+	return nil
+}
+
+// DumpReader reads the records of a dump one by one
+type DumpReader struct {
+	r     *bufio.Reader
+	count uint64
+	done  bool
+}
+
+// NewDumpReader checks the header of a dump
+func NewDumpReader(r io.Reader) (*DumpReader, error) {
+	br := bufio.NewReader(r)
+	head := make([]byte, len(dumpMagic)+1)
+	if _, err := io.ReadFull(br, head); err != nil {
+		return nil, ErrBadDump
+	}
+	if string(head[:len(dumpMagic)]) != dumpMagic || head[len(dumpMagic)] == 0 || head[len(dumpMagic)] > DumpVersion {
+		return nil, ErrBadDump
+	}
+	return &DumpReader{r: br}, nil
+}
+
+// Next returns the next record, io.EOF after the last one. A dump cut
+// before its end record fails with ErrDumpTruncated.
+func (d *DumpReader) Next() (*DumpRecord, error) {
+	if d.done {
+		return nil, io.EOF
+	}
+	kind, payload, err := d.read()
+	if err != nil {
+		return nil, err
+	}
+	if kind == dumpEnd {
+		count, n := binary.Uvarint(payload)
+		if n <= 0 || count != d.count {
+			return nil, ErrDumpCorrupted
+		}
+		d.done = true
+		return nil, io.EOF
+	}
+	rec := &DumpRecord{Kind: kind}
+	p := &payloadReader{buf: payload}
+	rec.Name = p.string()
+	switch kind {
+	case DumpKV:
+		rec.Value = p.string()
+		rec.TTL = p.varint()
+	case DumpHash:
+		rec.Field = p.string()
+		rec.Value = p.string()
+	case DumpZSet:
+		rec.Field = p.string()
+		rec.Score = p.varint()
+	case DumpQueue:
+		rec.Value = p.string()
+	default:
+		return nil, ErrBadDump
+	}
+	if p.err {
+		return nil, ErrDumpCorrupted
+	}
+	d.count++
+	return rec, nil
+}
+
+func (d *DumpReader) read() (byte, []byte, error) {
+	kind, err := d.r.ReadByte()
+	if err != nil {
+		return 0, nil, ErrDumpTruncated
+	}
+	size, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return 0, nil, ErrDumpTruncated
+	}
+	if size > MAX_REPLY_SIZE*4 {
+		return 0, nil, ErrDumpCorrupted
+	}
+	payload := make([]byte, size+4)
+	if _, err := io.ReadFull(d.r, payload); err != nil {
+		return 0, nil, ErrDumpTruncated
+	}
+	crc := crc32.ChecksumIEEE([]byte{kind})
+	crc = crc32.Update(crc, crc32.IEEETable, payload[:size])
+	if crc != binary.BigEndian.Uint32(payload[size:]) {
+		return 0, nil, ErrDumpCorrupted
+	}
+	return kind, payload[:size], nil
+}
+
+type payloadReader struct {
+	buf []byte
+	err bool
+}
+
+func (p *payloadReader) string() string {
+	n, size := binary.Uvarint(p.buf)
+	if size <= 0 || uint64(len(p.buf)-size) < n {
+		p.err = true
+		return ""
+	}
+	s := string(p.buf[size : size+int(n)])
+	p.buf = p.buf[size+int(n):]
+	return s
+}
+
+func (p *payloadReader) varint() int64 {
+	v, size := binary.Varint(p.buf)
+	if size <= 0 {
+		p.err = true
+		return 0
+	}
+	p.buf = p.buf[size:]
+	return v
+}
+
+// Restore writes the records of a dump to c. Existing keys, fields and
+// members are overwritten while queue items are pushed after the existing
+// ones, so restore queues to a server without them. The dump is applied as
+// it is read: when it is corrupted or truncated, Restore returns an error
+// and the records before the damage are already written to c.
+func Restore(c Commander, r io.Reader) error {
+	d, err := NewDumpReader(r)
+	if err != nil {
+		return err
+	}
+	b := &restoreBatch{c: c}
+	for {
+		rec, err := d.Next()
+		if err == io.EOF {
+			return b.flush()
+		}
+		if err != nil {
+			return err
+		}
+		if err := b.add(rec); err != nil {
+			return err
+		}
+	}
+}
+
+// restoreBatch groups the records of a kind and name into multi commands
+type restoreBatch struct {
+	c      Commander
+	kind   byte
+	name   string
+	pairs  []*KVPair
+	fields map[string]string
+	scores map[string]int
+}
+
+func (b *restoreBatch) add(rec *DumpRecord) error {
+	if rec.Kind != b.kind || (rec.Kind != DumpKV && rec.Name != b.name) {
+		if err := b.flush(); err != nil {
+			return err
+		}
+		b.kind, b.name = rec.Kind, rec.Name
+	}
+	switch rec.Kind {
+	case DumpKV:
+		if rec.TTL >= 0 {
+			_, err := b.c.Setx(rec.Name, rec.Value, int32(rec.TTL))
+			return err
+		}
+		b.pairs = append(b.pairs, NewKVPair(rec.Name, rec.Value))
+		if len(b.pairs) >= dumpBatch {
+			return b.flush()
+		}
+	case DumpHash:
+		if b.fields == nil {
+			b.fields = make(map[string]string)
+		}
+		b.fields[rec.Field] = rec.Value
+		if len(b.fields) >= dumpBatch {
+			return b.flush()
+		}
+	case DumpZSet:
+		if b.scores == nil {
+			b.scores = make(map[string]int)
+		}
+		b.scores[rec.Field] = int(rec.Score)
+		if len(b.scores) >= dumpBatch {
+			return b.flush()
+		}
+	case DumpQueue:
+		_, err := b.c.QPushBack(rec.Name, rec.Value)
+		return err
+	}
+	return nil
+}
+
+func (b *restoreBatch) flush() error {
+	var err error
+	switch {
+	case len(b.pairs) > 0:
+		_, err = b.c.MultiSet(b.pairs...)
+	case len(b.fields) > 0:
+		_, err = b.c.MultiHSet(b.name, b.fields)
+	case len(b.scores) > 0:
+		_, err = b.c.MultiZSet(b.name, b.scores)
+	}
+	b.pairs, b.fields, b.scores = nil, nil, nil
+	return err
+}
+
+// String describes a record for listings
+func (r *DumpRecord) String() string {
+	switch r.Kind {
+	case DumpKV:
+		if r.TTL >= 0 {
+			return fmt.Sprintf("kv %q %q ttl=%d", r.Name, r.Value, r.TTL)
+		}
+		return fmt.Sprintf("kv %q %q", r.Name, r.Value)
+	case DumpHash:
+		return fmt.Sprintf("hash %q %q %q", r.Name, r.Field, r.Value)
+	case DumpZSet:
+		return fmt.Sprintf("zset %q %q %s", r.Name, r.Field, strconv.FormatInt(r.Score, 10))
+	}
+	return fmt.Sprintf("queue %q %q", r.Name, r.Value)
+}
@@ -0,0 +1,150 @@
+package gossdb_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bububa/gossdb"
+)
+
+// Read every record of a dump, the TTLs are only kept as expiring or not
+func readDump(t *testing.T, data []byte) []gossdb.DumpRecord {
+	t.Helper()
+	d, err := gossdb.NewDumpReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []gossdb.DumpRecord
+	for {
+		rec, err := d.Next()
+		if err == io.EOF {
+			return res
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.TTL > 0 {
+			rec.TTL = 1
+		}
+		res = append(res, *rec)
+	}
+}
+
+func TestDumpRestore(t *testing.T) {
+	_, src := newTestClient(t)
+	// more items than a batch
+	for i := 0; i < 250; i++ {
+		if _, err := src.Set(fmt.Sprintf("k%03d", i), fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fields := make(map[string]string)
+	for i := 0; i < 150; i++ {
+		fields[fmt.Sprintf("f%03d", i)] = fmt.Sprint(i)
+	}
+	steps := []func() (bool, error){
+		func() (bool, error) { return src.Set("binary", "a\nb\x00c") },
+		func() (bool, error) { return src.Setx("expiring", "v", 100) },
+		func() (bool, error) { return src.MultiHSet("h", fields) },
+		func() (bool, error) { return src.MultiZSet("z", map[string]int{"a": -5, "b": 7}) },
+		func() (bool, error) { return src.QPushBack("q", "1") },
+		func() (bool, error) { return src.QPushBack("q", "2") },
+	}
+	for _, step := range steps {
+		if _, err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := src.Dump(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := readDump(t, buf.Bytes())
+	if len(want) != 250+2+150+2+2 {
+		t.Fatalf("dump of %d records", len(want))
+	}
+
+	// restored across the shards of a cluster
+	_, dst := newTestCluster(t, 3)
+	if err := dst.Restore(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	var restored bytes.Buffer
+	if err := dst.Dump(&restored); err != nil {
+		t.Fatal(err)
+	}
+	if got := readDump(t, restored.Bytes()); !reflect.DeepEqual(got, want) {
+		t.Fatalf("restored %d records, want the %d dumped", len(got), len(want))
+	}
+	if ttl, _ := dst.TTL("expiring"); ttl <= 0 {
+		t.Fatalf("ttl after restore = %d", ttl)
+	}
+}
+
+func TestDumpErrors(t *testing.T) {
+	_, c := newTestClient(t)
+	if _, err := c.Set("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := c.Dump(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if err := gossdb.Restore(c, bytes.NewReader([]byte("XXXX\x01"))); err != gossdb.ErrBadDump {
+		t.Fatalf("restore of a bad header = %v", err)
+	}
+	if err := gossdb.Restore(c, bytes.NewReader(data[:len(data)-3])); err != gossdb.ErrDumpTruncated {
+		t.Fatalf("restore of a truncated dump = %v", err)
+	}
+	corrupted := append([]byte(nil), data...)
+	corrupted[8] ^= 0xff
+	if err := gossdb.Restore(c, bytes.NewReader(corrupted)); err != gossdb.ErrDumpCorrupted {
+		t.Fatalf("restore of a corrupted dump = %v", err)
+	}
+}
+
+var errWrite = errors.New("disk full")
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errWrite
+}
+
+// Counts the TTL commands, one per KV dumped
+type ttlCounter struct {
+	*gossdb.Client
+	calls int
+}
+
+func (c *ttlCounter) TTL(key string) (int64, error) {
+	c.calls++
+	return c.Client.TTL(key)
+}
+
+// A dump stops at the first write error instead of scanning the database
+func TestDumpWriteError(t *testing.T) {
+	_, c := newTestClient(t)
+	value := strings.Repeat("v", 1000)
+	var pairs []*gossdb.KVPair
+	for i := 0; i < 500; i++ {
+		pairs = append(pairs, gossdb.NewKVPair(fmt.Sprintf("k%03d", i), value))
+	}
+	if _, err := c.MultiSet(pairs...); err != nil {
+		t.Fatal(err)
+	}
+	counter := &ttlCounter{Client: c}
+	if err := gossdb.Dump(counter, failingWriter{}); err != errWrite {
+		t.Fatalf("dump error = %v, want %v", err, errWrite)
+	}
+	if counter.calls >= len(pairs) {
+		t.Fatalf("%d keys read after the write error", counter.calls)
+	}
+}
@@ -0,0 +1,421 @@
+// Package embedded is a pure-Go storage engine implementing the SSDB command
+// set, so programs can run without a daemon and switch to a real server by
+// configuration.
+//
+//	db, err := embedded.Open("data.db")
+//	defer db.Close()
+//	db.Set("key", "value")
+//
+// DB implements gossdb.Commander and returns the same values as
+// gossdb.Client for the same commands.
+package embedded
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bububa/gossdb"
+)
+
+// Key space of the store, every data type gets its own prefix
+const (
+	kvPrefix     = "k" // k key -> value
+	ttlPrefix    = "t" // t key -> expiration in unix nanoseconds
+	hsizePrefix  = "H" // H name -> number of fields
+	hashPrefix   = "h" // h len name field -> value
+	zsizePrefix  = "Z" // Z name -> number of members
+	zsetPrefix   = "z" // z len name member -> score
+	zscorePrefix = "s" // s len name score member -> ""
+	qmetaPrefix  = "Q" // Q name -> head and tail sequences
+	queuePrefix  = "q" // q len name seq -> item
+)
+
+var ErrNotInteger = errors.New("embedded: value is not an integer or out of range")
+
+// DB is an embedded SSDB database
+type DB struct {
+	mutex sync.Mutex
+	store *store
+	now   func() time.Time
+}
+
+var _ gossdb.Commander = (*DB)(nil)
+
+// Open the database persisted at path, it is created if missing. An empty
+// path opens a database kept in memory only. A write torn by a crash is
+// dropped, a log damaged elsewhere fails with ErrCorrupted.
+func Open(path string) (*DB, error) {
+	s, err := openStore(path)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{store: s, now: time.Now}, nil
+}
+
+// Dial opens a Commander from a DSN: file://path opens an embedded database,
+// mem:// an in-memory one and host:port connects to an SSDB server
+func Dial(dsn string) (gossdb.Commander, error) {
+	switch {
+	case strings.HasPrefix(dsn, "file://"):
+		return Open(strings.TrimPrefix(dsn, "file://"))
+	case strings.HasPrefix(dsn, "mem://"):
+		return Open("")
+	}
+	addr, err := net.ResolveTCPAddr("tcp", strings.TrimPrefix(dsn, "ssdb://"))
+	if err != nil {
+		return nil, err
+	}
+	return gossdb.Connect(addr)
+}
+
+// SetSync makes every write wait for the data to reach the disk
+func (db *DB) SetSync(sync bool) {
+	db.store.mutex.Lock()
+	defer db.store.mutex.Unlock()
+	db.store.sync = sync
+}
+
+// Compact rewrites the log with the live data only
+func (db *DB) Compact() error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.store.compact()
+}
+
+// Close flushes the log to the disk
+func (db *DB) Close() error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.store.close()
+}
+
+// Prefix of the keys of a hash, zset or queue, the length of the name keeps
+// a name from matching the start of a longer one
+func nested(prefix, name string) string {
+	return prefix + string(binary.AppendUvarint(nil, uint64(len(name)))) + name
+}
+
+// Smallest key greater than every key starting with p
+func prefixEnd(p string) string {
+	b := []byte(p)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1])
+		}
+	}
+	return ""
+}
+
+// Bounds of the keys of p in (start, end], an empty bound is open
+func forward(p, start, end string) (string, string) {
+	lo, hi := p, prefixEnd(p)
+	if start != "" {
+		lo = p + start + "\x00"
+	}
+	if end != "" {
+		hi = p + end + "\x00"
+	}
+	return lo, hi
+}
+
+// Bounds of the keys of p in [end, start) for reverse scans
+func backward(p, start, end string) (string, string) {
+	hi, lo := prefixEnd(p), p
+	if start != "" {
+		hi = p + start
+	}
+	if end != "" {
+		lo = p + end
+	}
+	return hi, lo
+}
+
+// SSDB treats a negative limit as no limit
+func full(n, limit int) bool {
+	return limit >= 0 && n >= limit
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+func (db *DB) expired(key string) bool {
+	t, ok := db.store.get(ttlPrefix + key)
+	if !ok {
+		return false
+	}
+	ns, _ := strconv.ParseInt(t, 10, 64)
+	return db.now().UnixNano() >= ns
+}
+
+// Value of a live key, an expired key is removed on access
+func (db *DB) getKV(key string) (string, bool, error) {
+	if db.expired(key) {
+		b := new(batch)
+		b.del(kvPrefix + key)
+		b.del(ttlPrefix + key)
+		return "", false, db.store.write(b)
+	}
+	v, ok := db.store.get(kvPrefix + key)
+	return v, ok, nil
+}
+
+func (db *DB) setKV(b *batch, key, val string) {
+	b.put(kvPrefix+key, val)
+	if _, ok := db.store.get(ttlPrefix + key); ok {
+		b.del(ttlPrefix + key)
+	}
+}
+
+func (db *DB) Set(key string, val string) (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	b := new(batch)
+	db.setKV(b, key, val)
+	return true, db.store.write(b)
+}
+
+// Setx sets a key that expires after ttl seconds
+func (db *DB) Setx(key string, val string, ttl int32) (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	b := new(batch)
+	b.put(kvPrefix+key, val)
+	b.put(ttlPrefix+key, itoa(db.now().Add(time.Duration(ttl)*time.Second).UnixNano()))
+	return true, db.store.write(b)
+}
+
+func (db *DB) Setnx(key string, val string) (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	_, found, err := db.getKV(key)
+	if err != nil || found {
+		return err == nil, err
+	}
+	b := new(batch)
+	db.setKV(b, key, val)
+	return true, db.store.write(b)
+}
+
+// Get returns the value of key or nil when it is not found
+func (db *DB) Get(key string) (interface{}, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	v, found, err := db.getKV(key)
+	if err != nil || !found {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Getset sets key and returns its previous value or nil
+func (db *DB) Getset(key string, val string) (interface{}, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	old, found, err := db.getKV(key)
+	if err != nil {
+		return nil, err
+	}
+	b := new(batch)
+	db.setKV(b, key, val)
+	if err := db.store.write(b); err != nil || !found {
+		return nil, err
+	}
+	return old, nil
+}
+
+func (db *DB) Del(key string) (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	b := new(batch)
+	b.del(kvPrefix + key)
+	b.del(ttlPrefix + key)
+	return true, db.store.write(b)
+}
+
+func (db *DB) MultiSet(pairs ...*gossdb.KVPair) (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	b := new(batch)
+	for _, p := range pairs {
+		v, err := toString(p.Value)
+		if err != nil {
+			return false, err
+		}
+		db.setKV(b, p.Key, v)
+	}
+	return true, db.store.write(b)
+}
+
+// MultiGet returns the pairs of the keys found
+func (db *DB) MultiGet(ks ...string) ([]*gossdb.KVPair, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	var pairs []*gossdb.KVPair
+	for _, k := range ks {
+		v, found, err := db.getKV(k)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			pairs = append(pairs, gossdb.NewKVPair(k, v))
+		}
+	}
+	return pairs, nil
+}
+
+// MultiGetOrdered returns one result per key, in the order of ks
+func (db *DB) MultiGetOrdered(ks ...string) ([]*gossdb.KVResult, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	res := make([]*gossdb.KVResult, len(ks))
+	for i, k := range ks {
+		v, found, err := db.getKV(k)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = &gossdb.KVResult{Key: k, Found: found}
+		if found {
+			res[i].Value = v
+		}
+	}
+	return res, nil
+}
+
+// MultiGetMap returns the values of the keys found
+func (db *DB) MultiGetMap(ks ...string) (map[string]interface{}, error) {
+	pairs, err := db.MultiGet(ks...)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]interface{}, len(pairs))
+	for _, p := range pairs {
+		res[p.Key] = p.Value
+	}
+	return res, nil
+}
+
+func (db *DB) MultiDel(ks ...string) (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	b := new(batch)
+	for _, k := range ks {
+		b.del(kvPrefix + k)
+		b.del(ttlPrefix + k)
+	}
+	return true, db.store.write(b)
+}
+
+// Scan lists the key-value pairs in (startKey, endKey]
+func (db *DB) Scan(startKey string, endKey string, limit int) ([][2]string, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	kvList := [][2]string{}
+	lo, hi := forward(kvPrefix, startKey, endKey)
+	now := db.now().UnixNano()
+	db.store.scan(lo, hi, func(k, v string) bool {
+		if full(len(kvList), limit) {
+			return false
+		}
+		key := k[len(kvPrefix):]
+		if t, ok := db.store.data[ttlPrefix+key]; ok {
+			if ns, _ := strconv.ParseInt(t, 10, 64); now >= ns {
+				return true
+			}
+		}
+		kvList = append(kvList, [2]string{key, v})
+		return true
+	})
+	return kvList, nil
+}
+
+func (db *DB) Exists(key string) (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	_, found, err := db.getKV(key)
+	return found, err
+}
+
+// Expire sets the ttl of key in seconds, it returns 0 when key is not found
+func (db *DB) Expire(key string, ttl int) (int, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	_, found, err := db.getKV(key)
+	if err != nil || !found {
+		return 0, err
+	}
+	b := new(batch)
+	b.put(ttlPrefix+key, itoa(db.now().Add(time.Duration(ttl)*time.Second).UnixNano()))
+	return 1, db.store.write(b)
+}
+
+// TTL returns the seconds before key expires, -1 when it has no ttl
+func (db *DB) TTL(key string) (int64, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if _, found, err := db.getKV(key); err != nil || !found {
+		return -1, err
+	}
+	t, found := db.store.get(ttlPrefix + key)
+	if !found {
+		return -1, nil
+	}
+	ns, _ := strconv.ParseInt(t, 10, 64)
+	return int64(time.Duration(ns-db.now().UnixNano()).Seconds() + 0.5), nil
+}
+
+func (db *DB) Incr(key string, num int) (int64, error) {
+	return db.incr(key, int64(num))
+}
+
+func (db *DB) Decr(key string, num int) (int64, error) {
+	return db.incr(key, -int64(num))
+}
+
+func (db *DB) incr(key string, num int64) (int64, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	v, found, err := db.getKV(key)
+	if err != nil {
+		return 0, err
+	}
+	var cur int64
+	if found {
+		if cur, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return 0, ErrNotInteger
+		}
+	}
+	cur += num
+	b := new(batch)
+	b.put(kvPrefix+key, itoa(cur))
+	return cur, db.store.write(b)
+}
+
+// Format a value the way gossdb.Client sends it
+func toString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case int, int32, int64, uint, uint32, uint64:
+		return fmt.Sprintf("%d", v), nil
+	case float32, float64:
+		return fmt.Sprintf("%f", v), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("bad request:%v", v)
+}
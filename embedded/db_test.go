@@ -0,0 +1,285 @@
+package embedded_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bububa/gossdb"
+	"github.com/bububa/gossdb/embedded"
+	"github.com/bububa/gossdb/ssdbtest"
+)
+
+func openDB(t *testing.T, path string) *embedded.DB {
+	t.Helper()
+	db, err := embedded.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// Write a few values of every type and close the database
+func fill(t *testing.T, path string) {
+	t.Helper()
+	db := openDB(t, path)
+	steps := []func() (bool, error){
+		func() (bool, error) { return db.Set("k", "v") },
+		func() (bool, error) { return db.Set("gone", "v") },
+		func() (bool, error) { return db.Del("gone") },
+		func() (bool, error) { return db.HSet("h", "f", "hv") },
+		func() (bool, error) { return db.ZSet("z", "m", 7) },
+		func() (bool, error) { return db.QPushBack("q", "item") },
+	}
+	for _, step := range steps {
+		if _, err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectFilled(t *testing.T, db *embedded.DB) {
+	t.Helper()
+	if v, err := db.Get("k"); v != "v" || err != nil {
+		t.Fatalf("get = %v, %v", v, err)
+	}
+	if v, err := db.Get("gone"); v != nil || err != nil {
+		t.Fatalf("get deleted = %v, %v", v, err)
+	}
+	if v, err := db.HGet("h", "f"); v != "hv" || err != nil {
+		t.Fatalf("hget = %v, %v", v, err)
+	}
+	if v, err := db.ZGet("z", "m"); v != int64(7) || err != nil {
+		t.Fatalf("zget = %v, %v", v, err)
+	}
+	if v, err := db.QFront("q"); v != "item" || err != nil {
+		t.Fatalf("qfront = %v, %v", v, err)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	fill(t, path)
+	db := openDB(t, path)
+	expectFilled(t, db)
+	before, _ := os.Stat(path)
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size() {
+		t.Fatalf("compacted log of %d bytes, was %d", after.Size(), before.Size())
+	}
+	if _, err := db.Set("k2", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	db = openDB(t, path)
+	defer db.Close()
+	expectFilled(t, db)
+	if v, _ := db.Get("k2"); v != "v2" {
+		t.Fatalf("get after compact = %v", v)
+	}
+}
+
+func appendBytes(t *testing.T, path string, data []byte) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTornRecord(t *testing.T) {
+	tails := map[string][]byte{
+		"header":     {0xde, 0xad},
+		"lengths":    {0, 0, 0, 0, 1, 0x80},
+		"last bytes": {0, 0, 0, 0, 1, 1, 1, 'a', 'b'},
+	}
+	for name, tail := range tails {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "data.db")
+			fill(t, path)
+			info, _ := os.Stat(path)
+			appendBytes(t, path, tail)
+			db := openDB(t, path)
+			defer db.Close()
+			expectFilled(t, db)
+			if after, _ := os.Stat(path); after.Size() != info.Size() {
+				t.Fatalf("log of %d bytes, want the torn record dropped to %d", after.Size(), info.Size())
+			}
+			if _, err := db.Set("k", "new"); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestCorruptedRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	fill(t, path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the checksum of the second record, which others follow
+	data[12] ^= 0xff
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := embedded.Open(path); !errors.Is(err, embedded.ErrCorrupted) {
+		t.Fatalf("open error = %v, want %v", err, embedded.ErrCorrupted)
+	}
+}
+
+// A length running past the end of the log may be a damaged header
+// followed by valid records, the log is not truncated
+func TestCorruptedLength(t *testing.T) {
+	tails := map[string][]byte{
+		"payload": {0, 0, 0, 0, 1, 3, 3, 'a'},
+		// a length of 4 GiB must not be allocated
+		"length": {0, 0, 0, 0, 1, 0x80, 0x80, 0x80, 0x80, 0x10, 0x80, 0x80, 0x80, 0x80, 0x10},
+	}
+	for name, tail := range tails {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "data.db")
+			fill(t, path)
+			appendBytes(t, path, tail)
+			info, _ := os.Stat(path)
+			if _, err := embedded.Open(path); !errors.Is(err, embedded.ErrCorrupted) {
+				t.Fatalf("open error = %v, want %v", err, embedded.ErrCorrupted)
+			}
+			if after, _ := os.Stat(path); after.Size() != info.Size() {
+				t.Fatalf("log truncated to %d bytes", after.Size())
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "data.db")
+	fill(t, path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the key and value lengths of the first record
+	data[5], data[6] = 0x7f, 0x7f
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := embedded.Open(path); !errors.Is(err, embedded.ErrCorrupted) {
+		t.Fatalf("open error = %v, want %v", err, embedded.ErrCorrupted)
+	}
+	if after, _ := os.ReadFile(path); !reflect.DeepEqual(after, data) {
+		t.Fatalf("log changed to %d bytes", len(after))
+	}
+}
+
+func TestEmptyQueue(t *testing.T) {
+	db := openDB(t, "")
+	defer db.Close()
+	if _, err := db.QFront("q"); err != gossdb.ErrBadResponse {
+		t.Fatalf("qfront error = %v, want %v", err, gossdb.ErrBadResponse)
+	}
+	if _, err := db.QBack("q"); err != gossdb.ErrBadResponse {
+		t.Fatalf("qback error = %v, want %v", err, gossdb.ErrBadResponse)
+	}
+}
+
+// The embedded database answers like a server
+func TestSameAsClient(t *testing.T) {
+	srv := ssdbtest.NewServer()
+	defer srv.Close()
+	c, err := gossdb.Connect(srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	db := openDB(t, "")
+	defer db.Close()
+
+	script := []func(c gossdb.Commander) (interface{}, error){
+		func(c gossdb.Commander) (interface{}, error) { return c.Set("a", "1") },
+		func(c gossdb.Commander) (interface{}, error) { return c.Setnx("a", "2") },
+		func(c gossdb.Commander) (interface{}, error) { return c.Get("a") },
+		func(c gossdb.Commander) (interface{}, error) { return c.Get("missing") },
+		func(c gossdb.Commander) (interface{}, error) { return c.Incr("n", 3) },
+		func(c gossdb.Commander) (interface{}, error) { return c.Getset("a", "3") },
+		func(c gossdb.Commander) (interface{}, error) {
+			return c.MultiSet(gossdb.NewKVPair("b", "2"), gossdb.NewKVPair("c", "3"))
+		},
+		func(c gossdb.Commander) (interface{}, error) { return c.MultiGetOrdered("c", "x", "a") },
+		func(c gossdb.Commander) (interface{}, error) { return c.Scan("a", "c", -1) },
+		func(c gossdb.Commander) (interface{}, error) { return c.Exists("b") },
+		func(c gossdb.Commander) (interface{}, error) { return c.MultiDel("b", "c") },
+		func(c gossdb.Commander) (interface{}, error) { return c.Scan("", "", 10) },
+		func(c gossdb.Commander) (interface{}, error) {
+			return c.MultiHSet("h", map[string]string{"a": "1", "b": "2", "c": "3"})
+		},
+		func(c gossdb.Commander) (interface{}, error) { return c.HIncr("h", "a", 4) },
+		func(c gossdb.Commander) (interface{}, error) { return c.HGet("h", "missing") },
+		func(c gossdb.Commander) (interface{}, error) { return c.HScan("h", "a", "", 10) },
+		func(c gossdb.Commander) (interface{}, error) { return c.HRScan("h", "", "", 2) },
+		func(c gossdb.Commander) (interface{}, error) { return c.HKeys("h", "", "b", -1) },
+		func(c gossdb.Commander) (interface{}, error) { return c.MultiHGet("h", []string{"a", "x"}) },
+		func(c gossdb.Commander) (interface{}, error) { return c.HSize("h") },
+		func(c gossdb.Commander) (interface{}, error) { return c.HList("", "", 10) },
+		func(c gossdb.Commander) (interface{}, error) {
+			return c.MultiZSet("z", map[string]int{"a": 3, "b": 1, "c": 2, "d": 2})
+		},
+		func(c gossdb.Commander) (interface{}, error) { return c.ZIncr("z", "b", 5) },
+		func(c gossdb.Commander) (interface{}, error) { return c.ZGet("z", "missing") },
+		func(c gossdb.Commander) (interface{}, error) { return c.ZKeys("z", "", 0, 10, -1) },
+		func(c gossdb.Commander) (interface{}, error) { return c.ZRange("z", 1, 2) },
+		func(c gossdb.Commander) (interface{}, error) { return c.ZRRange("z", 0, 2) },
+		func(c gossdb.Commander) (interface{}, error) { return c.ZRank("z", "a") },
+		func(c gossdb.Commander) (interface{}, error) { return c.ZRRank("z", "a") },
+		func(c gossdb.Commander) (interface{}, error) { return c.ZScan("z", "", 2, 3, -1) },
+		func(c gossdb.Commander) (interface{}, error) { return c.MultiZGet("z", []string{"a", "x"}) },
+		func(c gossdb.Commander) (interface{}, error) { return c.ZList("", "", 10) },
+		func(c gossdb.Commander) (interface{}, error) { return c.QPushBack("q", "b") },
+		func(c gossdb.Commander) (interface{}, error) { return c.QPushFront("q", "a") },
+		func(c gossdb.Commander) (interface{}, error) { return c.QPushBack("q", "c") },
+		func(c gossdb.Commander) (interface{}, error) { return c.QSlice("q", 1, -1) },
+		func(c gossdb.Commander) (interface{}, error) { return c.QGet("q", -1) },
+		func(c gossdb.Commander) (interface{}, error) { return c.QPopFront("q") },
+		func(c gossdb.Commander) (interface{}, error) { return c.QSize("q") },
+		func(c gossdb.Commander) (interface{}, error) { return c.QList("", "", 10) },
+		func(c gossdb.Commander) (interface{}, error) { return c.QClear("q") },
+		func(c gossdb.Commander) (interface{}, error) { return c.QPopBack("q") },
+	}
+	for i, step := range script {
+		want, werr := step(c)
+		got, gerr := step(db)
+		if !reflect.DeepEqual(got, want) || (gerr == nil) != (werr == nil) {
+			t.Errorf("step %d = %#v, %v, the client returned %#v, %v", i, got, gerr, want, werr)
+		}
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	db := openDB(t, "")
+	defer db.Close()
+	if _, err := db.Setx("k", "v", 1); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, _ := db.TTL("k"); ttl != 1 {
+		t.Fatalf("ttl = %d, want 1", ttl)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if v, err := db.Get("k"); v != nil || err != nil {
+		t.Fatalf("get expired = %v, %v", v, err)
+	}
+	if ttl, _ := db.TTL("k"); ttl != -1 {
+		t.Fatalf("ttl of a missing key = %d, want -1", ttl)
+	}
+}
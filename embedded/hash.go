@@ -0,0 +1,239 @@
+package embedded
+
+import (
+	"strconv"
+
+	"github.com/bububa/gossdb"
+)
+
+// Read a size counter, a missing one is zero
+func (db *DB) size(key string) int64 {
+	v, _ := db.store.get(key)
+	n, _ := strconv.ParseInt(v, 10, 64)
+	return n
+}
+
+// Write a size counter, a collection without items has none
+func setSize(b *batch, key string, n int64) {
+	if n <= 0 {
+		b.del(key)
+		return
+	}
+	b.put(key, itoa(n))
+}
+
+// Set fields of a hash and keep its size up to date
+func (db *DB) hset(b *batch, key string, fvMap map[string]string) {
+	p := nested(hashPrefix, key)
+	n := db.size(hsizePrefix + key)
+	for f, v := range fvMap {
+		if _, found := db.store.get(p + f); !found {
+			n++
+		}
+		b.put(p+f, v)
+	}
+	setSize(b, hsizePrefix+key, n)
+}
+
+func (db *DB) hdel(b *batch, key string, fieldList []string) {
+	p := nested(hashPrefix, key)
+	n := db.size(hsizePrefix + key)
+	deleted := make(map[string]bool)
+	for _, f := range fieldList {
+		if _, found := db.store.get(p + f); found && !deleted[f] {
+			deleted[f] = true
+			n--
+		}
+		b.del(p + f)
+	}
+	setSize(b, hsizePrefix+key, n)
+}
+
+func (db *DB) HSet(key, field, val string) (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	b := new(batch)
+	db.hset(b, key, map[string]string{field: val})
+	return true, db.store.write(b)
+}
+
+// HGet returns the value of field or nil when it is not found
+func (db *DB) HGet(key, field string) (interface{}, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	v, found := db.store.get(nested(hashPrefix, key) + field)
+	if !found {
+		return nil, nil
+	}
+	return v, nil
+}
+
+func (db *DB) HDel(key, field string) (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	b := new(batch)
+	db.hdel(b, key, []string{field})
+	return true, db.store.write(b)
+}
+
+func (db *DB) HIncr(key, field string, num int) (int64, error) {
+	return db.hincr(key, field, int64(num))
+}
+
+func (db *DB) HDecr(key, field string, num int) (int64, error) {
+	return db.hincr(key, field, -int64(num))
+}
+
+func (db *DB) hincr(key, field string, num int64) (int64, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	var cur int64
+	if v, found := db.store.get(nested(hashPrefix, key) + field); found {
+		var err error
+		if cur, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return 0, ErrNotInteger
+		}
+	}
+	cur += num
+	b := new(batch)
+	db.hset(b, key, map[string]string{field: itoa(cur)})
+	return cur, db.store.write(b)
+}
+
+func (db *DB) HExists(key, field string) (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	_, found := db.store.get(nested(hashPrefix, key) + field)
+	return found, nil
+}
+
+func (db *DB) HSize(key string) (int64, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.size(hsizePrefix + key), nil
+}
+
+// HList lists the names of the hashes in (startKey, endKey]
+func (db *DB) HList(startKey, endKey string, limit int) ([]string, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.names(hsizePrefix, startKey, endKey, limit), nil
+}
+
+// Names of the collections whose size is stored under prefix
+func (db *DB) names(prefix, start, end string, limit int) []string {
+	keyList := []string{}
+	lo, hi := forward(prefix, start, end)
+	db.store.scan(lo, hi, func(k, v string) bool {
+		if full(len(keyList), limit) {
+			return false
+		}
+		keyList = append(keyList, k[len(prefix):])
+		return true
+	})
+	return keyList
+}
+
+// HKeys lists the fields of a hash in (startField, endField]
+func (db *DB) HKeys(key, startField, endField string, limit int) ([]string, error) {
+	fvList, err := db.HScan(key, startField, endField, limit)
+	if err != nil {
+		return nil, err
+	}
+	fieldList := make([]string, len(fvList))
+	for i, fv := range fvList {
+		fieldList[i] = fv[0]
+	}
+	return fieldList, nil
+}
+
+// HScan lists the fields and values of a hash in (startField, endField]
+func (db *DB) HScan(key, startField, endField string, limit int) ([][2]string, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	p := nested(hashPrefix, key)
+	fvList := [][2]string{}
+	lo, hi := forward(p, startField, endField)
+	db.store.scan(lo, hi, func(k, v string) bool {
+		if full(len(fvList), limit) {
+			return false
+		}
+		fvList = append(fvList, [2]string{k[len(p):], v})
+		return true
+	})
+	return fvList, nil
+}
+
+// HRScan lists the fields and values of a hash in reverse order, from
+// startField excluded down to endField included
+func (db *DB) HRScan(key, startField, endField string, limit int) ([][2]string, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	p := nested(hashPrefix, key)
+	fvList := [][2]string{}
+	hi, lo := backward(p, startField, endField)
+	db.store.rscan(hi, lo, func(k, v string) bool {
+		if full(len(fvList), limit) {
+			return false
+		}
+		fvList = append(fvList, [2]string{k[len(p):], v})
+		return true
+	})
+	return fvList, nil
+}
+
+func (db *DB) HClear(key string) (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	b := new(batch)
+	db.clear(b, nested(hashPrefix, key))
+	b.del(hsizePrefix + key)
+	return true, db.store.write(b)
+}
+
+// Delete every key starting with p
+func (db *DB) clear(b *batch, p string) {
+	db.store.scan(p, prefixEnd(p), func(k, v string) bool {
+		b.del(k)
+		return true
+	})
+}
+
+func (db *DB) MultiHSet(key string, fvMap map[string]string) (bool, error) {
+	if len(fvMap) == 0 {
+		return false, gossdb.ErrNotEnoughParams
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	b := new(batch)
+	db.hset(b, key, fvMap)
+	return true, db.store.write(b)
+}
+
+// MultiHGet returns the fields found
+func (db *DB) MultiHGet(key string, fieldList []string) (map[string]string, error) {
+	if len(fieldList) == 0 {
+		return nil, gossdb.ErrNotEnoughParams
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	p := nested(hashPrefix, key)
+	fvMap := map[string]string{}
+	for _, f := range fieldList {
+		if v, found := db.store.get(p + f); found {
+			fvMap[f] = v
+		}
+	}
+	return fvMap, nil
+}
+
+func (db *DB) MultiHDel(key string, fieldList []string) (bool, error) {
+	if len(fieldList) == 0 {
+		return false, gossdb.ErrNotEnoughParams
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	b := new(batch)
+	db.hdel(b, key, fieldList)
+	return true, db.store.write(b)
+}
@@ -0,0 +1,204 @@
+package embedded
+
+import (
+	"encoding/binary"
+
+	"github.com/bububa/gossdb"
+)
+
+// First sequence of a new queue, items pushed at the front go below it
+const queueStart uint64 = 1 << 63
+
+// The items of a queue are in [head, tail)
+type queue struct {
+	head, tail uint64
+}
+
+func (q queue) size() int64 {
+	return int64(q.tail - q.head)
+}
+
+func (db *DB) queue(key string) queue {
+	v, found := db.store.get(qmetaPrefix + key)
+	if !found || len(v) != 16 {
+		return queue{queueStart, queueStart}
+	}
+	return queue{binary.BigEndian.Uint64([]byte(v[:8])), binary.BigEndian.Uint64([]byte(v[8:]))}
+}
+
+func setQueue(b *batch, key string, q queue) {
+	if q.size() == 0 {
+		b.del(qmetaPrefix + key)
+		return
+	}
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], q.head)
+	binary.BigEndian.PutUint64(buf[8:], q.tail)
+	b.put(qmetaPrefix+key, string(buf[:]))
+}
+
+func itemKey(key string, seq uint64) string {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], seq)
+	return nested(queuePrefix, key) + string(buf[:])
+}
+
+// Item at index, a negative index counts from the back
+func (db *DB) qget(key string, index int) (string, bool) {
+	q := db.queue(key)
+	if index < 0 {
+		index += int(q.size())
+	}
+	if index < 0 || int64(index) >= q.size() {
+		return "", false
+	}
+	return db.store.get(itemKey(key, q.head+uint64(index)))
+}
+
+func (db *DB) QSize(key string) (int64, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.queue(key).size(), nil
+}
+
+func (db *DB) QClear(key string) (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	b := new(batch)
+	db.clear(b, nested(queuePrefix, key))
+	b.del(qmetaPrefix + key)
+	return true, db.store.write(b)
+}
+
+// QFront returns the first item, gossdb.ErrBadResponse when the queue is
+// empty as gossdb.Client does
+func (db *DB) QFront(key string) (string, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	item, found := db.qget(key, 0)
+	if !found {
+		return "", gossdb.ErrBadResponse
+	}
+	return item, nil
+}
+
+// QBack returns the last item, gossdb.ErrBadResponse when the queue is
+// empty as gossdb.Client does
+func (db *DB) QBack(key string) (string, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	item, found := db.qget(key, -1)
+	if !found {
+		return "", gossdb.ErrBadResponse
+	}
+	return item, nil
+}
+
+// QGet returns the item at index or nil, a negative index counts from the back
+func (db *DB) QGet(key string, index int) (interface{}, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	item, found := db.qget(key, index)
+	if !found {
+		return nil, nil
+	}
+	return item, nil
+}
+
+// QSlice lists the items from begin to end included, negative indexes count
+// from the back
+func (db *DB) QSlice(key string, begin, end int) ([]string, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	q := db.queue(key)
+	size := int(q.size())
+	if begin < 0 {
+		begin += size
+	}
+	if end < 0 {
+		end += size
+	}
+	if begin < 0 {
+		begin = 0
+	}
+	if end >= size {
+		end = size - 1
+	}
+	itemList := []string{}
+	for i := begin; i <= end; i++ {
+		item, _ := db.store.get(itemKey(key, q.head+uint64(i)))
+		itemList = append(itemList, item)
+	}
+	return itemList, nil
+}
+
+// QList lists the queue names in (startKey, endKey]
+func (db *DB) QList(startKey, endKey string, limit int) ([]string, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.names(qmetaPrefix, startKey, endKey, limit), nil
+}
+
+func (db *DB) QPush(key, item string) (bool, error) {
+	return db.QPushBack(key, item)
+}
+
+func (db *DB) QPushFront(key, item string) (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	q := db.queue(key)
+	q.head--
+	b := new(batch)
+	b.put(itemKey(key, q.head), item)
+	setQueue(b, key, q)
+	return true, db.store.write(b)
+}
+
+func (db *DB) QPushBack(key, item string) (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	q := db.queue(key)
+	b := new(batch)
+	b.put(itemKey(key, q.tail), item)
+	q.tail++
+	setQueue(b, key, q)
+	return true, db.store.write(b)
+}
+
+func (db *DB) QPop(key string) (interface{}, error) {
+	return db.QPopFront(key)
+}
+
+// QPopFront removes and returns the first item, nil when the queue is empty
+func (db *DB) QPopFront(key string) (interface{}, error) {
+	return db.qpop(key, false)
+}
+
+// QPopBack removes and returns the last item, nil when the queue is empty
+func (db *DB) QPopBack(key string) (interface{}, error) {
+	return db.qpop(key, true)
+}
+
+func (db *DB) qpop(key string, back bool) (interface{}, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	q := db.queue(key)
+	if q.size() == 0 {
+		return nil, nil
+	}
+	seq := q.head
+	if back {
+		q.tail--
+		seq = q.tail
+	} else {
+		q.head++
+	}
+	item, _ := db.store.get(itemKey(key, seq))
+	b := new(batch)
+	b.del(itemKey(key, seq))
+	setQueue(b, key, q)
+	if err := db.store.write(b); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
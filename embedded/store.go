@@ -0,0 +1,349 @@
+package embedded
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+const (
+	opPut byte = 1
+	opDel byte = 2
+)
+
+// ErrCorrupted is returned by Open when a record of the log is damaged and
+// cannot be a write torn by a crash: other records follow it, or its
+// lengths run past the end of the log. The log is left as it is.
+var ErrCorrupted = errors.New("embedded: corrupted log")
+
+var errCorrupted = errors.New("embedded: corrupted record")
+
+// store is an ordered key-value map persisted in an append-only log. The
+// whole key space lives in memory, the log is replayed on open and can be
+// compacted to drop overwritten records.
+type store struct {
+	mutex sync.RWMutex
+	keys  []string
+	data  map[string]string
+	path  string
+	file  *os.File
+	w     *bufio.Writer
+	// sync makes every batch wait for the disk
+	sync bool
+}
+
+// A batch of writes applied atomically
+type batch struct {
+	ops []op
+}
+
+type op struct {
+	kind  byte
+	key   string
+	value string
+}
+
+func (b *batch) put(k, v string) {
+	b.ops = append(b.ops, op{opPut, k, v})
+}
+
+func (b *batch) del(k string) {
+	b.ops = append(b.ops, op{opDel, k, ""})
+}
+
+// Open the store persisted at path, an empty path keeps it in memory
+func openStore(path string) (*store, error) {
+	s := &store{data: make(map[string]string), path: path}
+	if path == "" {
+		return s, nil
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	size, err := s.replay(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	// drop a torn record left by a crash
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	s.file = f
+	s.w = bufio.NewWriter(f)
+	return s, nil
+}
+
+// Load the records of the log, it returns the size of the valid prefix. The
+// last record is dropped when its header is cut off or its checksum does not
+// match, as a crash in the middle of a write leaves it, a damaged record
+// elsewhere is an error.
+func (s *store) replay(f *os.File) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	total := info.Size()
+	r := bufio.NewReader(f)
+	var size int64
+	for size < total {
+		o, n, err := readRecord(r, total-size)
+		if err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err == errCorrupted {
+			if size+int64(n) >= total {
+				break
+			}
+			return 0, fmt.Errorf("%w at offset %d", ErrCorrupted, size)
+		}
+		if err != nil {
+			return 0, err
+		}
+		s.apply(o)
+		size += int64(n)
+	}
+	for k := range s.data {
+		s.keys = append(s.keys, k)
+	}
+	sort.Strings(s.keys)
+	return size, nil
+}
+
+// Record layout: crc32 | kind | uvarint key len | uvarint value len | key | value
+func appendRecord(buf []byte, o op) []byte {
+	var body []byte
+	body = append(body, o.kind)
+	body = binary.AppendUvarint(body, uint64(len(o.key)))
+	body = binary.AppendUvarint(body, uint64(len(o.value)))
+	body = append(body, o.key...)
+	body = append(body, o.value...)
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(body))
+	return append(buf, body...)
+}
+
+// Read a record from the remaining bytes of the log. The size of the record
+// is returned with errCorrupted, or 0 when its lengths run past the end of
+// the log. io.ErrUnexpectedEOF means its header is cut off by the end of
+// the log.
+func readRecord(r *bufio.Reader, remaining int64) (op, int, error) {
+	var head [4]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return op{}, 0, io.ErrUnexpectedEOF
+	}
+	kind, err := r.ReadByte()
+	if err != nil {
+		return op{}, 0, io.ErrUnexpectedEOF
+	}
+	klen, err := readLength(r)
+	if err != nil {
+		return op{}, 0, err
+	}
+	vlen, err := readLength(r)
+	if err != nil {
+		return op{}, 0, err
+	}
+	var body []byte
+	body = append(body, kind)
+	body = binary.AppendUvarint(body, klen)
+	body = binary.AppendUvarint(body, vlen)
+	// the lengths are checked before allocating, a damaged header could
+	// claim gigabytes
+	left := uint64(remaining) - uint64(4+len(body))
+	if klen > left || vlen > left-klen {
+		return op{}, 0, errCorrupted
+	}
+	payload := make([]byte, klen+vlen)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return op{}, 0, io.ErrUnexpectedEOF
+	}
+	body = append(body, payload...)
+	n := 4 + len(body)
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(head[:]) {
+		return op{}, n, errCorrupted
+	}
+	if kind != opPut && kind != opDel {
+		return op{}, n, errCorrupted
+	}
+	o := op{kind: kind, key: string(payload[:klen]), value: string(payload[klen:])}
+	return o, n, nil
+}
+
+// A length cut by the end of the log is torn, an invalid one corrupted
+func readLength(r *bufio.Reader) (uint64, error) {
+	n, err := binary.ReadUvarint(r)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return 0, errCorrupted
+	}
+	return n, nil
+}
+
+// Apply a replayed operation to the map, the key index is built afterwards
+func (s *store) apply(o op) {
+	switch o.kind {
+	case opPut:
+		s.data[o.key] = o.value
+	case opDel:
+		delete(s.data, o.key)
+	}
+}
+
+func (s *store) get(k string) (string, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	v, ok := s.data[k]
+	return v, ok
+}
+
+// write logs the batch then applies it in memory
+func (s *store) write(b *batch) error {
+	if len(b.ops) == 0 {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.w != nil {
+		var buf []byte
+		for _, o := range b.ops {
+			buf = appendRecord(buf, o)
+		}
+		if _, err := s.w.Write(buf); err != nil {
+			return err
+		}
+		if err := s.w.Flush(); err != nil {
+			return err
+		}
+		if s.sync {
+			if err := s.file.Sync(); err != nil {
+				return err
+			}
+		}
+	}
+	for _, o := range b.ops {
+		s.set(o)
+	}
+	return nil
+}
+
+// Apply an operation keeping the key index sorted
+func (s *store) set(o op) {
+	_, exists := s.data[o.key]
+	i := sort.SearchStrings(s.keys, o.key)
+	switch o.kind {
+	case opPut:
+		if !exists {
+			s.keys = append(s.keys, "")
+			copy(s.keys[i+1:], s.keys[i:])
+			s.keys[i] = o.key
+		}
+		s.data[o.key] = o.value
+	case opDel:
+		if exists {
+			s.keys = append(s.keys[:i], s.keys[i+1:]...)
+			delete(s.data, o.key)
+		}
+	}
+}
+
+// scan calls fn on the keys of [start, end) in order, an empty end is open.
+// It stops when fn returns false.
+func (s *store) scan(start, end string, fn func(k, v string) bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for i := sort.SearchStrings(s.keys, start); i < len(s.keys); i++ {
+		k := s.keys[i]
+		if end != "" && k >= end {
+			return
+		}
+		if !fn(k, s.data[k]) {
+			return
+		}
+	}
+}
+
+// rscan calls fn on the keys of [end, start) in reverse order
+func (s *store) rscan(start, end string, fn func(k, v string) bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for i := sort.SearchStrings(s.keys, start) - 1; i >= 0; i-- {
+		k := s.keys[i]
+		if k < end {
+			return
+		}
+		if !fn(k, s.data[k]) {
+			return
+		}
+	}
+}
+
+// compact rewrites the log with the live keys only
+func (s *store) compact() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	tmp := s.path + ".compact"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, k := range s.keys {
+		if _, err := w.Write(appendRecord(nil, op{opPut, k, s.data[k]})); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := w.Flush(); err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	s.file.Close()
+	s.file = f
+	s.w = bufio.NewWriter(f)
+	return nil
+}
+
+func (s *store) close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.w.Flush()
+	if err2 := s.file.Sync(); err == nil {
+		err = err2
+	}
+	if err2 := s.file.Close(); err == nil {
+		err = err2
+	}
+	s.file = nil
+	s.w = nil
+	return err
+}
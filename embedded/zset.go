@@ -0,0 +1,307 @@
+package embedded
+
+import (
+	"encoding/binary"
+	"strconv"
+
+	"github.com/bububa/gossdb"
+)
+
+// Scores are stored big endian with the sign bit flipped so that the byte
+// order of the index keys is the numeric order
+func encodeScore(score int64) string {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(score)^1<<63)
+	return string(buf[:])
+}
+
+func decodeScore(s string) int64 {
+	return int64(binary.BigEndian.Uint64([]byte(s[:8])) ^ 1<<63)
+}
+
+// A member of a sorted set with its score
+type zentry struct {
+	member string
+	score  int64
+}
+
+func (db *DB) zscore(key, member string) (int64, bool) {
+	v, found := db.store.get(nested(zsetPrefix, key) + member)
+	if !found {
+		return 0, false
+	}
+	score, _ := strconv.ParseInt(v, 10, 64)
+	return score, true
+}
+
+// Set the scores of members and keep the index and the size up to date
+func (db *DB) zset(b *batch, key string, esMap map[string]int64) {
+	zp, sp := nested(zsetPrefix, key), nested(zscorePrefix, key)
+	n := db.size(zsizePrefix + key)
+	for member, score := range esMap {
+		if old, found := db.zscore(key, member); found {
+			b.del(sp + encodeScore(old) + member)
+		} else {
+			n++
+		}
+		b.put(zp+member, itoa(score))
+		b.put(sp+encodeScore(score)+member, "")
+	}
+	setSize(b, zsizePrefix+key, n)
+}
+
+func (db *DB) zdel(b *batch, key string, eleList []string) {
+	zp, sp := nested(zsetPrefix, key), nested(zscorePrefix, key)
+	n := db.size(zsizePrefix + key)
+	deleted := make(map[string]bool)
+	for _, member := range eleList {
+		if score, found := db.zscore(key, member); found && !deleted[member] {
+			deleted[member] = true
+			b.del(zp + member)
+			b.del(sp + encodeScore(score) + member)
+			n--
+		}
+	}
+	setSize(b, zsizePrefix+key, n)
+}
+
+// Walk the members of a sorted set by score, fn returns false to stop
+func (db *DB) zwalk(key string, reverse bool, fn func(e zentry) bool) {
+	sp := nested(zscorePrefix, key)
+	walk := func(k, v string) bool {
+		s := k[len(sp):]
+		return fn(zentry{s[8:], decodeScore(s)})
+	}
+	if reverse {
+		db.store.rscan(prefixEnd(sp), sp, walk)
+	} else {
+		db.store.scan(sp, prefixEnd(sp), walk)
+	}
+}
+
+func (db *DB) ZSet(key, ele string, score int) (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	b := new(batch)
+	db.zset(b, key, map[string]int64{ele: int64(score)})
+	return true, db.store.write(b)
+}
+
+// ZGet returns the score of ele as an int64 or nil when it is not found
+func (db *DB) ZGet(key, ele string) (interface{}, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	score, found := db.zscore(key, ele)
+	if !found {
+		return nil, nil
+	}
+	return score, nil
+}
+
+func (db *DB) ZDel(key, ele string) (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	b := new(batch)
+	db.zdel(b, key, []string{ele})
+	return true, db.store.write(b)
+}
+
+func (db *DB) ZIncr(key, ele string, num int) (int64, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	score, _ := db.zscore(key, ele)
+	score += int64(num)
+	b := new(batch)
+	db.zset(b, key, map[string]int64{ele: score})
+	return score, db.store.write(b)
+}
+
+func (db *DB) ZSize(key string) (int64, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.size(zsizePrefix + key), nil
+}
+
+func (db *DB) ZExists(key, ele string) (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	_, found := db.zscore(key, ele)
+	return found, nil
+}
+
+// ZList lists the names of the sorted sets in (startKey, endKey]
+func (db *DB) ZList(startKey, endKey string, limit int) ([]string, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.names(zsizePrefix, startKey, endKey, limit), nil
+}
+
+// Members with a score in [scoreStart, scoreEnd] after startEle, or in
+// [scoreEnd, scoreStart] before startEle in reverse order
+func (db *DB) zscan(key, startEle string, scoreStart, scoreEnd, limit int, reverse bool) []zentry {
+	sp := nested(zscorePrefix, key)
+	start, end := int64(scoreStart), int64(scoreEnd)
+	var res []zentry
+	walk := func(k, v string) bool {
+		if full(len(res), limit) {
+			return false
+		}
+		s := k[len(sp):]
+		res = append(res, zentry{s[8:], decodeScore(s)})
+		return true
+	}
+	if reverse {
+		hi := prefixEnd(sp + encodeScore(start))
+		if startEle != "" {
+			hi = sp + encodeScore(start) + startEle
+		}
+		db.store.rscan(hi, sp+encodeScore(end), walk)
+	} else {
+		lo := sp + encodeScore(start)
+		if startEle != "" {
+			lo += startEle + "\x00"
+		}
+		db.store.scan(lo, prefixEnd(sp+encodeScore(end)), walk)
+	}
+	return res
+}
+
+// ZKeys lists the members with a score in [scoreStart, scoreEnd] after startEle
+func (db *DB) ZKeys(key, startEle string, scoreStart, scoreEnd, limit int) ([]string, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	keyList := []string{}
+	for _, e := range db.zscan(key, startEle, scoreStart, scoreEnd, limit, false) {
+		keyList = append(keyList, e.member)
+	}
+	return keyList, nil
+}
+
+// ZScan returns the members with a score in [scoreStart, scoreEnd] after startEle
+func (db *DB) ZScan(key, startEle string, scoreStart, scoreEnd, limit int) (map[string]int64, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return entriesMap(db.zscan(key, startEle, scoreStart, scoreEnd, limit, false)), nil
+}
+
+// ZRScan returns the members with a score in [scoreEnd, scoreStart] before
+// startEle
+func (db *DB) ZRScan(key, startEle string, scoreStart, scoreEnd, limit int) (map[string]int64, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return entriesMap(db.zscan(key, startEle, scoreStart, scoreEnd, limit, true)), nil
+}
+
+func entriesMap(entries []zentry) map[string]int64 {
+	esMap := make(map[string]int64, len(entries))
+	for _, e := range entries {
+		esMap[e.member] = e.score
+	}
+	return esMap
+}
+
+// ZRank returns the position of ele by ascending score, -1 when not found
+func (db *DB) ZRank(key, ele string) (int64, error) {
+	return db.zrank(key, ele, false)
+}
+
+// ZRRank returns the position of ele by descending score, -1 when not found
+func (db *DB) ZRRank(key, ele string) (int64, error) {
+	return db.zrank(key, ele, true)
+}
+
+func (db *DB) zrank(key, ele string, reverse bool) (int64, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	rank, i := int64(-1), int64(0)
+	db.zwalk(key, reverse, func(e zentry) bool {
+		if e.member == ele {
+			rank = i
+			return false
+		}
+		i++
+		return true
+	})
+	return rank, nil
+}
+
+// ZRange lists limit members from offset by ascending score as
+// [member, score] pairs
+func (db *DB) ZRange(key string, offset, limit int) ([][2]interface{}, error) {
+	return db.zrange(key, offset, limit, false)
+}
+
+// ZRRange lists limit members from offset by descending score
+func (db *DB) ZRRange(key string, offset, limit int) ([][2]interface{}, error) {
+	return db.zrange(key, offset, limit, true)
+}
+
+func (db *DB) zrange(key string, offset, limit int, reverse bool) ([][2]interface{}, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	esList := [][2]interface{}{}
+	i := 0
+	db.zwalk(key, reverse, func(e zentry) bool {
+		if full(len(esList), limit) {
+			return false
+		}
+		if i >= offset {
+			esList = append(esList, [2]interface{}{e.member, int(e.score)})
+		}
+		i++
+		return true
+	})
+	return esList, nil
+}
+
+func (db *DB) ZClear(key string) (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	b := new(batch)
+	db.clear(b, nested(zsetPrefix, key))
+	db.clear(b, nested(zscorePrefix, key))
+	b.del(zsizePrefix + key)
+	return true, db.store.write(b)
+}
+
+func (db *DB) MultiZSet(key string, esMap map[string]int) (bool, error) {
+	if len(esMap) == 0 {
+		return false, gossdb.ErrNotEnoughParams
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	scores := make(map[string]int64, len(esMap))
+	for member, score := range esMap {
+		scores[member] = int64(score)
+	}
+	b := new(batch)
+	db.zset(b, key, scores)
+	return true, db.store.write(b)
+}
+
+// MultiZGet returns the scores of the members found
+func (db *DB) MultiZGet(key string, eleList []string) (map[string]int64, error) {
+	if len(eleList) == 0 {
+		return nil, gossdb.ErrNotEnoughParams
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	esMap := map[string]int64{}
+	for _, member := range eleList {
+		if score, found := db.zscore(key, member); found {
+			esMap[member] = score
+		}
+	}
+	return esMap, nil
+}
+
+func (db *DB) MultiZDel(key string, eleList []string) (bool, error) {
+	if len(eleList) == 0 {
+		return false, gossdb.ErrNotEnoughParams
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	b := new(batch)
+	db.zdel(b, key, eleList)
+	return true, db.store.write(b)
+}
@@ -0,0 +1,171 @@
+package gossdb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"sync"
+)
+
+// Version byte starting an encrypted value, followed by the length of the
+// key id, the key id, the nonce and the sealed value
+const encryptedV1 = 0xE1
+
+var (
+	ErrDecrypt    = fmt.Errorf("decryption failed")
+	ErrUnknownKey = fmt.Errorf("unknown encryption key")
+)
+
+// KeyProvider gives the AES keys of an Encryptor. Values are encrypted with
+// the current key and carry its id, so after a rotation the values written
+// with the previous keys are still read. An id must not be reused for
+// another key.
+type KeyProvider interface {
+	// CurrentKey returns the id and the 16, 24 or 32 bytes key encrypting
+	// new values
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key of id, ErrUnknownKey when there is none
+	Key(id string) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider holding its keys in memory
+type StaticKeys struct {
+	current string
+	keys    map[string][]byte
+}
+
+func NewStaticKeys(current string, keys map[string][]byte) (*StaticKeys, error) {
+	if _, found := keys[current]; !found {
+		return nil, ErrUnknownKey
+	}
+	for id, key := range keys {
+		if len(id) > 255 {
+			return nil, fmt.Errorf("key id %q longer than 255 bytes", id)
+		}
+		if _, err := aes.NewCipher(key); err != nil {
+			return nil, fmt.Errorf("key %q: %v", id, err)
+		}
+	}
+	return &StaticKeys{current: current, keys: keys}, nil
+}
+
+func (s *StaticKeys) CurrentKey() (string, []byte, error) {
+	return s.current, s.keys[s.current], nil
+}
+
+func (s *StaticKeys) Key(id string) ([]byte, error) {
+	key, found := s.keys[id]
+	if !found {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// Encryptor encrypts the values of the KV and hash commands with AES-GCM,
+// keys and names stay in clear. By default every value is encrypted,
+// SetSelector limits it to the sensitive keys. Values read without the
+// 0xE1 version byte are returned as they are, so plain values written
+// before or beside it stay readable. To compress values as well wrap it in
+// a Compressor, encrypted values do not compress.
+type Encryptor struct {
+	*valueFilter
+	keys     KeyProvider
+	mutex    sync.RWMutex
+	selector func(name string) bool
+	// AEAD by key id
+	aeads sync.Map
+}
+
+func NewEncryptor(c Commander, keys KeyProvider) *Encryptor {
+	e := &Encryptor{keys: keys}
+	e.valueFilter = &valueFilter{Commander: c, encode: e.encrypt, decode: e.decrypt, selected: e.selected}
+	return e
+}
+
+// SetSelector encrypts only the values of the keys, and of the fields of
+// the hashes, whose name fn returns true for, nil encrypts them all
+//
+//	e.SetSelector(func(name string) bool { return strings.HasPrefix(name, "user:") })
+func (e *Encryptor) SetSelector(fn func(name string) bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.selector = fn
+}
+
+func (e *Encryptor) selected(name string) bool {
+	e.mutex.RLock()
+	fn := e.selector
+	e.mutex.RUnlock()
+	return fn == nil || fn(name)
+}
+
+func (e *Encryptor) aead(id string, key []byte) (cipher.AEAD, error) {
+	if aead, found := e.aeads.Load(id); found {
+		return aead.(cipher.AEAD), nil
+	}
+	if key == nil {
+		var err error
+		if key, err = e.keys.Key(id); err != nil {
+			return nil, err
+		}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	e.aeads.Store(id, aead)
+	return aead, nil
+}
+
+func (e *Encryptor) encrypt(v string) (string, error) {
+	id, key, err := e.keys.CurrentKey()
+	if err != nil {
+		return "", err
+	}
+	if len(id) > 255 {
+		return "", fmt.Errorf("key id %q longer than 255 bytes", id)
+	}
+	aead, err := e.aead(id, key)
+	if err != nil {
+		return "", err
+	}
+	header := append([]byte{encryptedV1, byte(len(id))}, id...)
+	buf := make([]byte, len(header)+aead.NonceSize(), len(header)+aead.NonceSize()+len(v)+aead.Overhead())
+	copy(buf, header)
+	nonce := buf[len(header):]
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	// the header is authenticated so the key id cannot be swapped
+	return string(aead.Seal(buf, nonce, []byte(v), header)), nil
+}
+
+// Values without the version byte are plain
+func (e *Encryptor) decrypt(v string) (string, error) {
+	if len(v) == 0 || v[0] != encryptedV1 {
+		return v, nil
+	}
+	if len(v) < 2 || len(v) < 2+int(v[1]) {
+		return "", ErrDecrypt
+	}
+	n := 2 + int(v[1])
+	header, id := v[:n], v[2:n]
+	aead, err := e.aead(id, nil)
+	if err != nil {
+		return "", err
+	}
+	if len(v) < n+aead.NonceSize() {
+		return "", ErrDecrypt
+	}
+	nonce, sealed := v[n:n+aead.NonceSize()], v[n+aead.NonceSize():]
+	data, err := aead.Open(nil, []byte(nonce), []byte(sealed), []byte(header))
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	return string(data), nil
+}
@@ -0,0 +1,174 @@
+package gossdb_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bububa/gossdb"
+)
+
+func staticKeys(t *testing.T, current string, ids ...string) *gossdb.StaticKeys {
+	t.Helper()
+	keys := make(map[string][]byte)
+	for _, id := range ids {
+		keys[id] = bytes.Repeat([]byte(id[:1]), 32)
+	}
+	s, err := gossdb.NewStaticKeys(current, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestEncryptor(t *testing.T) {
+	_, c := newTestClient(t)
+	e := gossdb.NewEncryptor(c, staticKeys(t, "a1", "a1"))
+	for _, k := range []string{"x", "y"} {
+		if _, err := e.Set(k, "secret"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	x, _ := c.Get("x")
+	y, _ := c.Get("y")
+	if s := x.(string); s[0] != 0xE1 || strings.Contains(s, "secret") {
+		t.Fatalf("stored %q, want it encrypted", s)
+	}
+	if x == y {
+		t.Fatal("same ciphertext twice, the nonce is reused")
+	}
+	if v, err := e.Get("x"); v != "secret" || err != nil {
+		t.Fatalf("get = %v, %v", v, err)
+	}
+	if v, err := e.Get("missing"); v != nil || err != nil {
+		t.Fatalf("get missing = %v, %v", v, err)
+	}
+
+	if _, err := e.MultiHSet("h", map[string]string{"f": "v1", "g": "v2"}); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := e.MultiHGet("h", []string{"f", "g"}); err != nil || m["f"] != "v1" || m["g"] != "v2" {
+		t.Fatalf("multi_hget = %v, %v", m, err)
+	}
+	pairs, err := e.MultiGet("x", "y")
+	if err != nil || len(pairs) != 2 || pairs[0].Value != "secret" {
+		t.Fatalf("multi_get = %v, %v", pairs, err)
+	}
+	// a plain value is read as it is
+	if _, err := c.Set("plain", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := e.Get("plain"); v != "value" || err != nil {
+		t.Fatalf("get of a plain value = %v, %v", v, err)
+	}
+}
+
+func TestEncryptorSelector(t *testing.T) {
+	_, c := newTestClient(t)
+	e := gossdb.NewEncryptor(c, staticKeys(t, "a1", "a1"))
+	if _, err := e.Set("secret:old", "v"); err != nil {
+		t.Fatal(err)
+	}
+	e.SetSelector(func(name string) bool { return strings.HasPrefix(name, "secret:") })
+	for _, k := range []string{"public", "secret:new"} {
+		if _, err := e.Set(k, "v"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := e.HSet(k, "f", "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v, _ := c.Get("public"); v != "v" {
+		t.Fatalf("stored %q, want the value of public in clear", v)
+	}
+	if v, _ := c.HGet("public", "f"); v != "v" {
+		t.Fatalf("stored %q, want the field of public in clear", v)
+	}
+	if v, _ := c.Get("secret:new"); v == "v" {
+		t.Fatal("value of secret:new stored in clear")
+	}
+	if v, _ := c.HGet("secret:new", "f"); v == "v" {
+		t.Fatal("field of secret:new stored in clear")
+	}
+	// a scan over encrypted and plain values
+	pairs, err := e.Scan("", "", 10)
+	if err != nil || len(pairs) != 3 {
+		t.Fatalf("scan = %q, %v", pairs, err)
+	}
+	for _, p := range pairs {
+		if p[1] != "v" {
+			t.Fatalf("scan = %q, want every value decrypted", pairs)
+		}
+	}
+}
+
+func TestEncryptorRotation(t *testing.T) {
+	_, c := newTestClient(t)
+	old := gossdb.NewEncryptor(c, staticKeys(t, "a1", "a1"))
+	if _, err := old.Set("k", "before"); err != nil {
+		t.Fatal(err)
+	}
+	rotated := gossdb.NewEncryptor(c, staticKeys(t, "b2", "a1", "b2"))
+	if v, err := rotated.Get("k"); v != "before" || err != nil {
+		t.Fatalf("get of a value of the previous key = %v, %v", v, err)
+	}
+	if _, err := rotated.Set("k2", "after"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := old.Get("k2"); err != gossdb.ErrUnknownKey {
+		t.Fatalf("get with a provider lacking the key = %v, want %v", err, gossdb.ErrUnknownKey)
+	}
+}
+
+func TestEncryptorTampering(t *testing.T) {
+	_, c := newTestClient(t)
+	e := gossdb.NewEncryptor(c, staticKeys(t, "a1", "a1", "b1"))
+	if _, err := e.Set("k", "value"); err != nil {
+		t.Fatal(err)
+	}
+	v, _ := c.Get("k")
+	stored := v.(string)
+	tampered := map[string]string{
+		"sealed":    stored[:len(stored)-1] + string(stored[len(stored)-1]^1),
+		"key id":    stored[:2] + "b1" + stored[4:],
+		"truncated": stored[:10],
+		"header":    stored[:1] + "\xff",
+	}
+	for name, s := range tampered {
+		if _, err := c.Set("k", s); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := e.Get("k"); err != gossdb.ErrDecrypt {
+			t.Errorf("%s: get = %v, want %v", name, err, gossdb.ErrDecrypt)
+		}
+	}
+}
+
+func TestStaticKeys(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 16)
+	if _, err := gossdb.NewStaticKeys("missing", map[string][]byte{"a": key}); err != gossdb.ErrUnknownKey {
+		t.Fatalf("missing current key = %v", err)
+	}
+	if _, err := gossdb.NewStaticKeys("a", map[string][]byte{"a": key[:5]}); err == nil {
+		t.Fatal("key of 5 bytes accepted")
+	}
+	long := strings.Repeat("i", 256)
+	if _, err := gossdb.NewStaticKeys(long, map[string][]byte{long: key}); err == nil {
+		t.Fatal("id of 256 bytes accepted")
+	}
+}
+
+func TestCompressedEncryption(t *testing.T) {
+	_, c := newTestClient(t)
+	z := gossdb.NewCompressor(gossdb.NewEncryptor(c, staticKeys(t, "a1", "a1")), gossdb.Gzip)
+	large := strings.Repeat("compressed then encrypted ", 100)
+	if _, err := z.Set("k", large); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := c.Get("k"); len(v.(string)) >= len(large) {
+		t.Fatalf("stored %d bytes, want the value compressed before encryption", len(v.(string)))
+	}
+	if v, err := z.Get("k"); v != large || err != nil {
+		t.Fatalf("get = %.20q, %v", v, err)
+	}
+}
@@ -0,0 +1,139 @@
+package gossdb_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bububa/gossdb"
+	"github.com/bububa/gossdb/ssdbtest"
+)
+
+func newFaultClient(t *testing.T) (*ssdbtest.Server, *gossdb.Client, *int) {
+	t.Helper()
+	srv := ssdbtest.NewServer()
+	t.Cleanup(func() { srv.Close() })
+	c, err := gossdb.Connect(srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	retries := new(int)
+	c.Use(func(next gossdb.Handler) gossdb.Handler {
+		return func(ctx context.Context, cmd *gossdb.Command) ([]string, error) {
+			resp, err := next(ctx, cmd)
+			*retries = cmd.Retries
+			return resp, err
+		}
+	})
+	if _, err := c.Set("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	return srv, c, retries
+}
+
+func expectValue(t *testing.T, c *gossdb.Client, want string) {
+	t.Helper()
+	v, err := c.Get("k")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if v != want {
+		t.Fatalf("get = %v, want %q", v, want)
+	}
+}
+
+func TestFaultDrop(t *testing.T) {
+	srv, c, retries := newFaultClient(t)
+	srv.InjectFault(ssdbtest.Fault{Kind: ssdbtest.FaultDrop}, 1)
+	expectValue(t, c, "v")
+	if *retries != 1 {
+		t.Fatalf("retries = %d, want 1", *retries)
+	}
+}
+
+func TestFaultDropMidReply(t *testing.T) {
+	srv, c, retries := newFaultClient(t)
+	srv.InjectFault(ssdbtest.Fault{Kind: ssdbtest.FaultDropMidReply}, 2)
+	expectValue(t, c, "v")
+	if *retries != 2 {
+		t.Fatalf("retries = %d, want 2", *retries)
+	}
+}
+
+func TestFaultDropExhaustsRetries(t *testing.T) {
+	srv, c, retries := newFaultClient(t)
+	srv.InjectFault(ssdbtest.Fault{Kind: ssdbtest.FaultDrop}, gossdb.MAX_RETRIES+1)
+	if _, err := c.Get("k"); err == nil {
+		t.Fatal("get succeeded, want an error")
+	}
+	if *retries != gossdb.MAX_RETRIES {
+		t.Fatalf("retries = %d, want %d", *retries, gossdb.MAX_RETRIES)
+	}
+	expectValue(t, c, "v")
+}
+
+func TestFaultPartialWrite(t *testing.T) {
+	srv, c, retries := newFaultClient(t)
+	srv.InjectFault(ssdbtest.Fault{Kind: ssdbtest.FaultPartialWrite, Bytes: 1, Delay: time.Millisecond}, 1)
+	expectValue(t, c, "v")
+	if *retries != 0 {
+		t.Fatalf("retries = %d, want 0", *retries)
+	}
+}
+
+func TestFaultSlowReply(t *testing.T) {
+	srv, c, retries := newFaultClient(t)
+	c.SetTimeout(50 * time.Millisecond)
+	srv.InjectFault(ssdbtest.Fault{Kind: ssdbtest.FaultSlowReply, Delay: 200 * time.Millisecond}, 1)
+	expectValue(t, c, "v")
+	if *retries != 1 {
+		t.Fatalf("retries = %d, want 1", *retries)
+	}
+
+	srv.InjectFault(ssdbtest.Fault{Kind: ssdbtest.FaultSlowReply, Delay: 200 * time.Millisecond}, gossdb.MAX_RETRIES+1)
+	_, err := c.Get("k")
+	if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Fatalf("get error = %v, want a timeout", err)
+	}
+}
+
+func TestFaultMalformedHeader(t *testing.T) {
+	srv, c, retries := newFaultClient(t)
+	srv.InjectFault(ssdbtest.Fault{Kind: ssdbtest.FaultMalformedHeader}, 1)
+	if _, err := c.Get("k"); err != gossdb.ErrMalformedReply {
+		t.Fatalf("get error = %v, want %v", err, gossdb.ErrMalformedReply)
+	}
+	if *retries != 0 {
+		t.Fatalf("retries = %d, want 0", *retries)
+	}
+	expectValue(t, c, "v")
+}
+
+func TestFaultOversizedReply(t *testing.T) {
+	srv, c, _ := newFaultClient(t)
+	c.SetMaxReplySize(1024)
+	srv.InjectFault(ssdbtest.Fault{Kind: ssdbtest.FaultOversizedReply, Bytes: 1 << 20}, 1)
+	if _, err := c.Get("k"); err != gossdb.ErrReplyTooLarge {
+		t.Fatalf("get error = %v, want %v", err, gossdb.ErrReplyTooLarge)
+	}
+	expectValue(t, c, "v")
+}
+
+func TestServerClosesConnections(t *testing.T) {
+	srv, c, retries := newFaultClient(t)
+	srv.CloseClientConnections()
+	expectValue(t, c, "v")
+	if *retries != 1 {
+		t.Fatalf("retries = %d, want 1", *retries)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	_, c, _ := newFaultClient(t)
+	if err := c.Reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, c, "v")
+}
@@ -0,0 +1,210 @@
+package gossdb
+
+import (
+	"fmt"
+)
+
+// valueFilter rewrites the values written and read by the KV and hash
+// commands of a Commander, the other commands go through unchanged
+type valueFilter struct {
+	Commander
+	encode func(v string) (string, error)
+	decode func(v string) (string, error)
+	// selects the keys and hashes whose values are encoded, all when nil
+	selected func(name string) bool
+}
+
+// Codec returns the codec of the underlying Commander
+func (f *valueFilter) Codec() Codec {
+	return codecOf(f.Commander)
+}
+
+// The string sent for a value, as formatted by the protocol
+func valueString(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case int, int32, int64, uint, uint32, uint64:
+		return fmt.Sprintf("%d", v), true
+	case float32, float64:
+		return fmt.Sprintf("%f", v), true
+	case bool:
+		if v {
+			return "1", true
+		}
+		return "0", true
+	case nil:
+		return "", true
+	}
+	return "", false
+}
+
+// Encode a value of the key or hash name
+func (f *valueFilter) encodeValue(name, v string) (string, error) {
+	if f.selected != nil && !f.selected(name) {
+		return v, nil
+	}
+	return f.encode(v)
+}
+
+// Decode a value read by a command, nil when it was not found
+func (f *valueFilter) decodeValue(v interface{}, err error) (interface{}, error) {
+	if err != nil || v == nil {
+		return v, err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return v, nil
+	}
+	return f.decode(s)
+}
+
+func (f *valueFilter) Set(key string, val string) (bool, error) {
+	v, err := f.encodeValue(key, val)
+	if err != nil {
+		return false, err
+	}
+	return f.Commander.Set(key, v)
+}
+
+func (f *valueFilter) Setx(key string, val string, ttl int32) (bool, error) {
+	v, err := f.encodeValue(key, val)
+	if err != nil {
+		return false, err
+	}
+	return f.Commander.Setx(key, v, ttl)
+}
+
+func (f *valueFilter) Setnx(key string, val string) (bool, error) {
+	v, err := f.encodeValue(key, val)
+	if err != nil {
+		return false, err
+	}
+	return f.Commander.Setnx(key, v)
+}
+
+func (f *valueFilter) Get(key string) (interface{}, error) {
+	return f.decodeValue(f.Commander.Get(key))
+}
+
+func (f *valueFilter) Getset(key string, val string) (interface{}, error) {
+	v, err := f.encodeValue(key, val)
+	if err != nil {
+		return nil, err
+	}
+	return f.decodeValue(f.Commander.Getset(key, v))
+}
+
+func (f *valueFilter) MultiSet(ps ...*KVPair) (bool, error) {
+	pairs := make([]*KVPair, len(ps))
+	for i, p := range ps {
+		s, ok := valueString(p.Value)
+		if !ok {
+			return false, fmt.Errorf("bad request:%v", p.Value)
+		}
+		v, err := f.encodeValue(p.Key, s)
+		if err != nil {
+			return false, err
+		}
+		pairs[i] = &KVPair{Key: p.Key, Value: v}
+	}
+	return f.Commander.MultiSet(pairs...)
+}
+
+// MultiGet decodes the pairs read, the pairs of the healthy shards of a
+// Cluster come with its MultiError
+func (f *valueFilter) MultiGet(ks ...string) ([]*KVPair, error) {
+	pairs, err := f.Commander.MultiGet(ks...)
+	if pairs == nil {
+		return nil, err
+	}
+	// the pairs may be shared, a cache keeps them for instance
+	res := make([]*KVPair, len(pairs))
+	for i, p := range pairs {
+		v, derr := f.decodeValue(p.Value, nil)
+		if derr != nil {
+			return nil, derr
+		}
+		res[i] = &KVPair{Key: p.Key, Value: v}
+	}
+	return res, err
+}
+
+func (f *valueFilter) MultiGetOrdered(ks ...string) ([]*KVResult, error) {
+	pairs, err := f.MultiGet(ks...)
+	if err != nil && pairs == nil {
+		return nil, err
+	}
+	return alignPairs(ks, pairs), err
+}
+
+func (f *valueFilter) MultiGetMap(ks ...string) (map[string]interface{}, error) {
+	pairs, err := f.MultiGet(ks...)
+	if err != nil && pairs == nil {
+		return nil, err
+	}
+	return pairsMap(pairs), err
+}
+
+func (f *valueFilter) Scan(startKey string, endKey string, limit int) ([][2]string, error) {
+	return f.decodePairs(f.Commander.Scan(startKey, endKey, limit))
+}
+
+func (f *valueFilter) decodePairs(list [][2]string, err error) ([][2]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if list[i][1], err = f.decode(list[i][1]); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+func (f *valueFilter) HSet(key, field, val string) (bool, error) {
+	v, err := f.encodeValue(key, val)
+	if err != nil {
+		return false, err
+	}
+	return f.Commander.HSet(key, field, v)
+}
+
+func (f *valueFilter) HGet(key, field string) (interface{}, error) {
+	return f.decodeValue(f.Commander.HGet(key, field))
+}
+
+func (f *valueFilter) HScan(key, startField, endField string, limit int) ([][2]string, error) {
+	return f.decodePairs(f.Commander.HScan(key, startField, endField, limit))
+}
+
+func (f *valueFilter) HRScan(key, startField, endField string, limit int) ([][2]string, error) {
+	return f.decodePairs(f.Commander.HRScan(key, startField, endField, limit))
+}
+
+func (f *valueFilter) MultiHSet(key string, fvMap map[string]string) (bool, error) {
+	m := make(map[string]string, len(fvMap))
+	for field, val := range fvMap {
+		v, err := f.encodeValue(key, val)
+		if err != nil {
+			return false, err
+		}
+		m[field] = v
+	}
+	return f.Commander.MultiHSet(key, m)
+}
+
+func (f *valueFilter) MultiHGet(key string, fieldList []string) (map[string]string, error) {
+	fvMap, err := f.Commander.MultiHGet(key, fieldList)
+	if err != nil {
+		return nil, err
+	}
+	for field, val := range fvMap {
+		if fvMap[field], err = f.decode(val); err != nil {
+			return nil, err
+		}
+	}
+	return fvMap, nil
+}
@@ -0,0 +1,289 @@
+package gossdb
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A struct field stored as a hash field
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// Fields by struct type
+var structFields sync.Map
+
+// Fields of a struct type, named by their ssdb tag or their Go name.
+// Embedded structs without a tag are flattened as with encoding/json,
+// except pointers to unexported structs which could not be allocated.
+func fieldsOf(t reflect.Type) []structField {
+	if fields, found := structFields.Load(t); found {
+		return fields.([]structField)
+	}
+	fields := typeFields(t, map[reflect.Type]bool{})
+	structFields.Store(t, fields)
+	return fields
+}
+
+// The fields of t, the embedded structs of the types in visiting are
+// skipped so a type embedding itself ends
+func typeFields(t reflect.Type, visiting map[reflect.Type]bool) []structField {
+	visiting[t] = true
+	defer delete(visiting, t)
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, tagged := f.Tag.Lookup("ssdb")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && !tagged {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if (f.PkgPath != "" && f.Type.Kind() == reflect.Ptr) || visiting[ft] {
+					continue
+				}
+				for _, sf := range typeFields(ft, visiting) {
+					sf.index = append([]int{i}, sf.index...)
+					fields = append(fields, sf)
+				}
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		omitEmpty := false
+		for _, opt := range strings.Split(opts, ",") {
+			omitEmpty = omitEmpty || opt == "omitempty"
+		}
+		fields = append(fields, structField{name: name, index: f.Index, omitEmpty: omitEmpty})
+	}
+	return fields
+}
+
+func structOf(v interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return rv, fmt.Errorf("%T is not a struct", v)
+	}
+	return rv, nil
+}
+
+// Field of v at index, nil when it goes through a nil embedded pointer
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return v, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+var textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// Format a field value: numbers in decimal, bools as 1 or 0, types with a
+// text form such as time.Time in it and other types in JSON
+func formatField(v reflect.Value) (string, error) {
+	if v.Type().Implements(textMarshaler) && (v.Kind() != reflect.Ptr || !v.IsNil()) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return "1", nil
+		}
+		return "0", nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), nil
+		}
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return formatField(v.Elem())
+		}
+	}
+	data, err := json.Marshal(v.Interface())
+	return string(data), err
+}
+
+var textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// Parse a value written by formatField into v
+func parseField(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return parseField(v.Elem(), s)
+	}
+	if reflect.PtrTo(v.Type()).Implements(textUnmarshaler) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err == nil {
+			v.SetInt(n)
+		}
+		return err
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err == nil {
+			v.SetUint(n)
+		}
+		return err
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err == nil {
+			v.SetFloat(f)
+		}
+		return err
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err == nil {
+			v.SetBool(b)
+		}
+		return err
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(s))
+			return nil
+		}
+	}
+	return json.Unmarshal([]byte(s), v.Addr().Interface())
+}
+
+// HSetStruct writes the fields of the struct v to the hash name with one
+// multi_hset. A field is named by its ssdb tag, `ssdb:"-"` skips it and
+// `ssdb:"name,omitempty"` skips it when it is the zero value. Nil pointers
+// are skipped as well. The skipped fields are removed from the hash with a
+// multi_hdel, so HGetStruct does not read back their previous values, the
+// fields tagged "-" are left as they are. Structs, maps and slices other
+// than []byte are stored in JSON.
+func HSetStruct(c Hash, name string, v interface{}) (bool, error) {
+	rv, err := structOf(v)
+	if err != nil {
+		return false, err
+	}
+	fvMap := make(map[string]string)
+	var skipped []string
+	for _, f := range fieldsOf(rv.Type()) {
+		fv, ok := fieldByIndex(rv, f.index, false)
+		if !ok || (f.omitEmpty && fv.IsZero()) || (fv.Kind() == reflect.Ptr && fv.IsNil()) {
+			skipped = append(skipped, f.name)
+			continue
+		}
+		s, err := formatField(fv)
+		if err != nil {
+			return false, fmt.Errorf("%s: %v", f.name, err)
+		}
+		fvMap[f.name] = s
+	}
+	ok := true
+	if len(fvMap) > 0 {
+		if ok, err = c.MultiHSet(name, fvMap); err != nil {
+			return false, err
+		}
+	}
+	if len(skipped) > 0 {
+		if _, err := c.MultiHDel(name, skipped); err != nil {
+			return false, err
+		}
+	}
+	return ok, nil
+}
+
+// HGetStruct reads the hash name into the struct v points to, the fields
+// missing from the hash are left unchanged. It returns ErrNotFound when
+// none of them is in the hash.
+func HGetStruct(c Hash, name string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%T is not a pointer to a struct", v)
+	}
+	rv = rv.Elem()
+	fields := fieldsOf(rv.Type())
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.name
+	}
+	fvMap, err := c.MultiHGet(name, names)
+	if err != nil {
+		return err
+	}
+	if len(fvMap) == 0 {
+		return ErrNotFound
+	}
+	for _, f := range fields {
+		s, found := fvMap[f.name]
+		if !found {
+			continue
+		}
+		fv, _ := fieldByIndex(rv, f.index, true)
+		if err := parseField(fv, s); err != nil {
+			return fmt.Errorf("%s: %v", f.name, err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) HSetStruct(name string, v interface{}) (bool, error) {
+	return HSetStruct(c, name, v)
+}
+
+func (c *Client) HGetStruct(name string, v interface{}) error {
+	return HGetStruct(c, name, v)
+}
+
+func (c *Cluster) HSetStruct(name string, v interface{}) (bool, error) {
+	return HSetStruct(c, name, v)
+}
+
+func (c *Cluster) HGetStruct(name string, v interface{}) error {
+	return HGetStruct(c, name, v)
+}
+
+func (p *Pool) HSetStruct(name string, v interface{}) (bool, error) {
+	return HSetStruct(p, name, v)
+}
+
+func (p *Pool) HGetStruct(name string, v interface{}) error {
+	return HGetStruct(p, name, v)
+}
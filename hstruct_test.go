@@ -0,0 +1,186 @@
+package gossdb_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bububa/gossdb"
+)
+
+type Audit struct {
+	Created time.Time `ssdb:"created"`
+}
+
+type Owner struct {
+	Owner string `ssdb:"owner"`
+}
+
+type hidden struct {
+	Hidden string
+}
+
+type profile struct {
+	Audit
+	*Owner
+	*hidden
+
+	Name     string                `ssdb:"name"`
+	Age      int8                  `ssdb:"age"`
+	Balance  int64                 `ssdb:"balance"`
+	Visits   uint32                `ssdb:"visits"`
+	Score    float64               `ssdb:"score"`
+	Ratio    float32               `ssdb:"ratio"`
+	Active   bool                  `ssdb:"active"`
+	Raw      []byte                `ssdb:"raw"`
+	Tags     []string              `ssdb:"tags"`
+	Attrs    map[string]int        `ssdb:"attrs"`
+	Address  struct{ City string } `ssdb:"address"`
+	Nickname *string               `ssdb:"nickname"`
+	Manager  *int                  `ssdb:"manager"`
+	Note     string                `ssdb:"note,string,omitempty"`
+	Secret   string                `ssdb:"-"`
+	Default  string
+	private  string
+}
+
+func TestHStructRoundTrip(t *testing.T) {
+	_, c := newTestClient(t)
+	nick := "al"
+	in := profile{
+		Audit:    Audit{Created: time.Date(2024, 2, 29, 12, 30, 0, 500, time.UTC)},
+		Owner:    &Owner{Owner: "bob"},
+		Name:     "alice",
+		Age:      -3,
+		Balance:  -1 << 40,
+		Visits:   1 << 31,
+		Score:    0.1,
+		Ratio:    1.5,
+		Active:   true,
+		Raw:      []byte{0, 1, 0xff},
+		Tags:     []string{"a", "b"},
+		Attrs:    map[string]int{"x": 1},
+		Nickname: &nick,
+		Default:  "d",
+		Secret:   "s",
+		private:  "p",
+	}
+	in.Address.City = "Paris"
+	if _, err := c.HSetStruct("p", &in); err != nil {
+		t.Fatal(err)
+	}
+	fvList, err := c.HScan("p", "", "", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := make(map[string]string)
+	for _, fv := range fvList {
+		fields[fv[0]] = fv[1]
+	}
+	want := map[string]string{
+		"created":  "2024-02-29T12:30:00.0000005Z",
+		"owner":    "bob",
+		"name":     "alice",
+		"age":      "-3",
+		"balance":  "-1099511627776",
+		"visits":   "2147483648",
+		"score":    "0.1",
+		"ratio":    "1.5",
+		"active":   "1",
+		"raw":      "\x00\x01\xff",
+		"tags":     `["a","b"]`,
+		"attrs":    `{"x":1}`,
+		"address":  `{"City":"Paris"}`,
+		"nickname": "al",
+		"Default":  "d",
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Fatalf("stored %q, want %q", fields, want)
+	}
+
+	var out profile
+	if err := c.HGetStruct("p", &out); err != nil {
+		t.Fatal(err)
+	}
+	in.Secret, in.private = "", ""
+	if !reflect.DeepEqual(out, in) {
+		t.Fatalf("read %+v, want %+v", out, in)
+	}
+}
+
+func TestHStructEmpty(t *testing.T) {
+	_, c := newTestClient(t)
+	// nil pointers and omitempty fields are not written
+	if _, err := c.HSetStruct("p", profile{Name: "n"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"nickname", "manager", "note", "owner"} {
+		if ok, _ := c.HExists("p", f); ok {
+			t.Errorf("field %s written", f)
+		}
+	}
+	out := profile{Note: "kept", hidden: &hidden{Hidden: "kept"}}
+	if err := c.HGetStruct("p", &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Name != "n" || out.Note != "kept" || out.Nickname != nil || out.Owner != nil || out.hidden.Hidden != "kept" {
+		t.Fatalf("read %+v", out)
+	}
+
+	if err := c.HGetStruct("missing", &out); err != gossdb.ErrNotFound {
+		t.Fatalf("missing hash error = %v, want %v", err, gossdb.ErrNotFound)
+	}
+	if err := c.HGetStruct("p", out); err == nil {
+		t.Fatal("read into a struct value, want an error")
+	}
+	if _, err := c.HSetStruct("p", 42); err == nil {
+		t.Fatal("wrote an int, want an error")
+	}
+	if _, err := c.HSet("p", "age", "old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.HGetStruct("p", &out); err == nil {
+		t.Fatal("parsed age \"old\", want an error")
+	}
+}
+
+// The fields skipped by a write are removed, not read back stale
+func TestHStructStaleFields(t *testing.T) {
+	_, c := newTestClient(t)
+	nick := "al"
+	if _, err := c.HSetStruct("p", profile{Name: "n", Note: "old", Nickname: &nick, Owner: &Owner{Owner: "bob"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.HSetStruct("p", profile{Name: "n"}); err != nil {
+		t.Fatal(err)
+	}
+	var out profile
+	if err := c.HGetStruct("p", &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Note != "" || out.Nickname != nil || out.Owner != nil {
+		t.Fatalf("read %+v, want the skipped fields removed", out)
+	}
+	if ok, _ := c.HExists("p", "note"); ok {
+		t.Fatal("note still in the hash")
+	}
+}
+
+type Node struct {
+	*Node
+	Name string `ssdb:"name"`
+}
+
+func TestHStructRecursive(t *testing.T) {
+	_, c := newTestClient(t)
+	if _, err := c.HSetStruct("n", Node{Node: &Node{Name: "inner"}, Name: "outer"}); err != nil {
+		t.Fatal(err)
+	}
+	var out Node
+	if err := c.HGetStruct("n", &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Name != "outer" || out.Node != nil {
+		t.Fatalf("read %+v", out)
+	}
+}
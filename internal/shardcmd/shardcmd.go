@@ -0,0 +1,59 @@
+// Package shardcmd classifies the SSDB commands by the way a cluster routes
+// them, it is shared by the tools speaking to a cluster.
+package shardcmd
+
+// Commands whose first argument is the key, they go to the shard owning it.
+// The reads may be sent to a replica.
+var (
+	Reads = []string{
+		"get", "exists", "ttl", "strlen", "substr", "getbit", "countbit",
+		"hget", "hexists", "hsize", "hkeys", "hgetall", "hscan", "hrscan", "multi_hget",
+		"zget", "zexists", "zsize", "zkeys", "zscan", "zrscan", "zrank", "zrrank",
+		"zrange", "zrrange", "zcount", "zsum", "zavg", "multi_zget",
+		"qsize", "qfront", "qback", "qget", "qslice", "qrange",
+	}
+	Writes = []string{
+		"set", "setx", "setnx", "getset", "del", "incr", "decr", "expire", "setbit",
+		"hset", "hdel", "hincr", "hdecr", "hclear", "multi_hset", "multi_hdel",
+		"zset", "zdel", "zincr", "zdecr", "zclear", "multi_zset", "multi_zdel",
+		"zremrangebyrank", "zremrangebyscore", "zpop_front", "zpop_back",
+		"qpush", "qpush_front", "qpush_back", "qpop", "qpop_front", "qpop_back",
+		"qclear", "qtrim_front", "qtrim_back", "qset",
+	}
+)
+
+// Range is the shape of the reply of a range command
+type Range struct {
+	// Width is the number of values per item
+	Width int
+	// Reverse is true when the items are listed in descending key order
+	Reverse bool
+}
+
+// Ranges are the commands sent to every shard, the replies are merged in
+// key order
+var Ranges = map[string]Range{
+	"scan":   {2, false},
+	"rscan":  {2, true},
+	"keys":   {1, false},
+	"rkeys":  {1, true},
+	"hlist":  {1, false},
+	"hrlist": {1, true},
+	"zlist":  {1, false},
+	"zrlist": {1, true},
+	"qlist":  {1, false},
+	"qrlist": {1, true},
+}
+
+var reads = make(map[string]bool, len(Reads))
+
+func init() {
+	for _, cmd := range Reads {
+		reads[cmd] = true
+	}
+}
+
+// IsRead reports whether cmd is a keyed read
+func IsRead(cmd string) bool {
+	return reads[cmd]
+}
@@ -0,0 +1,63 @@
+package gossdb
+
+// Logger receives the connection events of a Client. Its method set matches
+// *slog.Logger so one can be passed as is.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+type LogLevel int
+
+const (
+	LevelOff LogLevel = iota
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// LogLevels sets the level of every kind of event, LevelOff mutes it
+type LogLevels struct {
+	Connect   LogLevel
+	Retry     LogLevel
+	Reconnect LogLevel
+	Slow      LogLevel
+}
+
+var DefaultLogLevels = LogLevels{
+	Connect:   LevelInfo,
+	Retry:     LevelWarn,
+	Reconnect: LevelInfo,
+	Slow:      LevelWarn,
+}
+
+func (c *Client) log(level LogLevel, msg string, args ...interface{}) {
+	if c.logger == nil {
+		return
+	}
+	args = append([]interface{}{"addr", c.addr.String()}, args...)
+	switch level {
+	case LevelDebug:
+		c.logger.Debug(msg, args...)
+	case LevelInfo:
+		c.logger.Info(msg, args...)
+	case LevelWarn:
+		c.logger.Warn(msg, args...)
+	case LevelError:
+		c.logger.Error(msg, args...)
+	}
+}
+
+// Command name used in logs, the arguments may hold private data
+func cmdName(args []interface{}) string {
+	if len(args) == 0 {
+		return ""
+	}
+	if s, ok := args[0].(string); ok {
+		return s
+	}
+	return ""
+}
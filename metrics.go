@@ -0,0 +1,260 @@
+package gossdb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsCollector receives the activity of a Client. The addr argument is
+// the server address, which identifies the shard in a Cluster.
+type MetricsCollector interface {
+	// ObserveCommand is called once per command with the reply status
+	// ("ok", "not_found", "error", ...) or "net_error" on network failure
+	ObserveCommand(cmd, addr, status string, d time.Duration)
+	IncRetries(addr string)
+	IncReconnects(addr string)
+	AddBytesSent(addr string, n int)
+	AddBytesReceived(addr string, n int)
+}
+
+// SetMetrics sets the collector receiving the client activity, nil disables it
+func (c *Client) SetMetrics(m MetricsCollector) {
+	c.lock()
+	defer c.unlock()
+	c.metrics = m
+}
+
+func (c *Cluster) SetMetrics(m MetricsCollector) {
+	c.configure(func(cli *Client) { cli.SetMetrics(m) })
+}
+
+func (p *Pool) SetMetrics(m MetricsCollector) {
+	for _, s := range p.clients {
+		s.SetMetrics(m)
+	}
+}
+
+func (c *Client) countRetry() {
+	if c.metrics != nil {
+		c.metrics.IncRetries(c.addr.String())
+	}
+}
+
+// The status reported for a reply
+func replyStatus(resp []string, err error) string {
+	if err != nil {
+		return "net_error"
+	}
+	if len(resp) == 0 {
+		return "empty"
+	}
+	return resp[0]
+}
+
+// DefaultBuckets are the latency histogram bounds in seconds
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// PrometheusMetrics is a MetricsCollector keeping its own registry of series
+// and exposing them in the Prometheus text format. Each instance is
+// independent, so tests can create one and inspect its output.
+type PrometheusMetrics struct {
+	mutex      sync.Mutex
+	namespace  string
+	buckets    []float64
+	commands   map[[2]string]uint64
+	errors     map[[3]string]uint64
+	latency    map[[2]string]*histogram
+	retries    map[string]uint64
+	reconnects map[string]uint64
+	sent       map[string]uint64
+	received   map[string]uint64
+}
+
+// NewPrometheusMetrics creates a collector whose series names start with
+// namespace, "ssdb" when empty. Buckets default to DefaultBuckets.
+func NewPrometheusMetrics(namespace string, buckets ...float64) *PrometheusMetrics {
+	if namespace == "" {
+		namespace = "ssdb"
+	}
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &PrometheusMetrics{
+		namespace:  namespace,
+		buckets:    buckets,
+		commands:   make(map[[2]string]uint64),
+		errors:     make(map[[3]string]uint64),
+		latency:    make(map[[2]string]*histogram),
+		retries:    make(map[string]uint64),
+		reconnects: make(map[string]uint64),
+		sent:       make(map[string]uint64),
+		received:   make(map[string]uint64),
+	}
+}
+
+func (m *PrometheusMetrics) ObserveCommand(cmd, addr, status string, d time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	k := [2]string{cmd, addr}
+	m.commands[k]++
+	if status != "ok" {
+		m.errors[[3]string{cmd, addr, status}]++
+	}
+	h := m.latency[k]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.latency[k] = h
+	}
+	secs := d.Seconds()
+	for i, b := range m.buckets {
+		if secs <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += secs
+	h.count++
+}
+
+func (m *PrometheusMetrics) IncRetries(addr string) {
+	m.mutex.Lock()
+	m.retries[addr]++
+	m.mutex.Unlock()
+}
+
+func (m *PrometheusMetrics) IncReconnects(addr string) {
+	m.mutex.Lock()
+	m.reconnects[addr]++
+	m.mutex.Unlock()
+}
+
+func (m *PrometheusMetrics) AddBytesSent(addr string, n int) {
+	m.mutex.Lock()
+	m.sent[addr] += uint64(n)
+	m.mutex.Unlock()
+}
+
+func (m *PrometheusMetrics) AddBytesReceived(addr string, n int) {
+	m.mutex.Lock()
+	m.received[addr] += uint64(n)
+	m.mutex.Unlock()
+}
+
+// ServeHTTP exposes the metrics, it can be mounted on /metrics
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text format. They are
+// rendered under the lock and written after it is released, so a slow
+// writer does not hold the commands observed meanwhile.
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	m.render(&buf)
+	return buf.WriteTo(w)
+}
+
+func (m *PrometheusMetrics) render(buf *bytes.Buffer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	cw := &textWriter{w: buf}
+	ns := m.namespace
+
+	cw.header(ns+"_commands_total", "counter", "Commands sent, by command and shard.")
+	for _, k := range sortedKeys2(m.commands) {
+		cw.printf("%s_commands_total{cmd=%s,shard=%s} %d\n", ns, quote(k[0]), quote(k[1]), m.commands[k])
+	}
+
+	cw.header(ns+"_command_errors_total", "counter", "Commands without an ok reply, by command, shard and status.")
+	keys3 := make([][3]string, 0, len(m.errors))
+	for k := range m.errors {
+		keys3 = append(keys3, k)
+	}
+	sort.Slice(keys3, func(i, j int) bool {
+		return strings.Join(keys3[i][:], "\x00") < strings.Join(keys3[j][:], "\x00")
+	})
+	for _, k := range keys3 {
+		cw.printf("%s_command_errors_total{cmd=%s,shard=%s,status=%s} %d\n", ns, quote(k[0]), quote(k[1]), quote(k[2]), m.errors[k])
+	}
+
+	cw.header(ns+"_command_duration_seconds", "histogram", "Command latency, by command and shard.")
+	lkeys := make([][2]string, 0, len(m.latency))
+	for k := range m.latency {
+		lkeys = append(lkeys, k)
+	}
+	sort.Slice(lkeys, func(i, j int) bool {
+		return lkeys[i][0]+"\x00"+lkeys[i][1] < lkeys[j][0]+"\x00"+lkeys[j][1]
+	})
+	for _, k := range lkeys {
+		h := m.latency[k]
+		labels := fmt.Sprintf("cmd=%s,shard=%s", quote(k[0]), quote(k[1]))
+		for i, b := range m.buckets {
+			cw.printf("%s_command_duration_seconds_bucket{%s,le=\"%g\"} %d\n", ns, labels, b, h.counts[i])
+		}
+		cw.printf("%s_command_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", ns, labels, h.count)
+		cw.printf("%s_command_duration_seconds_sum{%s} %g\n", ns, labels, h.sum)
+		cw.printf("%s_command_duration_seconds_count{%s} %d\n", ns, labels, h.count)
+	}
+
+	cw.shardCounter(ns+"_retries_total", "Commands sent again after a network error, by shard.", m.retries)
+	cw.shardCounter(ns+"_reconnects_total", "Reconnections, by shard.", m.reconnects)
+	cw.shardCounter(ns+"_sent_bytes_total", "Bytes written to the server, by shard.", m.sent)
+	cw.shardCounter(ns+"_received_bytes_total", "Bytes read from the server, by shard.", m.received)
+}
+
+// textWriter writes the Prometheus text format, writes to a buffer
+// do not fail
+type textWriter struct {
+	w *bytes.Buffer
+}
+
+func (cw *textWriter) printf(format string, args ...interface{}) {
+	fmt.Fprintf(cw.w, format, args...)
+}
+
+func (cw *textWriter) header(name, typ, help string) {
+	cw.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (cw *textWriter) shardCounter(name, help string, values map[string]uint64) {
+	cw.header(name, "counter", help)
+	shards := make([]string, 0, len(values))
+	for k := range values {
+		shards = append(shards, k)
+	}
+	sort.Strings(shards)
+	for _, s := range shards {
+		cw.printf("%s{shard=%s} %d\n", name, quote(s), values[s])
+	}
+}
+
+func sortedKeys2(m map[[2]string]uint64) [][2]string {
+	keys := make([][2]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i][0]+"\x00"+keys[i][1] < keys[j][0]+"\x00"+keys[j][1]
+	})
+	return keys
+}
+
+// Quote a label value as required by the text format
+func quote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+	return `"` + s + `"`
+}
@@ -0,0 +1,134 @@
+package gossdb_test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bububa/gossdb"
+	"github.com/bububa/gossdb/ssdbtest"
+)
+
+func expectSeries(t *testing.T, out string, series ...string) {
+	t.Helper()
+	for _, s := range series {
+		if !strings.Contains(out, s+"\n") {
+			t.Errorf("missing %q in\n%s", s, out)
+		}
+	}
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	srv, c := newTestClient(t)
+	m := gossdb.NewPrometheusMetrics("test", 0.5, 1)
+	c.SetMetrics(m)
+	if _, err := c.Set("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get("k"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get("missing"); err != nil {
+		t.Fatal(err)
+	}
+	srv.InjectFault(ssdbtest.Fault{Kind: ssdbtest.FaultDrop}, 1)
+	if _, err := c.Get("k"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	shard := fmt.Sprintf("shard=%q", srv.String())
+	expectSeries(t, buf.String(),
+		"# TYPE test_commands_total counter",
+		`test_commands_total{cmd="get",`+shard+`} 3`,
+		`test_commands_total{cmd="set",`+shard+`} 1`,
+		`test_command_errors_total{cmd="get",`+shard+`,status="not_found"} 1`,
+		"# TYPE test_command_duration_seconds histogram",
+		`test_command_duration_seconds_bucket{cmd="get",`+shard+`,le="0.5"} 3`,
+		`test_command_duration_seconds_bucket{cmd="get",`+shard+`,le="+Inf"} 3`,
+		`test_command_duration_seconds_count{cmd="get",`+shard+`} 3`,
+		`test_retries_total{`+shard+`} 1`,
+		`test_reconnects_total{`+shard+`} 1`,
+	)
+	if strings.Contains(buf.String(), `status="ok"`) {
+		t.Errorf("ok replies counted as errors\n%s", buf.String())
+	}
+}
+
+func TestPrometheusMetricsServeHTTP(t *testing.T) {
+	_, c := newTestClient(t)
+	m := gossdb.NewPrometheusMetrics("")
+	c.SetMetrics(m)
+	if _, err := c.Set("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("content type %q", ct)
+	}
+	expectSeries(t, w.Body.String(), fmt.Sprintf(`ssdb_commands_total{cmd="set",shard=%q} 1`, c.Addr()))
+}
+
+func TestPrometheusMetricsIndependent(t *testing.T) {
+	_, c := newTestClient(t)
+	m1, m2 := gossdb.NewPrometheusMetrics("a"), gossdb.NewPrometheusMetrics("a")
+	c.SetMetrics(m1)
+	if _, err := c.Set("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	m2.WriteTo(&buf)
+	if strings.Contains(buf.String(), "a_commands_total{") {
+		t.Errorf("series leaked to another registry\n%s", buf.String())
+	}
+}
+
+// Blocks every write until released
+type stalledWriter struct {
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	w.writing <- struct{}{}
+	<-w.release
+	return len(p), nil
+}
+
+func TestPrometheusMetricsSlowScraper(t *testing.T) {
+	_, c := newTestClient(t)
+	m := gossdb.NewPrometheusMetrics("")
+	c.SetMetrics(m)
+	w := &stalledWriter{writing: make(chan struct{}), release: make(chan struct{})}
+	done := make(chan error)
+	go func() {
+		_, err := m.WriteTo(w)
+		done <- err
+	}()
+	<-w.writing
+	// commands are observed while the scraper reads
+	set := make(chan error)
+	go func() {
+		_, err := c.Set("k", "v")
+		set <- err
+	}()
+	select {
+	case err := <-set:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("command held by a slow scraper")
+	}
+	close(w.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
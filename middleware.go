@@ -0,0 +1,67 @@
+package gossdb
+
+import (
+	"context"
+)
+
+// Command is a request travelling through the middleware chain
+type Command struct {
+	// Args holds the command name followed by its arguments
+	Args []interface{}
+	// Addr is the address of the server the command is sent to
+	Addr string
+	// Retries is the number of times the command was sent again after a
+	// network error, it is up to date once the next handler returned
+	Retries int
+}
+
+// Name returns the command name, e.g. "hset"
+func (cmd *Command) Name() string {
+	return cmdName(cmd.Args)
+}
+
+// Handler executes a command and returns the raw reply
+type Handler func(ctx context.Context, cmd *Command) ([]string, error)
+
+// Middleware wraps a Handler to add behaviour around command execution
+type Middleware func(next Handler) Handler
+
+// Chain composes middlewares, the first one being the outermost
+func Chain(mws ...Middleware) Middleware {
+	return func(next Handler) Handler {
+		for i := len(mws) - 1; i >= 0; i-- {
+			next = mws[i](next)
+		}
+		return next
+	}
+}
+
+// Use appends middlewares to the chain wrapping every command of the client,
+// including pipelined ones
+func (c *Client) Use(mws ...Middleware) {
+	c.lock()
+	defer c.unlock()
+	c.mws = append(c.mws, mws...)
+	c.chain = Chain(c.mws...)(c.exec)
+}
+
+func (c *Client) handler() Handler {
+	c.lock()
+	defer c.unlock()
+	if c.chain == nil {
+		return c.exec
+	}
+	return c.chain
+}
+
+// Use appends middlewares to every client of the cluster
+func (c *Cluster) Use(mws ...Middleware) {
+	c.configure(func(cli *Client) { cli.Use(mws...) })
+}
+
+// Use appends middlewares to every connection of the pool
+func (p *Pool) Use(mws ...Middleware) {
+	for _, s := range p.clients {
+		s.Use(mws...)
+	}
+}
@@ -0,0 +1,154 @@
+package gossdb_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/bububa/gossdb"
+)
+
+// Middleware appending its name to calls before and after the command
+func recordCalls(name string, mutex *sync.Mutex, calls *[]string) gossdb.Middleware {
+	return func(next gossdb.Handler) gossdb.Handler {
+		return func(ctx context.Context, cmd *gossdb.Command) ([]string, error) {
+			mutex.Lock()
+			*calls = append(*calls, name+">"+cmd.Name())
+			mutex.Unlock()
+			resp, err := next(ctx, cmd)
+			mutex.Lock()
+			*calls = append(*calls, name+"<"+cmd.Name())
+			mutex.Unlock()
+			return resp, err
+		}
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	_, c := newTestClient(t)
+	var (
+		mutex sync.Mutex
+		calls []string
+	)
+	c.Use(recordCalls("a", &mutex, &calls), recordCalls("b", &mutex, &calls))
+	if _, err := c.Set("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a>set", "b>set", "b<set", "a<set"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	_, c := newTestClient(t)
+	c.Use(func(next gossdb.Handler) gossdb.Handler {
+		return func(ctx context.Context, cmd *gossdb.Command) ([]string, error) {
+			if cmd.Name() == "get" {
+				return []string{"ok", "cached"}, nil
+			}
+			return next(ctx, cmd)
+		}
+	})
+	if _, err := c.Set("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.Get("k"); v != "cached" || err != nil {
+		t.Fatalf("get = %v, %v", v, err)
+	}
+}
+
+func TestMiddlewareContext(t *testing.T) {
+	_, c := newTestClient(t)
+	type key struct{}
+	var got interface{}
+	c.Use(func(next gossdb.Handler) gossdb.Handler {
+		return func(ctx context.Context, cmd *gossdb.Command) ([]string, error) {
+			got = ctx.Value(key{})
+			return next(ctx, cmd)
+		}
+	})
+	if _, err := c.WithContext(context.WithValue(context.Background(), key{}, "value")).Set("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if got != "value" {
+		t.Fatalf("context value = %v", got)
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	_, c := newTestClient(t)
+	var (
+		mutex sync.Mutex
+		calls []string
+	)
+	c.Use(recordCalls("a", &mutex, &calls))
+	// answered by a middleware without reaching the batch
+	c.Use(func(next gossdb.Handler) gossdb.Handler {
+		return func(ctx context.Context, cmd *gossdb.Command) ([]string, error) {
+			if cmd.Name() == "ping" {
+				return []string{"ok"}, nil
+			}
+			return next(ctx, cmd)
+		}
+	})
+	p := c.Pipeline()
+	p.Do("set", "a", "1")
+	p.Do("ping")
+	p.Do("incr", "n", 2)
+	p.Do("get", "a")
+	if p.Len() != 4 {
+		t.Fatalf("len = %d, want 4", p.Len())
+	}
+	resps, err := p.Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"ok", "1"}, {"ok"}, {"ok", "2"}, {"ok", "1"}}
+	if !reflect.DeepEqual(resps, want) {
+		t.Fatalf("replies = %v, want %v", resps, want)
+	}
+	if len(calls) != 8 {
+		t.Fatalf("calls = %v, want every command through the middleware", calls)
+	}
+	if p.Len() != 0 {
+		t.Fatalf("len after exec = %d, want 0", p.Len())
+	}
+}
+
+// spans records the spans started by a tracer
+type spans struct {
+	mutex sync.Mutex
+	names []string
+}
+
+type span struct{}
+
+func (span) SetAttributes(attrs ...gossdb.Attribute) {}
+func (span) RecordError(err error)                   {}
+func (span) End()                                    {}
+
+func (s *spans) Start(ctx context.Context, name string) (context.Context, gossdb.Span) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.names = append(s.names, name)
+	return ctx, span{}
+}
+
+func TestClusterTracing(t *testing.T) {
+	_, c := newTestCluster(t, 2)
+	tracer := &spans{}
+	c.SetTracer(tracer)
+	if _, err := c.MultiGet("a", "b", "c", "d"); err != nil {
+		t.Fatal(err)
+	}
+	if len(tracer.names) < 2 || tracer.names[0] != "ssdb.cluster.multi_get" {
+		t.Fatalf("spans = %v", tracer.names)
+	}
+	for _, name := range tracer.names[1:] {
+		if name != "ssdb.multi_get" {
+			t.Fatalf("spans = %v", tracer.names)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package gossdb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ShardError is the failure of one shard during a multi-key command
+type ShardError struct {
+	Shard int
+	Addr  string
+	Keys  []string
+	Err   error
+}
+
+func (e *ShardError) Error() string {
+	return fmt.Sprintf("shard %d (%s): %d keys: %v", e.Shard, e.Addr, len(e.Keys), e.Err)
+}
+
+func (e *ShardError) Unwrap() error {
+	return e.Err
+}
+
+// MultiError collects the shard errors of a multi-key command
+type MultiError []*ShardError
+
+func (e MultiError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// MultiResult is the outcome of a multi-key command spread over shards
+type MultiResult struct {
+	// Pairs fetched by MultiGet
+	Pairs []*KVPair
+	// Keys handled by the shards that succeeded
+	Keys []string
+	// Errors of the shards that failed
+	Errors []*ShardError
+}
+
+// Err returns a MultiError when any shard failed
+func (r *MultiResult) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	return MultiError(r.Errors)
+}
+
+// KeyErrors maps every failed key to the error of its shard
+func (r *MultiResult) KeyErrors() map[string]error {
+	res := make(map[string]error)
+	for _, e := range r.Errors {
+		for _, k := range e.Keys {
+			res[k] = e.Err
+		}
+	}
+	return res
+}
+
+// KVResult is the value of a requested key, Found is false for missing keys
+type KVResult struct {
+	Key   string
+	Value interface{}
+	Found bool
+}
+
+// Line pairs up with the requested keys
+func alignPairs(ks []string, pairs []*KVPair) []*KVResult {
+	m := pairsMap(pairs)
+	res := make([]*KVResult, len(ks))
+	for i, k := range ks {
+		v, ok := m[k]
+		res[i] = &KVResult{Key: k, Value: v, Found: ok}
+	}
+	return res
+}
+
+func pairsMap(pairs []*KVPair) map[string]interface{} {
+	m := make(map[string]interface{}, len(pairs))
+	for _, p := range pairs {
+		m[p.Key] = p.Value
+	}
+	return m
+}
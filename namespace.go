@@ -0,0 +1,398 @@
+package gossdb
+
+import (
+	"strings"
+)
+
+// Namespace prefixes the keys and the hash, zset and queue names of the
+// commands it sends, so several applications can share a deployment. The
+// prefix is stripped from the replies and the ranges of Scan and the list
+// commands are clamped to the namespace.
+type Namespace struct {
+	c      Commander
+	prefix string
+}
+
+func NewNamespace(c Commander, prefix string) *Namespace {
+	return &Namespace{c: c, prefix: prefix}
+}
+
+func (c *Client) Namespace(prefix string) *Namespace {
+	return NewNamespace(c, prefix)
+}
+
+func (c *Cluster) Namespace(prefix string) *Namespace {
+	return NewNamespace(c, prefix)
+}
+
+func (p *Pool) Namespace(prefix string) *Namespace {
+	return NewNamespace(p, prefix)
+}
+
+// Namespace returns a namespace nested in n
+func (n *Namespace) Namespace(prefix string) *Namespace {
+	return NewNamespace(n.c, n.prefix+prefix)
+}
+
+func (n *Namespace) Prefix() string {
+	return n.prefix
+}
+
+// Codec returns the codec of the underlying Commander
+func (n *Namespace) Codec() Codec {
+	return codecOf(n.c)
+}
+
+// Close closes the underlying Commander
+func (n *Namespace) Close() error {
+	return n.c.Close()
+}
+
+func (n *Namespace) key(k string) string {
+	return n.prefix + k
+}
+
+func (n *Namespace) keys(ks []string) []string {
+	res := make([]string, len(ks))
+	for i, k := range ks {
+		res[i] = n.prefix + k
+	}
+	return res
+}
+
+// Bounds in (start, end] of the names of the namespace. Without an end the
+// range stops at the first name after the prefix, which is dropped from
+// the results by owns.
+func (n *Namespace) bounds(start, end string) (string, string) {
+	if end != "" {
+		return n.prefix + start, n.prefix + end
+	}
+	b := []byte(n.prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return n.prefix + start, string(b[:i+1])
+		}
+	}
+	return n.prefix + start, ""
+}
+
+// Report whether a name belongs to the namespace
+func (n *Namespace) owns(k string) bool {
+	return strings.HasPrefix(k, n.prefix)
+}
+
+// Strip the prefix of names, dropping the ones outside the namespace
+func (n *Namespace) names(list []string, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(list))
+	for _, k := range list {
+		if n.owns(k) {
+			res = append(res, k[len(n.prefix):])
+		}
+	}
+	return res, nil
+}
+
+func (n *Namespace) Set(key string, val string) (bool, error) {
+	return n.c.Set(n.key(key), val)
+}
+
+func (n *Namespace) Setx(key string, val string, ttl int32) (bool, error) {
+	return n.c.Setx(n.key(key), val, ttl)
+}
+
+func (n *Namespace) Setnx(key string, val string) (bool, error) {
+	return n.c.Setnx(n.key(key), val)
+}
+
+func (n *Namespace) Get(key string) (interface{}, error) {
+	return n.c.Get(n.key(key))
+}
+
+func (n *Namespace) Getset(key string, val string) (interface{}, error) {
+	return n.c.Getset(n.key(key), val)
+}
+
+func (n *Namespace) Del(key string) (bool, error) {
+	return n.c.Del(n.key(key))
+}
+
+func (n *Namespace) MultiSet(ps ...*KVPair) (bool, error) {
+	pairs := make([]*KVPair, len(ps))
+	for i, p := range ps {
+		pairs[i] = &KVPair{Key: n.key(p.Key), Value: p.Value}
+	}
+	return n.c.MultiSet(pairs...)
+}
+
+// MultiGet returns the pairs of the existing keys. The pairs of the healthy
+// shards of a Cluster come with its MultiError, see Cluster.MultiGet.
+func (n *Namespace) MultiGet(ks ...string) ([]*KVPair, error) {
+	pairs, err := n.c.MultiGet(n.keys(ks)...)
+	if pairs == nil {
+		return nil, err
+	}
+	// the pairs may be shared, a cache keeps them for instance
+	res := make([]*KVPair, len(pairs))
+	for i, p := range pairs {
+		res[i] = &KVPair{Key: strings.TrimPrefix(p.Key, n.prefix), Value: p.Value}
+	}
+	return res, err
+}
+
+func (n *Namespace) MultiGetOrdered(ks ...string) ([]*KVResult, error) {
+	results, err := n.c.MultiGetOrdered(n.keys(ks)...)
+	if results == nil {
+		return nil, err
+	}
+	res := make([]*KVResult, len(results))
+	for i, r := range results {
+		res[i] = &KVResult{Key: strings.TrimPrefix(r.Key, n.prefix), Value: r.Value, Found: r.Found}
+	}
+	return res, err
+}
+
+func (n *Namespace) MultiGetMap(ks ...string) (map[string]interface{}, error) {
+	m, err := n.c.MultiGetMap(n.keys(ks)...)
+	if m == nil {
+		return nil, err
+	}
+	res := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		res[strings.TrimPrefix(k, n.prefix)] = v
+	}
+	return res, err
+}
+
+func (n *Namespace) MultiDel(ks ...string) (bool, error) {
+	return n.c.MultiDel(n.keys(ks)...)
+}
+
+// Scan lists the key-value pairs of the namespace in (startKey, endKey]
+func (n *Namespace) Scan(startKey string, endKey string, limit int) ([][2]string, error) {
+	start, end := n.bounds(startKey, endKey)
+	kvList, err := n.c.Scan(start, end, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([][2]string, 0, len(kvList))
+	for _, kv := range kvList {
+		if n.owns(kv[0]) {
+			res = append(res, [2]string{kv[0][len(n.prefix):], kv[1]})
+		}
+	}
+	return res, nil
+}
+
+func (n *Namespace) Exists(key string) (bool, error) {
+	return n.c.Exists(n.key(key))
+}
+
+func (n *Namespace) Expire(key string, ttl int) (int, error) {
+	return n.c.Expire(n.key(key), ttl)
+}
+
+func (n *Namespace) TTL(key string) (int64, error) {
+	return n.c.TTL(n.key(key))
+}
+
+func (n *Namespace) Incr(key string, num int) (int64, error) {
+	return n.c.Incr(n.key(key), num)
+}
+
+func (n *Namespace) Decr(key string, num int) (int64, error) {
+	return n.c.Decr(n.key(key), num)
+}
+
+func (n *Namespace) HSet(key, field, val string) (bool, error) {
+	return n.c.HSet(n.key(key), field, val)
+}
+
+func (n *Namespace) HGet(key, field string) (interface{}, error) {
+	return n.c.HGet(n.key(key), field)
+}
+
+func (n *Namespace) HDel(key, field string) (bool, error) {
+	return n.c.HDel(n.key(key), field)
+}
+
+func (n *Namespace) HIncr(key, field string, num int) (int64, error) {
+	return n.c.HIncr(n.key(key), field, num)
+}
+
+func (n *Namespace) HDecr(key, field string, num int) (int64, error) {
+	return n.c.HDecr(n.key(key), field, num)
+}
+
+func (n *Namespace) HExists(key, field string) (bool, error) {
+	return n.c.HExists(n.key(key), field)
+}
+
+func (n *Namespace) HSize(key string) (int64, error) {
+	return n.c.HSize(n.key(key))
+}
+
+// HList lists the hash names of the namespace in (startKey, endKey]
+func (n *Namespace) HList(startKey, endKey string, limit int) ([]string, error) {
+	start, end := n.bounds(startKey, endKey)
+	return n.names(n.c.HList(start, end, limit))
+}
+
+func (n *Namespace) HKeys(key, startField, endField string, limit int) ([]string, error) {
+	return n.c.HKeys(n.key(key), startField, endField, limit)
+}
+
+func (n *Namespace) HScan(key, startField, endField string, limit int) ([][2]string, error) {
+	return n.c.HScan(n.key(key), startField, endField, limit)
+}
+
+func (n *Namespace) HRScan(key, startField, endField string, limit int) ([][2]string, error) {
+	return n.c.HRScan(n.key(key), startField, endField, limit)
+}
+
+func (n *Namespace) HClear(key string) (bool, error) {
+	return n.c.HClear(n.key(key))
+}
+
+func (n *Namespace) MultiHSet(key string, fvMap map[string]string) (bool, error) {
+	return n.c.MultiHSet(n.key(key), fvMap)
+}
+
+func (n *Namespace) MultiHGet(key string, fieldList []string) (map[string]string, error) {
+	return n.c.MultiHGet(n.key(key), fieldList)
+}
+
+func (n *Namespace) MultiHDel(key string, fieldList []string) (bool, error) {
+	return n.c.MultiHDel(n.key(key), fieldList)
+}
+
+func (n *Namespace) ZSet(key, ele string, score int) (bool, error) {
+	return n.c.ZSet(n.key(key), ele, score)
+}
+
+func (n *Namespace) ZGet(key, ele string) (interface{}, error) {
+	return n.c.ZGet(n.key(key), ele)
+}
+
+func (n *Namespace) ZDel(key, ele string) (bool, error) {
+	return n.c.ZDel(n.key(key), ele)
+}
+
+func (n *Namespace) ZIncr(key, ele string, num int) (int64, error) {
+	return n.c.ZIncr(n.key(key), ele, num)
+}
+
+func (n *Namespace) ZSize(key string) (int64, error) {
+	return n.c.ZSize(n.key(key))
+}
+
+func (n *Namespace) ZExists(key, ele string) (bool, error) {
+	return n.c.ZExists(n.key(key), ele)
+}
+
+// ZList lists the zset names of the namespace in (startKey, endKey]
+func (n *Namespace) ZList(startKey, endKey string, limit int) ([]string, error) {
+	start, end := n.bounds(startKey, endKey)
+	return n.names(n.c.ZList(start, end, limit))
+}
+
+func (n *Namespace) ZKeys(key, startEle string, scoreStart, scoreEnd, limit int) ([]string, error) {
+	return n.c.ZKeys(n.key(key), startEle, scoreStart, scoreEnd, limit)
+}
+
+func (n *Namespace) ZScan(key, startEle string, scoreStart, scoreEnd, limit int) (map[string]int64, error) {
+	return n.c.ZScan(n.key(key), startEle, scoreStart, scoreEnd, limit)
+}
+
+func (n *Namespace) ZRScan(key, startEle string, scoreStart, scoreEnd, limit int) (map[string]int64, error) {
+	return n.c.ZRScan(n.key(key), startEle, scoreStart, scoreEnd, limit)
+}
+
+func (n *Namespace) ZRank(key, ele string) (int64, error) {
+	return n.c.ZRank(n.key(key), ele)
+}
+
+func (n *Namespace) ZRRank(key, ele string) (int64, error) {
+	return n.c.ZRRank(n.key(key), ele)
+}
+
+func (n *Namespace) ZRange(key string, offset, limit int) ([][2]interface{}, error) {
+	return n.c.ZRange(n.key(key), offset, limit)
+}
+
+func (n *Namespace) ZRRange(key string, offset, limit int) ([][2]interface{}, error) {
+	return n.c.ZRRange(n.key(key), offset, limit)
+}
+
+func (n *Namespace) ZClear(key string) (bool, error) {
+	return n.c.ZClear(n.key(key))
+}
+
+func (n *Namespace) MultiZSet(key string, esMap map[string]int) (bool, error) {
+	return n.c.MultiZSet(n.key(key), esMap)
+}
+
+func (n *Namespace) MultiZGet(key string, eleList []string) (map[string]int64, error) {
+	return n.c.MultiZGet(n.key(key), eleList)
+}
+
+func (n *Namespace) MultiZDel(key string, eleList []string) (bool, error) {
+	return n.c.MultiZDel(n.key(key), eleList)
+}
+
+func (n *Namespace) QSize(key string) (int64, error) {
+	return n.c.QSize(n.key(key))
+}
+
+func (n *Namespace) QClear(key string) (bool, error) {
+	return n.c.QClear(n.key(key))
+}
+
+func (n *Namespace) QFront(key string) (string, error) {
+	return n.c.QFront(n.key(key))
+}
+
+func (n *Namespace) QBack(key string) (string, error) {
+	return n.c.QBack(n.key(key))
+}
+
+func (n *Namespace) QGet(key string, index int) (interface{}, error) {
+	return n.c.QGet(n.key(key), index)
+}
+
+func (n *Namespace) QSlice(key string, begin, end int) ([]string, error) {
+	return n.c.QSlice(n.key(key), begin, end)
+}
+
+// QList lists the queue names of the namespace in (startKey, endKey]
+func (n *Namespace) QList(startKey, endKey string, limit int) ([]string, error) {
+	start, end := n.bounds(startKey, endKey)
+	return n.names(n.c.QList(start, end, limit))
+}
+
+func (n *Namespace) QPush(key, item string) (bool, error) {
+	return n.c.QPush(n.key(key), item)
+}
+
+func (n *Namespace) QPushFront(key, item string) (bool, error) {
+	return n.c.QPushFront(n.key(key), item)
+}
+
+func (n *Namespace) QPushBack(key, item string) (bool, error) {
+	return n.c.QPushBack(n.key(key), item)
+}
+
+func (n *Namespace) QPop(key string) (interface{}, error) {
+	return n.c.QPop(n.key(key))
+}
+
+func (n *Namespace) QPopFront(key string) (interface{}, error) {
+	return n.c.QPopFront(n.key(key))
+}
+
+func (n *Namespace) QPopBack(key string) (interface{}, error) {
+	return n.c.QPopBack(n.key(key))
+}
@@ -0,0 +1,155 @@
+package gossdb_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bububa/gossdb"
+)
+
+func TestNamespaceIsolation(t *testing.T) {
+	_, c := newTestClient(t)
+	a, b := c.Namespace("a:"), c.Namespace("b:")
+	if _, err := a.Set("k", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Set("k", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := a.Get("k"); v != "1" {
+		t.Fatalf("get in a = %v", v)
+	}
+	if v, _ := c.Get("b:k"); v != "2" {
+		t.Fatalf("get of the prefixed key = %v", v)
+	}
+	if _, err := a.Namespace("x:").HSet("h", "f", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := c.HGet("a:x:h", "f"); v != "v" {
+		t.Fatalf("hget in a nested namespace = %v", v)
+	}
+
+	m, err := a.MultiGetMap("k", "missing")
+	if err != nil || !reflect.DeepEqual(m, map[string]interface{}{"k": "1"}) {
+		t.Fatalf("multi_get = %v, %v", m, err)
+	}
+	results, err := b.MultiGetOrdered("missing", "k")
+	if err != nil || len(results) != 2 || results[0].Found || results[1].Key != "k" || results[1].Value != "2" {
+		t.Fatalf("ordered multi_get = %+v, %v", results, err)
+	}
+}
+
+func TestNamespaceRanges(t *testing.T) {
+	_, c := newTestClient(t)
+	// names around the namespace, the last one sorts right after its end
+	for _, k := range []string{"n", "n:a", "n:b", "n:c", "n;", "o"} {
+		if _, err := c.Set(k, "v"+k); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.HSet(k, "f", "v"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.ZSet(k, "m", 1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.QPushBack(k, "item"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n := c.Namespace("n:")
+	kvs, err := n.Scan("", "", -1)
+	want := [][2]string{{"a", "vn:a"}, {"b", "vn:b"}, {"c", "vn:c"}}
+	if err != nil || !reflect.DeepEqual(kvs, want) {
+		t.Fatalf("scan = %v, %v, want %v", kvs, err, want)
+	}
+	if kvs, _ := n.Scan("a", "b", -1); !reflect.DeepEqual(kvs, want[1:2]) {
+		t.Fatalf("scan (a, b] = %v", kvs)
+	}
+	for name, list := range map[string]func(start, end string, limit int) ([]string, error){
+		"hlist": n.HList,
+		"zlist": n.ZList,
+		"qlist": n.QList,
+	} {
+		if names, err := list("a", "", 10); err != nil || !reflect.DeepEqual(names, []string{"b", "c"}) {
+			t.Errorf("%s = %v, %v", name, names, err)
+		}
+	}
+	if kvs, _ := c.Namespace("\xff").Scan("", "", -1); len(kvs) != 0 {
+		t.Fatalf("scan of an empty namespace = %v", kvs)
+	}
+}
+
+// sharedPairs answers MultiGet with the same pairs every time, like a cache
+type sharedPairs struct {
+	gossdb.Commander
+	pairs []*gossdb.KVPair
+}
+
+func (s *sharedPairs) MultiGet(ks ...string) ([]*gossdb.KVPair, error) {
+	return s.pairs, nil
+}
+
+func TestNamespaceSharedPairs(t *testing.T) {
+	c := &sharedPairs{pairs: []*gossdb.KVPair{gossdb.NewKVPair("p:k", "v")}}
+	n := gossdb.NewNamespace(c, "p:")
+	for i := 0; i < 2; i++ {
+		pairs, err := n.MultiGet("k")
+		if err != nil || len(pairs) != 1 || pairs[0].Key != "k" {
+			t.Fatalf("multi_get %d = %v, %v", i, pairs, err)
+		}
+	}
+	if c.pairs[0].Key != "p:k" {
+		t.Fatalf("shared pair rewritten to %q", c.pairs[0].Key)
+	}
+}
+
+// The pairs of the healthy shards come with the error of the others
+func TestNamespacePartialFailure(t *testing.T) {
+	servers, c := newTestCluster(t, 2)
+	ns := c.Namespace("ns:")
+	var keys, prefixed []string
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if _, err := ns.Set(key, "v"+key); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+		prefixed = append(prefixed, "ns:"+key)
+	}
+	up := onShard(c, servers[0], prefixed...)
+	if len(up) == 0 || len(up) == len(keys) {
+		t.Fatalf("%d of %d keys on the first shard", len(up), len(keys))
+	}
+	servers[1].Close()
+
+	var merr gossdb.MultiError
+	pairs, err := ns.MultiGet(keys...)
+	if !errors.As(err, &merr) || len(pairs) != len(up) {
+		t.Fatalf("multi_get = %d pairs, %v, want %d pairs and a MultiError", len(pairs), err, len(up))
+	}
+	for _, p := range pairs {
+		if strings.HasPrefix(p.Key, "ns:") || p.Value != "v"+p.Key {
+			t.Fatalf("pair %s = %v", p.Key, p.Value)
+		}
+	}
+	m, err := ns.MultiGetMap(keys...)
+	if !errors.As(err, &merr) || len(m) != len(up) {
+		t.Fatalf("multi_get map = %v, %v", m, err)
+	}
+	results, err := ns.MultiGetOrdered(keys...)
+	if !errors.As(err, &merr) || len(results) != len(keys) || results[3].Key != "k3" {
+		t.Fatalf("ordered multi_get = %v, %v", results, err)
+	}
+	found := 0
+	for _, r := range results {
+		if r.Found {
+			found++
+		}
+	}
+	if found != len(up) {
+		t.Fatalf("%d keys found, want %d", found, len(up))
+	}
+}
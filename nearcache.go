@@ -0,0 +1,427 @@
+package gossdb
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NearCache keeps the replies of Get, HGet and MultiGet in an in-process
+// LRU in front of a Commander, so hot keys do not all hit the same shard.
+// Entries expire after a ttl and are evicted by the writes made through
+// the NearCache. The writes of other processes are evicted with the keys
+// they publish, see SetPublisher and Listen.
+type NearCache struct {
+	Commander
+	mutex   sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries *list.List
+	index   map[nearKey]*list.Element
+	// cached fields by hash name
+	fields map[string]map[string]*list.Element
+	// reads in flight by name, a reply read before an eviction of its
+	// name is not cached
+	pending map[string]*nearRead
+	publish func(names ...string)
+	hits    int64
+	misses  int64
+	now     func() time.Time
+}
+
+// A KV key when hash is false, a field of the hash name otherwise
+type nearKey struct {
+	name  string
+	field string
+	hash  bool
+}
+
+// The reads of a name in flight, version counts its evictions
+type nearRead struct {
+	version uint64
+	count   int
+}
+
+type nearEntry struct {
+	key     nearKey
+	val     interface{}
+	expires time.Time
+}
+
+// NewNearCache caches up to size replies for ttl
+func NewNearCache(c Commander, size int, ttl time.Duration) *NearCache {
+	return &NearCache{
+		Commander: c,
+		size:      size,
+		ttl:       ttl,
+		entries:   list.New(),
+		index:     make(map[nearKey]*list.Element),
+		fields:    make(map[string]map[string]*list.Element),
+		pending:   make(map[string]*nearRead),
+		now:       time.Now,
+	}
+}
+
+// SetPublisher sets the function called with the keys and hash names
+// written through the NearCache, to broadcast them to the other processes
+func (n *NearCache) SetPublisher(fn func(names ...string)) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.publish = fn
+}
+
+// Listen evicts the keys and hash names received on ch until it is closed
+func (n *NearCache) Listen(ch <-chan string) {
+	go func() {
+		for name := range ch {
+			n.Evict(name)
+		}
+	}()
+}
+
+// Evict removes a key and the fields of the hash of the same name
+func (n *NearCache) Evict(names ...string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for _, name := range names {
+		if r, found := n.pending[name]; found {
+			r.version++
+		}
+		if e, found := n.index[nearKey{name: name}]; found {
+			n.remove(e)
+		}
+		for _, e := range n.fields[name] {
+			n.remove(e)
+		}
+	}
+}
+
+// Purge empties the cache
+func (n *NearCache) Purge() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for _, r := range n.pending {
+		r.version++
+	}
+	n.entries.Init()
+	n.index = make(map[nearKey]*list.Element)
+	n.fields = make(map[string]map[string]*list.Element)
+}
+
+// Stats returns the number of reads answered by the cache and sent to the
+// Commander
+func (n *NearCache) Stats() (hits, misses int64) {
+	return atomic.LoadInt64(&n.hits), atomic.LoadInt64(&n.misses)
+}
+
+// Len returns the number of cached replies
+func (n *NearCache) Len() int {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.entries.Len()
+}
+
+// Codec returns the codec of the underlying Commander
+func (n *NearCache) Codec() Codec {
+	return codecOf(n.Commander)
+}
+
+// The caller holds the lock
+func (n *NearCache) remove(e *list.Element) {
+	entry := n.entries.Remove(e).(*nearEntry)
+	delete(n.index, entry.key)
+	if entry.key.hash {
+		fields := n.fields[entry.key.name]
+		delete(fields, entry.key.field)
+		if len(fields) == 0 {
+			delete(n.fields, entry.key.name)
+		}
+	}
+}
+
+func (n *NearCache) get(k nearKey) (interface{}, bool) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	e, found := n.index[k]
+	if !found {
+		return nil, false
+	}
+	entry := e.Value.(*nearEntry)
+	if n.now().After(entry.expires) {
+		n.remove(e)
+		return nil, false
+	}
+	n.entries.MoveToFront(e)
+	return entry.val, true
+}
+
+// Start a read of name, the version returned is passed to put or release
+func (n *NearCache) begin(name string) uint64 {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	r, found := n.pending[name]
+	if !found {
+		r = &nearRead{}
+		n.pending[name] = r
+	}
+	r.count++
+	return r.version
+}
+
+// End a read of name, it returns whether name was evicted since version.
+// The caller holds the lock
+func (n *NearCache) end(name string, version uint64) bool {
+	r := n.pending[name]
+	r.count--
+	if r.count == 0 {
+		delete(n.pending, name)
+	}
+	return r.version != version
+}
+
+// End a read that failed
+func (n *NearCache) release(name string, version uint64) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.end(name, version)
+}
+
+// Cache a reply read at version, unless its name was evicted since
+func (n *NearCache) put(k nearKey, val interface{}, version uint64) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.end(k.name, version) || n.size <= 0 {
+		return
+	}
+	entry := &nearEntry{key: k, val: val, expires: n.now().Add(n.ttl)}
+	if e, found := n.index[k]; found {
+		e.Value = entry
+		n.entries.MoveToFront(e)
+		return
+	}
+	e := n.entries.PushFront(entry)
+	n.index[k] = e
+	if k.hash {
+		if n.fields[k.name] == nil {
+			n.fields[k.name] = make(map[string]*list.Element)
+		}
+		n.fields[k.name][k.field] = e
+	}
+	for n.entries.Len() > n.size {
+		n.remove(n.entries.Back())
+	}
+}
+
+// Evict the names written and publish them
+func (n *NearCache) written(names ...string) {
+	n.Evict(names...)
+	n.mutex.Lock()
+	publish := n.publish
+	n.mutex.Unlock()
+	if publish != nil {
+		publish(names...)
+	}
+}
+
+func (n *NearCache) Get(key string) (interface{}, error) {
+	k := nearKey{name: key}
+	if val, found := n.get(k); found {
+		atomic.AddInt64(&n.hits, 1)
+		return val, nil
+	}
+	atomic.AddInt64(&n.misses, 1)
+	version := n.begin(key)
+	val, err := n.Commander.Get(key)
+	if err != nil {
+		n.release(key, version)
+		return val, err
+	}
+	n.put(k, val, version)
+	return val, nil
+}
+
+// MultiGet reads the keys missing from the cache with one MultiGet, the
+// pairs are in the order of ks. The pairs of the healthy shards of a
+// Cluster come with its MultiError and are cached.
+func (n *NearCache) MultiGet(ks ...string) ([]*KVPair, error) {
+	cached := make(map[string]interface{}, len(ks))
+	var missing []string
+	for _, key := range ks {
+		if val, found := n.get(nearKey{name: key}); found {
+			cached[key] = val
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	atomic.AddInt64(&n.hits, int64(len(cached)))
+	var err error
+	if len(missing) > 0 {
+		atomic.AddInt64(&n.misses, int64(len(missing)))
+		versions := make([]uint64, len(missing))
+		for i, key := range missing {
+			versions[i] = n.begin(key)
+		}
+		var (
+			pairs  []*KVPair
+			merr   MultiError
+			failed map[string]bool
+		)
+		pairs, err = n.Commander.MultiGet(missing...)
+		switch {
+		case err == nil:
+		case errors.As(err, &merr):
+			failed = make(map[string]bool)
+			for _, e := range merr {
+				for _, key := range e.Keys {
+					failed[key] = true
+				}
+			}
+		default:
+			for i, key := range missing {
+				n.release(key, versions[i])
+			}
+			return nil, err
+		}
+		for _, p := range pairs {
+			cached[p.Key] = p.Value
+		}
+		for i, key := range missing {
+			if failed[key] {
+				n.release(key, versions[i])
+				continue
+			}
+			n.put(nearKey{name: key}, cached[key], versions[i])
+		}
+	}
+	var pairs []*KVPair
+	for _, key := range ks {
+		if val := cached[key]; val != nil {
+			pairs = append(pairs, NewKVPair(key, val))
+		}
+	}
+	return pairs, err
+}
+
+func (n *NearCache) MultiGetOrdered(ks ...string) ([]*KVResult, error) {
+	pairs, err := n.MultiGet(ks...)
+	if err != nil && pairs == nil {
+		return nil, err
+	}
+	return alignPairs(ks, pairs), err
+}
+
+func (n *NearCache) MultiGetMap(ks ...string) (map[string]interface{}, error) {
+	pairs, err := n.MultiGet(ks...)
+	if err != nil && pairs == nil {
+		return nil, err
+	}
+	return pairsMap(pairs), err
+}
+
+func (n *NearCache) HGet(key, field string) (interface{}, error) {
+	k := nearKey{name: key, field: field, hash: true}
+	if val, found := n.get(k); found {
+		atomic.AddInt64(&n.hits, 1)
+		return val, nil
+	}
+	atomic.AddInt64(&n.misses, 1)
+	version := n.begin(key)
+	val, err := n.Commander.HGet(key, field)
+	if err != nil {
+		n.release(key, version)
+		return val, err
+	}
+	n.put(k, val, version)
+	return val, nil
+}
+
+func (n *NearCache) Set(key string, val string) (bool, error) {
+	defer n.written(key)
+	return n.Commander.Set(key, val)
+}
+
+func (n *NearCache) Setx(key string, val string, ttl int32) (bool, error) {
+	defer n.written(key)
+	return n.Commander.Setx(key, val, ttl)
+}
+
+func (n *NearCache) Setnx(key string, val string) (bool, error) {
+	defer n.written(key)
+	return n.Commander.Setnx(key, val)
+}
+
+func (n *NearCache) Getset(key string, val string) (interface{}, error) {
+	defer n.written(key)
+	return n.Commander.Getset(key, val)
+}
+
+func (n *NearCache) Del(key string) (bool, error) {
+	defer n.written(key)
+	return n.Commander.Del(key)
+}
+
+func (n *NearCache) MultiSet(ps ...*KVPair) (bool, error) {
+	keys := make([]string, len(ps))
+	for i, p := range ps {
+		keys[i] = p.Key
+	}
+	defer n.written(keys...)
+	return n.Commander.MultiSet(ps...)
+}
+
+func (n *NearCache) MultiDel(ks ...string) (bool, error) {
+	defer n.written(ks...)
+	return n.Commander.MultiDel(ks...)
+}
+
+func (n *NearCache) Expire(key string, ttl int) (int, error) {
+	defer n.written(key)
+	return n.Commander.Expire(key, ttl)
+}
+
+func (n *NearCache) Incr(key string, num int) (int64, error) {
+	defer n.written(key)
+	return n.Commander.Incr(key, num)
+}
+
+func (n *NearCache) Decr(key string, num int) (int64, error) {
+	defer n.written(key)
+	return n.Commander.Decr(key, num)
+}
+
+func (n *NearCache) HSet(key, field, val string) (bool, error) {
+	defer n.written(key)
+	return n.Commander.HSet(key, field, val)
+}
+
+func (n *NearCache) HDel(key, field string) (bool, error) {
+	defer n.written(key)
+	return n.Commander.HDel(key, field)
+}
+
+func (n *NearCache) HIncr(key, field string, num int) (int64, error) {
+	defer n.written(key)
+	return n.Commander.HIncr(key, field, num)
+}
+
+func (n *NearCache) HDecr(key, field string, num int) (int64, error) {
+	defer n.written(key)
+	return n.Commander.HDecr(key, field, num)
+}
+
+func (n *NearCache) HClear(key string) (bool, error) {
+	defer n.written(key)
+	return n.Commander.HClear(key)
+}
+
+func (n *NearCache) MultiHSet(key string, fvMap map[string]string) (bool, error) {
+	defer n.written(key)
+	return n.Commander.MultiHSet(key, fvMap)
+}
+
+func (n *NearCache) MultiHDel(key string, fieldList []string) (bool, error) {
+	defer n.written(key)
+	return n.Commander.MultiHDel(key, fieldList)
+}
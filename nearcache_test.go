@@ -0,0 +1,225 @@
+package gossdb
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bububa/gossdb/ssdbtest"
+)
+
+func newTestNearCache(t *testing.T, size int) *NearCache {
+	t.Helper()
+	srv := ssdbtest.NewServer()
+	t.Cleanup(func() { srv.Close() })
+	c, err := Connect(srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return NewNearCache(c, size, time.Minute)
+}
+
+// Holds the replies of Get until released
+type slowGet struct {
+	Commander
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (s *slowGet) Get(key string) (interface{}, error) {
+	val, err := s.Commander.Get(key)
+	s.read <- struct{}{}
+	<-s.release
+	return val, err
+}
+
+func TestNearCacheLRU(t *testing.T) {
+	n := newTestNearCache(t, 2)
+	for _, k := range []string{"a", "b", "c"} {
+		n.Set(k, "v:"+k)
+	}
+	n.Get("a")
+	n.Get("b")
+	// a is the least recently used
+	n.Get("b")
+	n.Get("c")
+	if n.Len() != 2 {
+		t.Fatalf("%d entries, want 2", n.Len())
+	}
+	hits, misses := n.Stats()
+	if hits != 1 || misses != 3 {
+		t.Fatalf("%d hits, %d misses, want 1 and 3", hits, misses)
+	}
+	n.Get("b")
+	n.Get("a")
+	if hits, misses := n.Stats(); hits != 2 || misses != 4 {
+		t.Fatalf("%d hits, %d misses, want b kept and a evicted", hits, misses)
+	}
+
+	n.MultiGet("a", "b", "c")
+	if hits, _ := n.Stats(); hits != 4 {
+		t.Fatalf("%d hits, want a and b cached", hits)
+	}
+}
+
+func TestNearCacheTTL(t *testing.T) {
+	n := newTestNearCache(t, 10)
+	now := time.Now()
+	n.now = func() time.Time { return now }
+	n.Set("k", "v")
+	n.HSet("h", "f", "v")
+	n.Get("k")
+	n.HGet("h", "f")
+	now = now.Add(time.Minute)
+	n.Get("k")
+	n.HGet("h", "f")
+	if hits, _ := n.Stats(); hits != 2 {
+		t.Fatalf("%d hits, want the entries cached until the ttl", hits)
+	}
+	now = now.Add(time.Second)
+	n.Get("k")
+	n.HGet("h", "f")
+	if hits, misses := n.Stats(); hits != 2 || misses != 4 {
+		t.Fatalf("%d hits, %d misses, want the entries expired", hits, misses)
+	}
+}
+
+func TestNearCacheEvict(t *testing.T) {
+	n := newTestNearCache(t, 10)
+	var published []string
+	n.SetPublisher(func(names ...string) {
+		published = append(published, names...)
+	})
+	n.Set("k", "v1")
+	n.HSet("h", "f", "v")
+	n.Get("k")
+	n.HGet("h", "f")
+	n.Set("k", "v2")
+	if v, _ := n.Get("k"); v != "v2" {
+		t.Fatalf("get after set = %v, want v2", v)
+	}
+	n.Evict("h")
+	if n.Len() != 1 {
+		t.Fatalf("%d entries, want the fields of h evicted", n.Len())
+	}
+	n.Purge()
+	if n.Len() != 0 {
+		t.Fatalf("%d entries after purge", n.Len())
+	}
+	if len(published) != 3 || published[2] != "k" {
+		t.Fatalf("published %v", published)
+	}
+
+	ch := make(chan string)
+	n.Listen(ch)
+	n.Get("k")
+	ch <- "k"
+	close(ch)
+	for i := 0; n.Len() != 0; i++ {
+		if i == 100 {
+			t.Fatal("key received on the channel not evicted")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// A reply read before a write of its key is not cached, the writes of
+// other keys do not drop it
+func TestNearCacheWriteRace(t *testing.T) {
+	n := newTestNearCache(t, 10)
+	slow := &slowGet{Commander: n.Commander, read: make(chan struct{}), release: make(chan struct{})}
+	n.Commander = slow
+	if _, err := n.Set("k", "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan interface{})
+	go func() {
+		v, _ := n.Get("k")
+		done <- v
+	}()
+	<-slow.read
+	if _, err := slow.Commander.Set("k", "new"); err != nil {
+		t.Fatal(err)
+	}
+	n.Evict("k")
+	slow.release <- struct{}{}
+	if v := <-done; v != "old" {
+		t.Fatalf("in flight get = %v, want old", v)
+	}
+	if n.Len() != 0 {
+		t.Fatal("reply read before the eviction cached")
+	}
+
+	go func() {
+		v, _ := n.Get("k")
+		done <- v
+	}()
+	<-slow.read
+	n.Evict("other")
+	n.Set("another", "v")
+	slow.release <- struct{}{}
+	if v := <-done; v != "new" {
+		t.Fatalf("get = %v, want new", v)
+	}
+	if n.Len() != 1 {
+		t.Fatal("reply dropped by the eviction of other keys")
+	}
+	if len(n.pending) != 0 {
+		t.Fatalf("%d reads still pending", len(n.pending))
+	}
+}
+
+// The keys of the healthy shards are returned with the MultiError and cached
+func TestNearCachePartialFailure(t *testing.T) {
+	var addrs []string
+	servers := make([]*ssdbtest.Server, 2)
+	for i := range servers {
+		servers[i] = ssdbtest.NewServer()
+		t.Cleanup(func() { servers[i].Close() })
+		addrs = append(addrs, servers[i].String())
+	}
+	c, err := NewCluster(addrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	n := NewNearCache(c, 100, time.Minute)
+	var keys []string
+	up := 0
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if _, err := c.Set(key, "v"); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+		if c.Route(key, false).Client.Addr() == servers[0].String() {
+			up++
+		}
+	}
+	if up == 0 || up == len(keys) {
+		t.Fatalf("%d of %d keys on the first shard", up, len(keys))
+	}
+	servers[1].Close()
+
+	var merr MultiError
+	pairs, err := n.MultiGet(keys...)
+	if !errors.As(err, &merr) || len(pairs) != up {
+		t.Fatalf("multi_get = %d pairs, %v, want %d pairs and a MultiError", len(pairs), err, up)
+	}
+	if n.Len() != up {
+		t.Fatalf("%d entries, want the %d keys of the healthy shard", n.Len(), up)
+	}
+	if len(n.pending) != 0 {
+		t.Fatalf("%d reads still pending", len(n.pending))
+	}
+	results, err := n.MultiGetOrdered(keys...)
+	if !errors.As(err, &merr) || len(results) != len(keys) {
+		t.Fatalf("ordered multi_get = %v, %v", results, err)
+	}
+	if hits, _ := n.Stats(); hits != int64(up) {
+		t.Fatalf("%d hits, want the keys of the healthy shard cached", hits)
+	}
+}
@@ -0,0 +1,204 @@
+package gossdb
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bububa/gossdb/protocol"
+)
+
+// Pipeline queues commands and sends them in a single write, the replies
+// are read back in order
+type Pipeline struct {
+	c    *Client
+	cmds [][]interface{}
+}
+
+func (c *Client) Pipeline() *Pipeline {
+	return &Pipeline{c: c}
+}
+
+// Do queues a raw command
+func (p *Pipeline) Do(args ...interface{}) {
+	p.cmds = append(p.cmds, args)
+}
+
+// Len returns the number of queued commands
+func (p *Pipeline) Len() int {
+	return len(p.cmds)
+}
+
+func (p *Pipeline) Exec() ([][]string, error) {
+	return p.ExecContext(context.Background())
+}
+
+type pipelineIndex struct{}
+
+type pipelineReply struct {
+	resp []string
+	err  error
+}
+
+type pipelineEvent struct {
+	idx   int
+	cmd   *Command
+	reply chan pipelineReply
+	done  bool
+}
+
+// ExecContext sends the queued commands and returns one reply per command.
+// Every command goes through the middleware chain of the client concurrently,
+// the ones reaching the end of the chain are sent together. The error is the
+// first error met by any command.
+func (p *Pipeline) ExecContext(ctx context.Context) ([][]string, error) {
+	cmds := p.cmds
+	p.cmds = nil
+	n := len(cmds)
+	if n == 0 {
+		return nil, nil
+	}
+
+	var (
+		mutex   sync.Mutex
+		flushed bool
+	)
+	events := make(chan pipelineEvent, 2*n)
+	terminal := func(ctx context.Context, cmd *Command) ([]string, error) {
+		idx, ok := ctx.Value(pipelineIndex{}).(int)
+		mutex.Lock()
+		if flushed || !ok {
+			// a middleware sent the command again after the batch was
+			// written or dropped the context, run it on its own
+			mutex.Unlock()
+			return p.c.exec(ctx, cmd)
+		}
+		reply := make(chan pipelineReply, 1)
+		events <- pipelineEvent{idx: idx, cmd: cmd, reply: reply}
+		mutex.Unlock()
+		r := <-reply
+		return r.resp, r.err
+	}
+	p.c.lock()
+	h := Chain(p.c.mws...)(terminal)
+	p.c.unlock()
+
+	results := make([]pipelineReply, n)
+	for i, args := range cmds {
+		go func(idx int, args []interface{}) {
+			cmd := &Command{Args: args, Addr: p.c.addr.String()}
+			resp, err := h(context.WithValue(ctx, pipelineIndex{}, idx), cmd)
+			results[idx] = pipelineReply{resp: resp, err: err}
+			events <- pipelineEvent{idx: idx, done: true}
+		}(i, args)
+	}
+
+	// wait until every command either reached the end of the chain or was
+	// answered by a middleware
+	var (
+		batch   []pipelineEvent
+		settled = make([]bool, n)
+		pending = n
+		done    = 0
+	)
+	for pending > 0 {
+		ev := <-events
+		if ev.done {
+			done++
+		}
+		if !settled[ev.idx] {
+			settled[ev.idx] = true
+			pending--
+		}
+		if !ev.done {
+			batch = append(batch, ev)
+		}
+	}
+	mutex.Lock()
+	flushed = true
+	mutex.Unlock()
+
+	sort.Slice(batch, func(i, j int) bool { return batch[i].idx < batch[j].idx })
+	batchCmds := make([]*Command, len(batch))
+	for i, ev := range batch {
+		batchCmds[i] = ev.cmd
+	}
+	resps, err := p.c.execBatch(batchCmds)
+	for i, ev := range batch {
+		if err != nil {
+			ev.reply <- pipelineReply{err: err}
+		} else {
+			ev.reply <- pipelineReply{resp: resps[i]}
+		}
+	}
+	for done < n {
+		if ev := <-events; ev.done {
+			done++
+		}
+	}
+
+	resps = make([][]string, n)
+	err = nil
+	for i, r := range results {
+		resps[i] = r.resp
+		if r.err != nil && err == nil {
+			err = r.err
+		}
+	}
+	return resps, err
+}
+
+// Write all the commands at once and read their replies. Pipelined commands
+// are not retried, the connection is reset on error.
+func (c *Client) execBatch(cmds []*Command) ([][]string, error) {
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+	c.lock()
+	defer c.unlock()
+	if c.retired {
+		defer c.close()
+	}
+	if c.sock == nil {
+		if err := c.connect(); err != nil {
+			return nil, err
+		}
+	}
+	var buf bytes.Buffer
+	for _, cmd := range cmds {
+		if err := protocol.Encode(&buf, cmd.Args...); err != nil {
+			return nil, err
+		}
+	}
+	start := time.Now()
+	c.sock.SetWriteDeadline(time.Now().Add(c.timeout))
+	n, err := c.sock.Write(buf.Bytes())
+	if c.metrics != nil {
+		c.metrics.AddBytesSent(c.addr.String(), n)
+	}
+	if err != nil {
+		c.reconnect()
+		return nil, err
+	}
+	// a command lasts from the previous reply to its own, the first one
+	// includes the write
+	resps := make([][]string, len(cmds))
+	durations := make([]time.Duration, len(cmds))
+	for i := range cmds {
+		resp, err := c.recv()
+		if err != nil {
+			c.reconnect()
+			return nil, err
+		}
+		resps[i] = resp
+		now := time.Now()
+		durations[i] = now.Sub(start)
+		start = now
+	}
+	for i, cmd := range cmds {
+		c.observe(cmd, resps[i], nil, durations[i])
+	}
+	return resps, nil
+}
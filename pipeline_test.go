@@ -0,0 +1,66 @@
+package gossdb_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bububa/gossdb"
+	"github.com/bububa/gossdb/ssdbtest"
+)
+
+// durations records the latency reported for every command
+type durations struct {
+	mutex sync.Mutex
+	list  []time.Duration
+}
+
+func (d *durations) ObserveCommand(cmd, addr, status string, dur time.Duration) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.list = append(d.list, dur)
+}
+
+func (d *durations) IncRetries(addr string)              {}
+func (d *durations) IncReconnects(addr string)           {}
+func (d *durations) AddBytesSent(addr string, n int)     {}
+func (d *durations) AddBytesReceived(addr string, n int) {}
+
+func newTestClient(t *testing.T) (*ssdbtest.Server, *gossdb.Client) {
+	t.Helper()
+	srv := ssdbtest.NewServer()
+	t.Cleanup(func() { srv.Close() })
+	c, err := gossdb.Connect(srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return srv, c
+}
+
+func TestPipelineDurations(t *testing.T) {
+	srv, c := newTestClient(t)
+	d := &durations{}
+	c.SetMetrics(d)
+	const n = 10
+	p := c.Pipeline()
+	for i := 0; i < n; i++ {
+		p.Do("set", "k", i)
+	}
+	srv.InjectFault(ssdbtest.Fault{Kind: ssdbtest.FaultSlowReply, Delay: 10 * time.Millisecond}, n)
+	start := time.Now()
+	if _, err := p.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+	if len(d.list) != n {
+		t.Fatalf("%d commands observed, want %d", len(d.list), n)
+	}
+	var sum time.Duration
+	for _, dur := range d.list {
+		sum += dur
+	}
+	if sum > elapsed {
+		t.Fatalf("commands lasted %v in total, longer than the %v batch", sum, elapsed)
+	}
+}
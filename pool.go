@@ -0,0 +1,378 @@
+package gossdb
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Pool spreads commands over several connections to the same server
+type Pool struct {
+	*pool
+	// ctx is given to the connections, see WithContext
+	ctx context.Context
+}
+
+type pool struct {
+	clients []*Client
+	next    uint32
+}
+
+func NewPool(addr *net.TCPAddr, size int) (*Pool, error) {
+	if size <= 0 {
+		return nil, ErrNotEnoughParams
+	}
+	p := &Pool{pool: &pool{}}
+	for i := 0; i < size; i++ {
+		s, err := Connect(addr)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.clients = append(p.clients, s)
+	}
+	return p, nil
+}
+
+// NewPoolFromClients spreads commands over clients, which may have their
+// own settings such as SetAuth. They connect on their first command if
+// they are not connected.
+func NewPoolFromClients(clients ...*Client) (*Pool, error) {
+	if len(clients) == 0 {
+		return nil, ErrNotEnoughParams
+	}
+	return &Pool{pool: &pool{clients: clients}}, nil
+}
+
+func (p *Pool) SetLogger(l Logger) {
+	for _, s := range p.clients {
+		s.SetLogger(l)
+	}
+}
+
+func (p *Pool) SetLogLevels(levels LogLevels) {
+	for _, s := range p.clients {
+		s.SetLogLevels(levels)
+	}
+}
+
+func (p *Pool) SetTimeout(d time.Duration) {
+	for _, s := range p.clients {
+		s.SetTimeout(d)
+	}
+}
+
+func (p *Pool) SetMaxReplySize(n int) {
+	for _, s := range p.clients {
+		s.SetMaxReplySize(n)
+	}
+}
+
+func (p *Pool) SetSlowThreshold(d time.Duration) {
+	for _, s := range p.clients {
+		s.SetSlowThreshold(d)
+	}
+}
+
+func (p *Pool) SetCodec(codec Codec) {
+	for _, s := range p.clients {
+		s.SetCodec(codec)
+	}
+}
+
+func (p *Pool) Codec() Codec {
+	return p.clients[0].Codec()
+}
+
+// Pick the next connection in round-robin order
+func (p *Pool) client() *Client {
+	n := atomic.AddUint32(&p.next, 1)
+	s := p.clients[n%uint32(len(p.clients))]
+	if p.ctx != nil {
+		return s.WithContext(p.ctx)
+	}
+	return s
+}
+
+// WithContext returns a pool sharing the connections of p whose commands
+// carry ctx through the middleware chain
+func (p *Pool) WithContext(ctx context.Context) *Pool {
+	return &Pool{pool: p.pool, ctx: ctx}
+}
+
+func (p *Pool) Do(retries int, args ...interface{}) ([]string, error) {
+	return p.client().Do(retries, args...)
+}
+
+func (p *Pool) Set(key string, val string) (bool, error) {
+	return p.client().Set(key, val)
+}
+
+func (p *Pool) Setx(key string, val string, ttl int32) (bool, error) {
+	return p.client().Setx(key, val, ttl)
+}
+
+func (p *Pool) Setnx(key string, val string) (bool, error) {
+	return p.client().Setnx(key, val)
+}
+
+func (p *Pool) Get(key string) (interface{}, error) {
+	return p.client().Get(key)
+}
+
+func (p *Pool) Getset(key string, val string) (interface{}, error) {
+	return p.client().Getset(key, val)
+}
+
+func (p *Pool) Del(key string) (bool, error) {
+	return p.client().Del(key)
+}
+
+func (p *Pool) MultiSet(pairs ...*KVPair) (bool, error) {
+	return p.client().MultiSet(pairs...)
+}
+
+func (p *Pool) MultiGet(ks ...string) ([]*KVPair, error) {
+	return p.client().MultiGet(ks...)
+}
+
+func (p *Pool) MultiGetOrdered(ks ...string) ([]*KVResult, error) {
+	return p.client().MultiGetOrdered(ks...)
+}
+
+func (p *Pool) MultiGetMap(ks ...string) (map[string]interface{}, error) {
+	return p.client().MultiGetMap(ks...)
+}
+
+func (p *Pool) MultiDel(ks ...string) (bool, error) {
+	return p.client().MultiDel(ks...)
+}
+
+func (p *Pool) Scan(startKey string, endKey string, limit int) ([][2]string, error) {
+	return p.client().Scan(startKey, endKey, limit)
+}
+
+func (p *Pool) Exists(key string) (bool, error) {
+	return p.client().Exists(key)
+}
+
+func (p *Pool) Expire(key string, ttl int) (int, error) {
+	return p.client().Expire(key, ttl)
+}
+
+func (p *Pool) TTL(key string) (int64, error) {
+	return p.client().TTL(key)
+}
+
+func (p *Pool) Incr(key string, num int) (int64, error) {
+	return p.client().Incr(key, num)
+}
+
+func (p *Pool) Decr(key string, num int) (int64, error) {
+	return p.client().Decr(key, num)
+}
+
+func (p *Pool) HSet(key, field, val string) (bool, error) {
+	return p.client().HSet(key, field, val)
+}
+
+func (p *Pool) HGet(key, field string) (interface{}, error) {
+	return p.client().HGet(key, field)
+}
+
+func (p *Pool) HDel(key, field string) (bool, error) {
+	return p.client().HDel(key, field)
+}
+
+func (p *Pool) HIncr(key, field string, num int) (int64, error) {
+	return p.client().HIncr(key, field, num)
+}
+
+func (p *Pool) HDecr(key, field string, num int) (int64, error) {
+	return p.client().HDecr(key, field, num)
+}
+
+func (p *Pool) HExists(key, field string) (bool, error) {
+	return p.client().HExists(key, field)
+}
+
+func (p *Pool) HSize(key string) (int64, error) {
+	return p.client().HSize(key)
+}
+
+func (p *Pool) HList(startKey, endKey string, limit int) ([]string, error) {
+	return p.client().HList(startKey, endKey, limit)
+}
+
+func (p *Pool) HKeys(key, startField, endField string, limit int) ([]string, error) {
+	return p.client().HKeys(key, startField, endField, limit)
+}
+
+func (p *Pool) HScan(key, startField, endField string, limit int) ([][2]string, error) {
+	return p.client().HScan(key, startField, endField, limit)
+}
+
+func (p *Pool) HRScan(key, startField, endField string, limit int) ([][2]string, error) {
+	return p.client().HRScan(key, startField, endField, limit)
+}
+
+func (p *Pool) HClear(key string) (bool, error) {
+	return p.client().HClear(key)
+}
+
+func (p *Pool) MultiHSet(key string, fvMap map[string]string) (bool, error) {
+	return p.client().MultiHSet(key, fvMap)
+}
+
+func (p *Pool) MultiHGet(key string, fieldList []string) (map[string]string, error) {
+	return p.client().MultiHGet(key, fieldList)
+}
+
+func (p *Pool) MultiHDel(key string, fieldList []string) (bool, error) {
+	return p.client().MultiHDel(key, fieldList)
+}
+
+func (p *Pool) ZSet(key, ele string, score int) (bool, error) {
+	return p.client().ZSet(key, ele, score)
+}
+
+func (p *Pool) ZGet(key, ele string) (interface{}, error) {
+	return p.client().ZGet(key, ele)
+}
+
+func (p *Pool) ZDel(key, ele string) (bool, error) {
+	return p.client().ZDel(key, ele)
+}
+
+func (p *Pool) ZIncr(key, ele string, num int) (int64, error) {
+	return p.client().ZIncr(key, ele, num)
+}
+
+func (p *Pool) ZSize(key string) (int64, error) {
+	return p.client().ZSize(key)
+}
+
+func (p *Pool) ZExists(key, ele string) (bool, error) {
+	return p.client().ZExists(key, ele)
+}
+
+func (p *Pool) ZList(startKey, endKey string, limit int) ([]string, error) {
+	return p.client().ZList(startKey, endKey, limit)
+}
+
+func (p *Pool) ZKeys(key, startEle string, scoreStart, scoreEnd, limit int) ([]string, error) {
+	return p.client().ZKeys(key, startEle, scoreStart, scoreEnd, limit)
+}
+
+func (p *Pool) ZScan(key, startEle string, scoreStart, scoreEnd, limit int) (map[string]int64, error) {
+	return p.client().ZScan(key, startEle, scoreStart, scoreEnd, limit)
+}
+
+func (p *Pool) ZRScan(key, startEle string, scoreStart, scoreEnd, limit int) (map[string]int64, error) {
+	return p.client().ZRScan(key, startEle, scoreStart, scoreEnd, limit)
+}
+
+func (p *Pool) ZRank(key, ele string) (int64, error) {
+	return p.client().ZRank(key, ele)
+}
+
+func (p *Pool) ZRRank(key, ele string) (int64, error) {
+	return p.client().ZRRank(key, ele)
+}
+
+func (p *Pool) ZRange(key string, offset, limit int) ([][2]interface{}, error) {
+	return p.client().ZRange(key, offset, limit)
+}
+
+func (p *Pool) ZRRange(key string, offset, limit int) ([][2]interface{}, error) {
+	return p.client().ZRRange(key, offset, limit)
+}
+
+func (p *Pool) ZClear(key string) (bool, error) {
+	return p.client().ZClear(key)
+}
+
+func (p *Pool) MultiZSet(key string, esMap map[string]int) (bool, error) {
+	return p.client().MultiZSet(key, esMap)
+}
+
+func (p *Pool) MultiZGet(key string, eleList []string) (map[string]int64, error) {
+	return p.client().MultiZGet(key, eleList)
+}
+
+func (p *Pool) MultiZDel(key string, eleList []string) (bool, error) {
+	return p.client().MultiZDel(key, eleList)
+}
+
+func (p *Pool) QSize(key string) (int64, error) {
+	return p.client().QSize(key)
+}
+
+func (p *Pool) QClear(key string) (bool, error) {
+	return p.client().QClear(key)
+}
+
+func (p *Pool) QFront(key string) (string, error) {
+	return p.client().QFront(key)
+}
+
+func (p *Pool) QBack(key string) (string, error) {
+	return p.client().QBack(key)
+}
+
+func (p *Pool) QGet(key string, index int) (interface{}, error) {
+	return p.client().QGet(key, index)
+}
+
+func (p *Pool) QSlice(key string, begin, end int) ([]string, error) {
+	return p.client().QSlice(key, begin, end)
+}
+
+func (p *Pool) QList(startKey, endKey string, limit int) ([]string, error) {
+	return p.client().QList(startKey, endKey, limit)
+}
+
+func (p *Pool) QPush(key, item string) (bool, error) {
+	return p.client().QPush(key, item)
+}
+
+func (p *Pool) QPushFront(key, item string) (bool, error) {
+	return p.client().QPushFront(key, item)
+}
+
+func (p *Pool) QPushBack(key, item string) (bool, error) {
+	return p.client().QPushBack(key, item)
+}
+
+func (p *Pool) QPop(key string) (interface{}, error) {
+	return p.client().QPop(key)
+}
+
+func (p *Pool) QPopFront(key string) (interface{}, error) {
+	return p.client().QPopFront(key)
+}
+
+func (p *Pool) QPopBack(key string) (interface{}, error) {
+	return p.client().QPopBack(key)
+}
+
+// Reconnect every connection of the pool
+func (p *Pool) Reconnect() error {
+	for _, s := range p.clients {
+		if err := s.Reconnect(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Pool) Close() error {
+	var err error
+	for _, s := range p.clients {
+		if err2 := s.Close(); err2 != nil && err == nil {
+			err = err2
+		}
+	}
+	return err
+}
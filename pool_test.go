@@ -0,0 +1,58 @@
+package gossdb_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/bububa/gossdb"
+	"github.com/bububa/gossdb/ssdbtest"
+)
+
+func TestPool(t *testing.T) {
+	srv := ssdbtest.NewServer()
+	defer srv.Close()
+	if _, err := gossdb.NewPool(srv.Addr(), 0); err != gossdb.ErrNotEnoughParams {
+		t.Fatalf("empty pool error = %v", err)
+	}
+	p, err := gossdb.NewPool(srv.Addr(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("k%d", i)
+			if _, err := p.Set(key, key); err != nil {
+				t.Error(err)
+			}
+			if v, err := p.Get(key); v != key || err != nil {
+				t.Errorf("get %s = %v, %v", key, v, err)
+			}
+			if _, err := p.Incr("n", 1); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if v, err := p.Get("n"); v != "30" || err != nil {
+		t.Fatalf("get n = %v, %v", v, err)
+	}
+	m, err := p.MultiGetMap("k0", "k29", "missing")
+	if err != nil || len(m) != 2 {
+		t.Fatalf("multi_get = %v, %v", m, err)
+	}
+}
+
+func TestPoolUnreachable(t *testing.T) {
+	srv := ssdbtest.NewServer()
+	addr := srv.Addr()
+	srv.Close()
+	if _, err := gossdb.NewPool(addr, 2); err == nil {
+		t.Fatal("NewPool succeeded, want an error")
+	}
+}
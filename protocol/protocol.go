@@ -0,0 +1,207 @@
+// Package protocol implements the SSDB wire format. Requests and replies are
+// blocks of values, each value is its length on a line followed by its bytes
+// and a newline, and an empty line ends the block:
+//
+//	3
+//	get
+//	3
+//	key
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// DefaultMaxSize bounds the size of a value read by a Reader
+const DefaultMaxSize = 64 << 20
+
+var (
+	ErrMalformed = fmt.Errorf("protocol: malformed block")
+	ErrTooLarge  = fmt.Errorf("protocol: block too large")
+)
+
+// Encode appends a block of command arguments to buf. Strings and byte
+// slices are sent as is, a []string is expanded, numbers are formatted in
+// decimal and booleans as 1 or 0.
+func Encode(buf *bytes.Buffer, args ...interface{}) error {
+	for _, arg := range args {
+		var s string
+		switch arg := arg.(type) {
+		case string:
+			s = arg
+		case []byte:
+			s = string(arg)
+		case []string:
+			for _, s := range arg {
+				appendValue(buf, s)
+			}
+			continue
+		case int, int32, int64, uint, uint32, uint64:
+			s = fmt.Sprintf("%d", arg)
+		case float32, float64:
+			s = fmt.Sprintf("%f", arg)
+		case bool:
+			if arg {
+				s = "1"
+			} else {
+				s = "0"
+			}
+		case nil:
+			s = ""
+		default:
+			return fmt.Errorf("bad request:%v", arg)
+		}
+		appendValue(buf, s)
+	}
+	buf.WriteByte('\n')
+	return nil
+}
+
+// Append appends a block of values to buf
+func Append(buf []byte, values ...string) []byte {
+	for _, v := range values {
+		buf = strconv.AppendInt(buf, int64(len(v)), 10)
+		buf = append(buf, '\n')
+		buf = append(buf, v...)
+		buf = append(buf, '\n')
+	}
+	return append(buf, '\n')
+}
+
+func appendValue(buf *bytes.Buffer, s string) {
+	buf.WriteString(strconv.Itoa(len(s)))
+	buf.WriteByte('\n')
+	buf.WriteString(s)
+	buf.WriteByte('\n')
+}
+
+// Parse decodes the first block of buf and returns it with the number of
+// bytes it used. It returns no values and 0 when buf holds an incomplete
+// block. Values larger than max are rejected with ErrTooLarge.
+func Parse(buf []byte, max int) ([]string, int, error) {
+	var (
+		values []string
+		offset int
+	)
+	for {
+		idx := bytes.IndexByte(buf[offset:], '\n')
+		if idx == -1 {
+			return nil, 0, nil
+		}
+		p := buf[offset : offset+idx]
+		offset += idx + 1
+		if len(p) == 0 || (len(p) == 1 && p[0] == '\r') {
+			if len(values) == 0 {
+				continue
+			}
+			return values, offset, nil
+		}
+		size, err := strconv.Atoi(string(p))
+		if err != nil || size < 0 {
+			return nil, 0, ErrMalformed
+		}
+		if size > max {
+			return nil, 0, ErrTooLarge
+		}
+		if offset+size >= len(buf) {
+			return nil, 0, nil
+		}
+		values = append(values, string(buf[offset:offset+size]))
+		offset += size + 1
+	}
+}
+
+// Reader reads blocks from a stream
+type Reader struct {
+	r   *bufio.Reader
+	max int
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r), max: DefaultMaxSize}
+}
+
+// SetMaxSize bounds the size of a value
+func (r *Reader) SetMaxSize(n int) {
+	r.max = n
+}
+
+// Buffered returns the number of bytes read ahead, a pipelined request is
+// waiting when it is not zero
+func (r *Reader) Buffered() int {
+	return r.r.Buffered()
+}
+
+// ReadBlock reads the next block. It returns io.EOF when the stream ends
+// between two blocks.
+func (r *Reader) ReadBlock() ([]string, error) {
+	var values []string
+	for {
+		line, err := r.r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			return nil, ErrMalformed
+		}
+		if err != nil {
+			if err == io.EOF && (len(values) > 0 || len(line) > 0) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 {
+			if len(values) == 0 {
+				continue
+			}
+			return values, nil
+		}
+		size, err := strconv.Atoi(string(line))
+		if err != nil || size < 0 {
+			return nil, ErrMalformed
+		}
+		if size > r.max {
+			return nil, ErrTooLarge
+		}
+		buf := make([]byte, size+1)
+		if _, err := io.ReadFull(r.r, buf); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		values = append(values, string(buf[:size]))
+	}
+}
+
+// Writer writes blocks to a stream, they are buffered until Flush
+type Writer struct {
+	w *bufio.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// WriteBlock writes a block of values
+func (w *Writer) WriteBlock(values ...string) error {
+	var buf [32]byte
+	for _, v := range values {
+		w.w.Write(strconv.AppendInt(buf[:0], int64(len(v)), 10))
+		w.w.WriteByte('\n')
+		w.w.WriteString(v)
+		w.w.WriteByte('\n')
+	}
+	return w.w.WriteByte('\n')
+}
+
+// Write writes raw bytes, it lets tests produce broken blocks
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.w.Write(p)
+}
+
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
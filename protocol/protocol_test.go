@@ -0,0 +1,93 @@
+package protocol
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	var buf bytes.Buffer
+	err := Encode(&buf, "set", []byte("k"), 42, int64(-1), true, false, nil, []string{"a", "bc"}, 1.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "3\nset\n1\nk\n2\n42\n2\n-1\n1\n1\n1\n0\n0\n\n1\na\n2\nbc\n8\n1.500000\n\n"
+	if buf.String() != want {
+		t.Fatalf("encoded %q, want %q", buf.String(), want)
+	}
+	if err := Encode(&buf, struct{}{}); err == nil {
+		t.Fatal("encoded a struct, want an error")
+	}
+}
+
+func TestParse(t *testing.T) {
+	block := Append(nil, "ok", "", "a\nb")
+	values, n, err := Parse(append(block, "2\nok\n\n"...), DefaultMaxSize)
+	if err != nil || n != len(block) || !reflect.DeepEqual(values, []string{"ok", "", "a\nb"}) {
+		t.Fatalf("parse = %q, %d, %v", values, n, err)
+	}
+	// incomplete blocks wait for more data
+	for i := 0; i < len(block); i++ {
+		if values, n, err := Parse(block[:i], DefaultMaxSize); values != nil || n != 0 || err != nil {
+			t.Fatalf("parse of %d bytes = %q, %d, %v", i, values, n, err)
+		}
+	}
+	if _, _, err := Parse([]byte("x\nok\n\n"), DefaultMaxSize); err != ErrMalformed {
+		t.Fatalf("malformed error = %v", err)
+	}
+	if _, _, err := Parse([]byte("5\nhello\n\n"), 4); err != ErrTooLarge {
+		t.Fatalf("too large error = %v", err)
+	}
+	values, _, err = Parse([]byte("\r\n2\nok\r\n\r\n"), DefaultMaxSize)
+	if err != nil || !reflect.DeepEqual(values, []string{"ok"}) {
+		t.Fatalf("parse with CRLF = %q, %v", values, err)
+	}
+}
+
+func TestReaderWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.WriteBlock("get", "k")
+	w.WriteBlock("ok")
+	if buf.Len() != 0 {
+		t.Fatal("written before Flush")
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	r := NewReader(&buf)
+	for _, want := range [][]string{{"get", "k"}, {"ok"}} {
+		values, err := r.ReadBlock()
+		if err != nil || !reflect.DeepEqual(values, want) {
+			t.Fatalf("read = %q, %v, want %q", values, err, want)
+		}
+	}
+	if _, err := r.ReadBlock(); err != io.EOF {
+		t.Fatalf("read at the end = %v, want EOF", err)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		max   int
+		err   error
+	}{
+		{"3\nget", DefaultMaxSize, io.ErrUnexpectedEOF},
+		{"3\nget\n1\n", DefaultMaxSize, io.ErrUnexpectedEOF},
+		{"-1\n\n", DefaultMaxSize, ErrMalformed},
+		{"abc\n\n", DefaultMaxSize, ErrMalformed},
+		{"10\n0123456789\n\n", 9, ErrTooLarge},
+		{strings.Repeat("1", 8192), DefaultMaxSize, ErrMalformed},
+	}
+	for _, tt := range tests {
+		r := NewReader(strings.NewReader(tt.input))
+		r.SetMaxSize(tt.max)
+		if _, err := r.ReadBlock(); err != tt.err {
+			t.Errorf("read %.20q = %v, want %v", tt.input, err, tt.err)
+		}
+	}
+}
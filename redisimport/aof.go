@@ -0,0 +1,92 @@
+package redisimport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ParseAOF calls fn with the arguments of every command of an append only
+// file. The entries of a RDB preamble, written when aof-use-rdb-preamble is
+// on, are given to rdb. The annotation lines starting with # are skipped.
+func ParseAOF(r io.Reader, rdb func(e *Entry) error, fn func(args []string) error) error {
+	br := bufio.NewReader(r)
+	if head, _ := br.Peek(5); string(head) == "REDIS" {
+		if err := parseRDB(br, rdb); err != nil {
+			return err
+		}
+	}
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch b {
+		case '#':
+			if _, err := br.ReadString('\n'); err != nil {
+				return unexpected(err)
+			}
+			continue
+		case '\r', '\n':
+			continue
+		case '*':
+		default:
+			return fmt.Errorf("redisimport: bad AOF command start %q", b)
+		}
+		n, err := readLength(br)
+		if err != nil {
+			return err
+		}
+		args := make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			if b, err := br.ReadByte(); err != nil {
+				return unexpected(err)
+			} else if b != '$' {
+				return fmt.Errorf("redisimport: bad AOF argument start %q", b)
+			}
+			size, err := readLength(br)
+			if err != nil {
+				return err
+			}
+			buf := make([]byte, size+2)
+			if _, err := io.ReadFull(br, buf); err != nil {
+				return unexpected(err)
+			}
+			args = append(args, string(buf[:size]))
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if err := fn(args); err != nil {
+			return err
+		}
+	}
+}
+
+// Read the number ending a *n or $n line
+func readLength(br *bufio.Reader) (int, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return 0, unexpected(err)
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return 0, fmt.Errorf("redisimport: bad AOF line %q", line)
+	}
+	n, err := strconv.Atoi(line[:len(line)-2])
+	if err != nil || n < 0 || n > maxString {
+		return 0, fmt.Errorf("redisimport: bad AOF length %q", line)
+	}
+	return n, nil
+}
+
+// An AOF ending in the middle of a command is truncated
+func unexpected(err error) error {
+	if err == nil || err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,227 @@
+package redisimport
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+// cursor reads a blob of a compact encoding, ok turns false when a read
+// goes past its end
+type cursor struct {
+	b   []byte
+	pos int
+	ok  bool
+}
+
+func newCursor(b []byte, pos int) *cursor {
+	return &cursor{b: b, pos: pos, ok: pos <= len(b)}
+}
+
+func (c *cursor) next(n int) []byte {
+	if !c.ok || n < 0 || c.pos+n > len(c.b) {
+		c.ok = false
+		return make([]byte, 8)
+	}
+	b := c.b[c.pos : c.pos+n]
+	c.pos += n
+	return b
+}
+
+func (c *cursor) byte() byte {
+	return c.next(1)[0]
+}
+
+// Signed little endian integer of 1 to 8 bytes
+func (c *cursor) int(n int) int64 {
+	b := c.next(n)
+	var v uint64
+	for i := n - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	shift := uint(64 - 8*n)
+	return int64(v<<shift) >> shift
+}
+
+func itoa(v int64) string {
+	return strconv.FormatInt(v, 10)
+}
+
+// ziplist: zlbytes(4) zltail(4) zllen(2) entries 0xFF
+func ziplist(b []byte) ([]string, error) {
+	c := newCursor(b, 10)
+	list := []string{}
+	for c.ok && c.pos < len(c.b) {
+		if c.b[c.pos] == 0xFF {
+			return list, nil
+		}
+		// previous entry length
+		if c.byte() == 0xFE {
+			c.next(4)
+		}
+		enc := c.byte()
+		switch enc >> 6 {
+		case 0:
+			list = append(list, string(c.next(int(enc&0x3f))))
+		case 1:
+			list = append(list, string(c.next(int(enc&0x3f)<<8|int(c.byte()))))
+		case 2:
+			list = append(list, string(c.next(int(binary.BigEndian.Uint32(c.next(4))))))
+		default:
+			switch {
+			case enc == 0xC0:
+				list = append(list, itoa(c.int(2)))
+			case enc == 0xD0:
+				list = append(list, itoa(c.int(4)))
+			case enc == 0xE0:
+				list = append(list, itoa(c.int(8)))
+			case enc == 0xF0:
+				list = append(list, itoa(c.int(3)))
+			case enc == 0xFE:
+				list = append(list, itoa(c.int(1)))
+			case enc >= 0xF1 && enc <= 0xFD:
+				list = append(list, itoa(int64(enc&0x0f)-1))
+			default:
+				return nil, fmt.Errorf("redisimport: bad ziplist encoding %#x", enc)
+			}
+		}
+	}
+	return nil, fmt.Errorf("redisimport: truncated ziplist")
+}
+
+// listpack: total bytes(4) count(2) entries 0xFF, every entry is followed
+// by its length on 1 to 5 bytes
+func listpack(b []byte) ([]string, error) {
+	c := newCursor(b, 6)
+	list := []string{}
+	for c.ok && c.pos < len(c.b) {
+		start := c.pos
+		enc := c.byte()
+		switch {
+		case enc == 0xFF:
+			return list, nil
+		case enc&0x80 == 0:
+			list = append(list, itoa(int64(enc)))
+		case enc&0xC0 == 0x80:
+			list = append(list, string(c.next(int(enc&0x3f))))
+		case enc&0xE0 == 0xC0:
+			v := int64(enc&0x1f)<<8 | int64(c.byte())
+			if v >= 1<<12 {
+				v -= 1 << 13
+			}
+			list = append(list, itoa(v))
+		case enc&0xF0 == 0xE0:
+			list = append(list, string(c.next(int(enc&0x0f)<<8|int(c.byte()))))
+		case enc == 0xF0:
+			list = append(list, string(c.next(int(binary.LittleEndian.Uint32(c.next(4))))))
+		case enc == 0xF1:
+			list = append(list, itoa(c.int(2)))
+		case enc == 0xF2:
+			list = append(list, itoa(c.int(3)))
+		case enc == 0xF3:
+			list = append(list, itoa(c.int(4)))
+		case enc == 0xF4:
+			list = append(list, itoa(c.int(8)))
+		default:
+			return nil, fmt.Errorf("redisimport: bad listpack encoding %#x", enc)
+		}
+		switch l := c.pos - start; {
+		case l <= 127:
+			c.next(1)
+		case l < 16383:
+			c.next(2)
+		case l < 2097151:
+			c.next(3)
+		case l < 268435455:
+			c.next(4)
+		default:
+			c.next(5)
+		}
+	}
+	return nil, fmt.Errorf("redisimport: truncated listpack")
+}
+
+// intset: encoding(4) length(4) then the integers of encoding bytes
+func intset(b []byte) ([]string, error) {
+	c := newCursor(b, 0)
+	size := int(binary.LittleEndian.Uint32(c.next(4)))
+	n := int(binary.LittleEndian.Uint32(c.next(4)))
+	if size != 2 && size != 4 && size != 8 {
+		return nil, fmt.Errorf("redisimport: bad intset encoding %d", size)
+	}
+	list := make([]string, 0, n)
+	for i := 0; i < n && c.ok; i++ {
+		list = append(list, itoa(c.int(size)))
+	}
+	if !c.ok {
+		return nil, fmt.Errorf("redisimport: truncated intset")
+	}
+	return list, nil
+}
+
+// zipmap: count(1) then key length, key, value length, free, value, free
+// bytes until 0xFF
+func zipmap(b []byte) ([]string, error) {
+	c := newCursor(b, 1)
+	size := func() int {
+		n := c.byte()
+		if n == 254 {
+			return int(binary.LittleEndian.Uint32(c.next(4)))
+		}
+		return int(n)
+	}
+	list := []string{}
+	for c.ok {
+		klen := size()
+		if klen == 255 {
+			return list, nil
+		}
+		key := string(c.next(klen))
+		vlen := size()
+		free := int(c.byte())
+		list = append(list, key, string(c.next(vlen)))
+		c.next(free)
+	}
+	return nil, fmt.Errorf("redisimport: truncated zipmap")
+}
+
+// Decompress the LZF strings of RDB files
+func lzfDecompress(in []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 32 {
+			n := ctrl + 1
+			if i+n > len(in) {
+				return nil, fmt.Errorf("redisimport: bad lzf string")
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return nil, fmt.Errorf("redisimport: bad lzf string")
+			}
+			n += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, fmt.Errorf("redisimport: bad lzf string")
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		if ref < 0 || len(out)+n+2 > size {
+			return nil, fmt.Errorf("redisimport: bad lzf string")
+		}
+		for j := 0; j < n+2; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != size {
+		return nil, fmt.Errorf("redisimport: bad lzf string")
+	}
+	return out, nil
+}
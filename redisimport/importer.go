@@ -0,0 +1,497 @@
+package redisimport
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bububa/gossdb"
+)
+
+const (
+	// DefaultBatchSize is the number of commands queued before the
+	// pipelines are sent
+	DefaultBatchSize = 500
+	// Fields, members or items per multi command
+	itemsPerCommand = 100
+)
+
+// Stats counts what an import did
+type Stats struct {
+	// Keys of a RDB written
+	Keys int
+	// Commands sent to SSDB
+	Commands int
+	// Keys whose expiration had passed
+	Expired int
+	// Keys of a type SSDB lacks, module data and AOF commands without an
+	// equivalent
+	Skipped int
+	// Zset scores that were not integers
+	Rounded int
+	// Hashes, zsets and lists whose expiration was dropped, SSDB only
+	// expires KVs
+	TTLDropped int
+}
+
+// Importer writes Redis keys and commands to a Client or a Cluster with one
+// pipeline per server
+type Importer struct {
+	route   func(key string) *gossdb.Client
+	pipes   map[*gossdb.Client]*gossdb.Pipeline
+	clients []*gossdb.Client
+	pending int
+	batch   int
+	db      int
+	// database selected by the AOF
+	selected int
+	// kinds are the hashes, zsets and lists written, an expiration of
+	// these keys is dropped
+	kinds map[string]Kind
+	stats Stats
+	now   func() time.Time
+}
+
+func NewImporter(c *gossdb.Client) *Importer {
+	return newImporter(func(key string) *gossdb.Client { return c })
+}
+
+// NewClusterImporter writes every key to the master of its shard
+func NewClusterImporter(c *gossdb.Cluster) *Importer {
+	return newImporter(func(key string) *gossdb.Client { return c.Route(key, false).Client })
+}
+
+func newImporter(route func(key string) *gossdb.Client) *Importer {
+	return &Importer{
+		route: route,
+		pipes: make(map[*gossdb.Client]*gossdb.Pipeline),
+		batch: DefaultBatchSize,
+		db:    -1,
+		kinds: make(map[string]Kind),
+		now:   time.Now,
+	}
+}
+
+func (im *Importer) SetBatchSize(n int) {
+	if n > 0 {
+		im.batch = n
+	}
+}
+
+// SetDB imports only the keys of a Redis database, -1 imports them all
+func (im *Importer) SetDB(db int) {
+	im.db = db
+}
+
+func (im *Importer) Stats() Stats {
+	return im.stats
+}
+
+// ImportRDB writes the keys of a RDB file. The commands queued before an
+// error are still sent.
+func (im *Importer) ImportRDB(r io.Reader) error {
+	err := ParseRDB(r, im.entry)
+	if ferr := im.flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// ImportAOF replays the commands of an append only file, and the keys of
+// its RDB preamble.
+func (im *Importer) ImportAOF(r io.Reader) error {
+	err := ParseAOF(r, im.entry, im.command)
+	if ferr := im.flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// Queue a command to the server of key
+func (im *Importer) send(key string, args ...interface{}) error {
+	c := im.route(key)
+	p, found := im.pipes[c]
+	if !found {
+		p = c.Pipeline()
+		im.pipes[c] = p
+		im.clients = append(im.clients, c)
+	}
+	p.Do(args...)
+	im.stats.Commands++
+	im.pending++
+	if im.pending >= im.batch {
+		return im.flush()
+	}
+	return nil
+}
+
+// Queue values in multi commands of up to itemsPerCommand items
+func (im *Importer) sendMulti(key string, cmd string, values []interface{}, width int) error {
+	for len(values) > 0 {
+		n := itemsPerCommand * width
+		if n > len(values) {
+			n = len(values)
+		}
+		args := append([]interface{}{cmd, key}, values[:n]...)
+		if err := im.send(key, args...); err != nil {
+			return err
+		}
+		values = values[n:]
+	}
+	return nil
+}
+
+func (im *Importer) flush() error {
+	im.pending = 0
+	for _, c := range im.clients {
+		p := im.pipes[c]
+		if p.Len() == 0 {
+			continue
+		}
+		replies, err := p.Exec()
+		if err != nil {
+			return err
+		}
+		for _, resp := range replies {
+			if len(resp) == 0 || (resp[0] != "ok" && resp[0] != "not_found") {
+				return fmt.Errorf("redisimport: %s: %s", c.Addr(), strings.Join(resp, " "))
+			}
+		}
+	}
+	return nil
+}
+
+func (im *Importer) entry(e *Entry) error {
+	if im.db >= 0 && e.DB != im.db {
+		return nil
+	}
+	var ttl int64
+	if !e.ExpireAt.IsZero() {
+		if ttl = seconds(e.ExpireAt.Sub(im.now())); ttl <= 0 {
+			im.stats.Expired++
+			return nil
+		}
+	}
+	if ttl > 0 && (e.Kind == Hash || e.Kind == ZSet || e.Kind == List) {
+		im.stats.TTLDropped++
+	}
+	var values []interface{}
+	switch e.Kind {
+	case String:
+		delete(im.kinds, e.Key)
+		im.stats.Keys++
+		if ttl > 0 {
+			return im.send(e.Key, "setx", e.Key, e.Value, ttl)
+		}
+		return im.send(e.Key, "set", e.Key, e.Value)
+	case Hash:
+		im.kinds[e.Key] = Hash
+		for f, v := range e.Fields {
+			values = append(values, f, v)
+		}
+		return im.replace(e.Key, "hclear", "multi_hset", values, 2)
+	case ZSet:
+		im.kinds[e.Key] = ZSet
+		for m, s := range e.Scores {
+			values = append(values, m, im.score(s))
+		}
+		return im.replace(e.Key, "zclear", "multi_zset", values, 2)
+	case List:
+		im.kinds[e.Key] = List
+		for _, item := range e.Items {
+			values = append(values, item)
+		}
+		return im.replace(e.Key, "qclear", "qpush_back", values, 1)
+	}
+	im.stats.Skipped++
+	return nil
+}
+
+// Clear a hash, zset or queue and write its values, so an import can be
+// run again
+func (im *Importer) replace(key, clear, cmd string, values []interface{}, width int) error {
+	im.stats.Keys++
+	if err := im.send(key, clear, key); err != nil {
+		return err
+	}
+	return im.sendMulti(key, cmd, values, width)
+}
+
+// SSDB scores are integers
+func (im *Importer) score(f float64) int64 {
+	switch {
+	case math.IsNaN(f):
+		im.stats.Rounded++
+		return 0
+	case f >= math.MaxInt64:
+		im.stats.Rounded++
+		return math.MaxInt64
+	case f <= math.MinInt64:
+		im.stats.Rounded++
+		return math.MinInt64
+	}
+	r := math.Round(f)
+	if r != f {
+		im.stats.Rounded++
+	}
+	return int64(r)
+}
+
+// Seconds left of a duration, rounded up
+func seconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+// Seconds left of an expiration relative or absolute, in seconds or
+// milliseconds
+func (im *Importer) ttl(unit string, n int64) int64 {
+	switch unit {
+	case "ex", "expire", "setex":
+		return n
+	case "px", "pexpire", "psetex":
+		return seconds(time.Duration(n) * time.Millisecond)
+	case "exat", "expireat":
+		return seconds(time.Unix(n, 0).Sub(im.now()))
+	}
+	return seconds(time.UnixMilli(n).Sub(im.now()))
+}
+
+func (im *Importer) command(args []string) error {
+	cmd := strings.ToLower(args[0])
+	switch cmd {
+	case "select":
+		if len(args) == 2 {
+			im.selected, _ = strconv.Atoi(args[1])
+		}
+		return nil
+	case "multi", "exec", "discard":
+		return nil
+	}
+	if im.db >= 0 && im.selected != im.db {
+		return nil
+	}
+	done, err := im.apply(cmd, args[1:])
+	if err == nil && !done {
+		im.stats.Skipped++
+	}
+	if done {
+		im.track(cmd, args[1:])
+	}
+	return err
+}
+
+// The Redis type a command leaves its key with
+var commandKinds = map[string]Kind{
+	"hset": Hash, "hmset": Hash, "hsetnx": Hash, "hincrby": Hash,
+	"zadd": ZSet, "zincrby": ZSet,
+	"rpush": List, "rpushx": List, "lpush": List, "lpushx": List,
+}
+
+// Record the hashes, zsets and lists written by a command
+func (im *Importer) track(cmd string, a []string) {
+	switch cmd {
+	case "mset", "msetnx":
+		for i := 0; i < len(a); i += 2 {
+			delete(im.kinds, a[i])
+		}
+		return
+	}
+	if kind, found := commandKinds[cmd]; found {
+		im.kinds[a[0]] = kind
+	} else if cmd == "set" || cmd == "setex" || cmd == "psetex" || cmd == "setnx" || cmd == "getset" {
+		delete(im.kinds, a[0])
+	}
+}
+
+// Send the SSDB equivalent of a Redis command, done is false when there is
+// none. Redis only logs the writes that took effect, so the conditions of
+// NX and XX are known to hold.
+func (im *Importer) apply(cmd string, a []string) (done bool, err error) {
+	if len(a) == 0 {
+		return false, nil
+	}
+	key := a[0]
+	switch cmd {
+	case "set":
+		if len(a) < 2 {
+			return false, nil
+		}
+		var ttl int64
+		for i := 2; i < len(a); i++ {
+			switch opt := strings.ToLower(a[i]); opt {
+			case "ex", "px", "exat", "pxat":
+				if i+1 >= len(a) {
+					return false, nil
+				}
+				n, err := strconv.ParseInt(a[i+1], 10, 64)
+				if err != nil {
+					return false, nil
+				}
+				if ttl = im.ttl(opt, n); ttl <= 0 {
+					return true, im.del(key)
+				}
+				i++
+			case "nx", "xx", "keepttl", "get":
+			default:
+				return false, nil
+			}
+		}
+		if ttl > 0 {
+			return true, im.send(key, "setx", key, a[1], ttl)
+		}
+		return true, im.send(key, "set", key, a[1])
+	case "setex", "psetex":
+		if len(a) != 3 {
+			return false, nil
+		}
+		n, err := strconv.ParseInt(a[1], 10, 64)
+		if err != nil {
+			return false, nil
+		}
+		if ttl := im.ttl(cmd, n); ttl > 0 {
+			return true, im.send(key, "setx", key, a[2], ttl)
+		}
+		return true, im.del(key)
+	case "setnx", "getset":
+		if len(a) != 2 {
+			return false, nil
+		}
+		return true, im.send(key, "set", key, a[1])
+	case "mset", "msetnx":
+		if len(a)%2 != 0 {
+			return false, nil
+		}
+		for i := 0; i < len(a); i += 2 {
+			if err := im.send(a[i], "set", a[i], a[i+1]); err != nil {
+				return true, err
+			}
+		}
+		return true, nil
+	case "incr", "decr":
+		return true, im.send(key, cmd, key, 1)
+	case "incrby", "decrby":
+		if len(a) != 2 {
+			return false, nil
+		}
+		return true, im.send(key, cmd[:4], key, a[1])
+	case "del", "unlink":
+		for _, k := range a {
+			if err := im.del(k); err != nil {
+				return true, err
+			}
+		}
+		return true, nil
+	case "expire", "pexpire", "expireat", "pexpireat":
+		if len(a) < 2 {
+			return false, nil
+		}
+		n, err := strconv.ParseInt(a[1], 10, 64)
+		if err != nil {
+			return false, nil
+		}
+		ttl := im.ttl(cmd, n)
+		if ttl <= 0 {
+			return true, im.del(key)
+		}
+		// the expire command of SSDB only applies to KVs
+		if _, found := im.kinds[key]; found {
+			im.stats.TTLDropped++
+			return true, nil
+		}
+		return true, im.send(key, "expire", key, ttl)
+	case "hset", "hmset", "hsetnx":
+		if len(a) < 3 || len(a)%2 != 1 {
+			return false, nil
+		}
+		return true, im.sendMulti(key, "multi_hset", toArgs(a[1:]), 2)
+	case "hdel":
+		return true, im.sendMulti(key, "multi_hdel", toArgs(a[1:]), 1)
+	case "hincrby":
+		if len(a) != 3 {
+			return false, nil
+		}
+		return true, im.send(key, "hincr", key, a[1], a[2])
+	case "zadd":
+		return im.zadd(key, a[1:])
+	case "zrem":
+		return true, im.sendMulti(key, "multi_zdel", toArgs(a[1:]), 1)
+	case "zincrby":
+		if len(a) != 3 {
+			return false, nil
+		}
+		f, err := strconv.ParseFloat(a[1], 64)
+		if err != nil {
+			return false, nil
+		}
+		return true, im.send(key, "zincr", key, a[2], im.score(f))
+	case "rpush", "rpushx":
+		return true, im.sendMulti(key, "qpush_back", toArgs(a[1:]), 1)
+	case "lpush", "lpushx":
+		return true, im.sendMulti(key, "qpush_front", toArgs(a[1:]), 1)
+	case "rpop", "lpop":
+		count := "1"
+		if len(a) > 1 {
+			count = a[1]
+		}
+		if cmd == "rpop" {
+			return true, im.send(key, "qpop_back", key, count)
+		}
+		return true, im.send(key, "qpop_front", key, count)
+	}
+	return false, nil
+}
+
+// ZADD [NX|XX|GT|LT] [CH] [INCR] score member ...
+func (im *Importer) zadd(key string, a []string) (bool, error) {
+	incr := false
+options:
+	for ; len(a) > 0; a = a[1:] {
+		switch strings.ToLower(a[0]) {
+		case "xx", "ch":
+		case "incr":
+			incr = true
+		case "nx", "gt", "lt":
+			// Redis logs the whole command when one member changed
+			return false, nil
+		default:
+			break options
+		}
+	}
+	if len(a) == 0 || len(a)%2 != 0 {
+		return false, nil
+	}
+	values := make([]interface{}, 0, len(a))
+	for i := 0; i < len(a); i += 2 {
+		f, err := strconv.ParseFloat(a[i], 64)
+		if err != nil {
+			return false, nil
+		}
+		values = append(values, a[i+1], im.score(f))
+	}
+	if incr {
+		return true, im.send(key, "zincr", key, values[0], values[1])
+	}
+	return true, im.sendMulti(key, "multi_zset", values, 2)
+}
+
+// A Redis key is one of the SSDB types, clear them all
+func (im *Importer) del(key string) error {
+	delete(im.kinds, key)
+	for _, cmd := range []string{"del", "hclear", "zclear", "qclear"} {
+		if err := im.send(key, cmd, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func toArgs(a []string) []interface{} {
+	args := make([]interface{}, len(a))
+	for i, s := range a {
+		args[i] = s
+	}
+	return args
+}
@@ -0,0 +1,187 @@
+package redisimport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bububa/gossdb"
+	"github.com/bububa/gossdb/ssdbtest"
+)
+
+// Encode commands like an append only file
+func aof(cmds ...[]string) string {
+	var b strings.Builder
+	for _, cmd := range cmds {
+		b.WriteString("*" + itoa(int64(len(cmd))) + "\r\n")
+		for _, arg := range cmd {
+			b.WriteString("$" + itoa(int64(len(arg))) + "\r\n" + arg + "\r\n")
+		}
+	}
+	return b.String()
+}
+
+func TestParseAOF(t *testing.T) {
+	preamble := newRDB().key(typeString, "old").string("v").end()
+	data := string(preamble) + "#TS:1700000000\r\n" + aof([]string{"SET", "k", "a\r\nb"}, []string{"DEL", "k"})
+	var (
+		entries []string
+		cmds    [][]string
+	)
+	err := ParseAOF(strings.NewReader(data), func(e *Entry) error {
+		entries = append(entries, e.Key)
+		return nil
+	}, func(args []string) error {
+		cmds = append(cmds, args)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entries, []string{"old"}) {
+		t.Fatalf("preamble entries = %v", entries)
+	}
+	if want := [][]string{{"SET", "k", "a\r\nb"}, {"DEL", "k"}}; !reflect.DeepEqual(cmds, want) {
+		t.Fatalf("commands = %q, want %q", cmds, want)
+	}
+
+	nop := func(args []string) error { return nil }
+	full := aof([]string{"SET", "k", "v"})
+	if err := ParseAOF(strings.NewReader(full[:len(full)-4]), nil, nop); err != io.ErrUnexpectedEOF {
+		t.Fatalf("truncated AOF = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if err := ParseAOF(strings.NewReader("SET k v\r\n"), nil, nop); err == nil {
+		t.Fatal("inline command accepted")
+	}
+}
+
+func newTestImporter(t *testing.T) (*Importer, *gossdb.Client) {
+	t.Helper()
+	srv := ssdbtest.NewServer()
+	t.Cleanup(func() { srv.Close() })
+	c, err := gossdb.Connect(srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	im := NewImporter(c)
+	im.now = func() time.Time { return time.Unix(1700000000, 0) }
+	return im, c
+}
+
+func TestImportRDB(t *testing.T) {
+	im, c := newTestImporter(t)
+	expired := make([]byte, 8)
+	r := newRDB()
+	r.key(typeString, "s").string("v")
+	r.raw(opExpireTimeMs).raw(expired...)
+	r.key(typeString, "expired").string("v")
+	r.key(typeZSet, "z").length(1).string("m").raw(3, '1', '.', '5')
+	r.key(typeHash, "h").length(1).string("f").string("v")
+	r.key(typeList, "l").length(2).string("a").string("b")
+	r.key(typeSet, "set").length(1).string("m")
+	r.raw(opModuleAux).length64(moduleID("ReJSON-RL", 3)).length(moduleEOF)
+	r.key(typeModule2, "json").length64(moduleID("ReJSON-RL", 3)).length(moduleEOF)
+	r.key(typeStream, "stream").length(0).length(0).length(0).length(0).length(0)
+	if err := im.ImportRDB(bytes.NewReader(r.end())); err != nil {
+		t.Fatal(err)
+	}
+	want := Stats{Keys: 4, Commands: 7, Expired: 1, Skipped: 4, Rounded: 1}
+	if im.Stats() != want {
+		t.Fatalf("stats = %+v, want %+v", im.Stats(), want)
+	}
+	if v, _ := c.Get("s"); v != "v" {
+		t.Fatalf("get = %v", v)
+	}
+	if v, _ := c.ZGet("z", "m"); v != int64(2) {
+		t.Fatalf("zget = %v", v)
+	}
+	if items, _ := c.QSlice("l", 0, -1); !reflect.DeepEqual(items, []string{"a", "b"}) {
+		t.Fatalf("queue = %v", items)
+	}
+}
+
+func TestImportAOF(t *testing.T) {
+	im, c := newTestImporter(t)
+	data := aof(
+		[]string{"SELECT", "0"},
+		[]string{"SET", "a", "1", "EX", "100"},
+		[]string{"INCRBY", "n", "5"},
+		[]string{"HSET", "h", "f", "v"},
+		[]string{"RPUSH", "q", "x", "y"},
+		[]string{"LPOP", "q"},
+		[]string{"ZADD", "z", "XX", "2", "m"},
+		[]string{"SADD", "set", "m"},
+		[]string{"SET", "gone", "v"},
+		[]string{"PEXPIREAT", "gone", "1"},
+	)
+	if err := im.ImportAOF(strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if im.Stats().Skipped != 1 {
+		t.Fatalf("stats = %+v, want the sadd skipped", im.Stats())
+	}
+	if ttl, _ := c.TTL("a"); ttl <= 0 {
+		t.Fatalf("ttl = %d", ttl)
+	}
+	if v, _ := c.Get("n"); v != "5" {
+		t.Fatalf("get n = %v", v)
+	}
+	if v, _ := c.HGet("h", "f"); v != "v" {
+		t.Fatalf("hget = %v", v)
+	}
+	if items, _ := c.QSlice("q", 0, -1); !reflect.DeepEqual(items, []string{"y"}) {
+		t.Fatalf("queue = %v", items)
+	}
+	if v, _ := c.ZGet("z", "m"); v != int64(2) {
+		t.Fatalf("zget = %v", v)
+	}
+	if v, _ := c.Get("gone"); v != nil {
+		t.Fatalf("expired key = %v", v)
+	}
+}
+
+// SSDB only expires KVs, the expirations of other types are counted
+func TestImportTTLDropped(t *testing.T) {
+	im, c := newTestImporter(t)
+	future := make([]byte, 8)
+	binary.LittleEndian.PutUint64(future, 1700000100000)
+	r := newRDB()
+	r.raw(opExpireTimeMs).raw(future...)
+	r.key(typeHash, "h").length(1).string("f").string("v")
+	r.raw(opExpireTimeMs).raw(future...)
+	r.key(typeString, "s").string("v")
+	if err := im.ImportRDB(bytes.NewReader(r.end())); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, _ := c.TTL("s"); ttl != 100 {
+		t.Fatalf("ttl of a KV = %d, want 100", ttl)
+	}
+
+	data := aof(
+		[]string{"EXPIRE", "h", "100"},
+		[]string{"RPUSH", "q", "x"},
+		[]string{"PEXPIRE", "q", "100000"},
+		[]string{"SET", "q", "now a KV"},
+		[]string{"EXPIRE", "q", "100"},
+	)
+	commands := im.Stats().Commands
+	if err := im.ImportAOF(strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	stats := im.Stats()
+	if stats.TTLDropped != 3 || stats.Skipped != 0 {
+		t.Fatalf("stats = %+v, want 3 expirations dropped", stats)
+	}
+	// qpush_back, set and expire
+	if n := stats.Commands - commands; n != 3 {
+		t.Fatalf("%d commands sent, want the expirations of h and q dropped", n)
+	}
+	if ttl, _ := c.TTL("q"); ttl != 100 {
+		t.Fatalf("ttl of q = %d, want 100", ttl)
+	}
+}
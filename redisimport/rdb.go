@@ -0,0 +1,524 @@
+// Package redisimport reads Redis RDB snapshots and AOF command logs and
+// writes their strings, hashes, sorted sets and lists to SSDB.
+//
+//	im := redisimport.NewClusterImporter(cluster)
+//	err := im.ImportRDB(f)
+//
+// Strings become KV (with setx when they expire), hashes multi_hset, sorted
+// sets multi_zset with their scores rounded to integers and lists queues.
+// SSDB only expires KV, the expiration of the other types is dropped. Sets,
+// streams and module types have no SSDB equivalent and are skipped.
+package redisimport
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Kind is the Redis type of an entry
+type Kind int
+
+const (
+	String Kind = iota
+	List
+	Set
+	ZSet
+	Hash
+	Stream
+	Module
+)
+
+func (k Kind) String() string {
+	switch k {
+	case String:
+		return "string"
+	case List:
+		return "list"
+	case Set:
+		return "set"
+	case ZSet:
+		return "zset"
+	case Hash:
+		return "hash"
+	case Stream:
+		return "stream"
+	}
+	return "module"
+}
+
+// Entry is a key of a RDB file
+type Entry struct {
+	DB   int
+	Key  string
+	Kind Kind
+	// Value of a string
+	Value string
+	// Items of a list or a set
+	Items []string
+	// Fields of a hash
+	Fields map[string]string
+	// Scores of a sorted set
+	Scores map[string]float64
+	// Module names the module of a Module entry, the auxiliary data of a
+	// module is a Module entry without a key. Stream and Module entries
+	// carry no value, they are skipped.
+	Module string
+	// ExpireAt is zero when the key does not expire
+	ExpireAt time.Time
+}
+
+var ErrBadRDB = fmt.Errorf("redisimport: not a RDB file")
+
+// Largest string accepted, the limit of Redis
+const maxString = 512 << 20
+
+// Opcodes of the RDB format
+const (
+	opSlotInfo      = 0xF4
+	opFunction2     = 0xF5
+	opFunctionPreGA = 0xF6
+	opModuleAux     = 0xF7
+	opIdle          = 0xF8
+	opFreq          = 0xF9
+	opAux           = 0xFA
+	opResizeDB      = 0xFB
+	opExpireTimeMs  = 0xFC
+	opExpireTime    = 0xFD
+	opSelectDB      = 0xFE
+	opEOF           = 0xFF
+)
+
+// Value types of the RDB format
+const (
+	typeString         = 0
+	typeList           = 1
+	typeSet            = 2
+	typeZSet           = 3
+	typeHash           = 4
+	typeZSet2          = 5
+	typeModule2        = 7
+	typeHashZipmap     = 9
+	typeListZiplist    = 10
+	typeSetIntset      = 11
+	typeZSetZiplist    = 12
+	typeHashZiplist    = 13
+	typeListQuicklist  = 14
+	typeStream         = 15
+	typeHashListpack   = 16
+	typeZSetListpack   = 17
+	typeListQuicklist2 = 18
+	typeStream2        = 19
+	typeSetListpack    = 20
+	typeStream3        = 21
+)
+
+// Opcodes of the values saved by a module
+const (
+	moduleEOF    = 0
+	moduleSInt   = 1
+	moduleUInt   = 2
+	moduleFloat  = 3
+	moduleDouble = 4
+	moduleString = 5
+)
+
+// ParseRDB calls fn with every key of a RDB file. The checksum at the end
+// of the file is not verified.
+func ParseRDB(r io.Reader, fn func(e *Entry) error) error {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return parseRDB(br, fn)
+}
+
+func parseRDB(br *bufio.Reader, fn func(e *Entry) error) error {
+	p := &rdbReader{r: br}
+	head := p.bytes(9)
+	if p.err != nil || string(head[:5]) != "REDIS" {
+		return ErrBadRDB
+	}
+	version, err := strconv.Atoi(string(head[5:]))
+	if err != nil {
+		return ErrBadRDB
+	}
+	var (
+		db       int
+		expireAt time.Time
+	)
+	for {
+		op := p.byte()
+		if p.err != nil {
+			return p.err
+		}
+		switch op {
+		case opEOF:
+			if version >= 5 {
+				p.bytes(8)
+			}
+			return p.err
+		case opSelectDB:
+			db = int(p.length())
+		case opExpireTime:
+			expireAt = time.Unix(int64(binary.LittleEndian.Uint32(p.bytes(4))), 0)
+		case opExpireTimeMs:
+			expireAt = time.UnixMilli(int64(binary.LittleEndian.Uint64(p.bytes(8))))
+		case opResizeDB:
+			p.length()
+			p.length()
+		case opAux:
+			p.string()
+			p.string()
+		case opSlotInfo:
+			p.length()
+			p.length()
+			p.length()
+		case opIdle:
+			p.length()
+		case opFreq:
+			p.byte()
+		case opFunction2:
+			p.string()
+		case opModuleAux:
+			e := &Entry{DB: db, Kind: Module, Module: moduleName(p.length())}
+			p.skipModule()
+			if p.err != nil {
+				return p.err
+			}
+			if err := fn(e); err != nil {
+				return err
+			}
+		case opFunctionPreGA:
+			return fmt.Errorf("redisimport: unsupported RDB opcode %#x", op)
+		default:
+			e := &Entry{DB: db, Key: string(p.string()), ExpireAt: expireAt}
+			expireAt = time.Time{}
+			p.value(op, e)
+			if p.err != nil {
+				return p.err
+			}
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		if p.err != nil {
+			return p.err
+		}
+	}
+}
+
+// rdbReader keeps the first error met, the reads after it return zero values
+type rdbReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (p *rdbReader) fail(err error) {
+	if p.err == nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		p.err = err
+	}
+}
+
+func (p *rdbReader) byte() byte {
+	if p.err != nil {
+		return 0
+	}
+	b, err := p.r.ReadByte()
+	if err != nil {
+		p.fail(err)
+	}
+	return b
+}
+
+func (p *rdbReader) bytes(n uint64) []byte {
+	if p.err != nil {
+		// keep the fixed size reads of the callers in bounds
+		if n <= 8 {
+			return make([]byte, n)
+		}
+		return nil
+	}
+	if n > maxString {
+		p.fail(fmt.Errorf("redisimport: string of %d bytes", n))
+		return nil
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(p.r, buf); err != nil {
+		p.fail(err)
+	}
+	return buf
+}
+
+// Read a length, encoded is true when it is the format of a special string
+func (p *rdbReader) encodedLength() (n uint64, encoded bool) {
+	b := p.byte()
+	switch b >> 6 {
+	case 0:
+		return uint64(b & 0x3f), false
+	case 1:
+		return uint64(b&0x3f)<<8 | uint64(p.byte()), false
+	case 2:
+		switch b {
+		case 0x80:
+			return uint64(binary.BigEndian.Uint32(p.bytes(4))), false
+		case 0x81:
+			return binary.BigEndian.Uint64(p.bytes(8)), false
+		}
+		p.fail(fmt.Errorf("redisimport: bad length %#x", b))
+		return 0, false
+	}
+	return uint64(b & 0x3f), true
+}
+
+func (p *rdbReader) length() uint64 {
+	n, encoded := p.encodedLength()
+	if encoded {
+		p.fail(fmt.Errorf("redisimport: string encoding instead of a length"))
+	}
+	return n
+}
+
+func (p *rdbReader) string() []byte {
+	n, encoded := p.encodedLength()
+	if !encoded {
+		return p.bytes(n)
+	}
+	switch n {
+	case 0:
+		return strconv.AppendInt(nil, int64(int8(p.byte())), 10)
+	case 1:
+		return strconv.AppendInt(nil, int64(int16(binary.LittleEndian.Uint16(p.bytes(2)))), 10)
+	case 2:
+		return strconv.AppendInt(nil, int64(int32(binary.LittleEndian.Uint32(p.bytes(4)))), 10)
+	case 3:
+		clen, ulen := p.length(), p.length()
+		data := p.bytes(clen)
+		if p.err != nil {
+			return nil
+		}
+		if ulen > maxString {
+			p.fail(fmt.Errorf("redisimport: string of %d bytes", ulen))
+			return nil
+		}
+		out, err := lzfDecompress(data, int(ulen))
+		if err != nil {
+			p.fail(err)
+		}
+		return out
+	}
+	p.fail(fmt.Errorf("redisimport: bad string encoding %d", n))
+	return nil
+}
+
+// A score of the first zset format, written as a string
+func (p *rdbReader) score() float64 {
+	switch n := p.byte(); n {
+	case 253:
+		return math.NaN()
+	case 254:
+		return math.Inf(1)
+	case 255:
+		return math.Inf(-1)
+	default:
+		s := p.bytes(uint64(n))
+		f, err := strconv.ParseFloat(string(s), 64)
+		if err != nil && p.err == nil {
+			p.fail(fmt.Errorf("redisimport: bad score %q", s))
+		}
+		return f
+	}
+}
+
+func (p *rdbReader) value(t byte, e *Entry) {
+	switch t {
+	case typeString:
+		e.Kind, e.Value = String, string(p.string())
+	case typeList, typeSet:
+		e.Kind = List
+		if t == typeSet {
+			e.Kind = Set
+		}
+		for n := p.length(); n > 0 && p.err == nil; n-- {
+			e.Items = append(e.Items, string(p.string()))
+		}
+	case typeZSet, typeZSet2:
+		e.Kind, e.Scores = ZSet, map[string]float64{}
+		for n := p.length(); n > 0 && p.err == nil; n-- {
+			member := string(p.string())
+			if t == typeZSet {
+				e.Scores[member] = p.score()
+			} else {
+				e.Scores[member] = math.Float64frombits(binary.LittleEndian.Uint64(p.bytes(8)))
+			}
+		}
+	case typeHash:
+		e.Kind, e.Fields = Hash, map[string]string{}
+		for n := p.length(); n > 0 && p.err == nil; n-- {
+			field := string(p.string())
+			e.Fields[field] = string(p.string())
+		}
+	case typeHashZipmap:
+		e.Kind, e.Fields = Hash, p.pairs(p.blob(zipmap))
+	case typeListZiplist:
+		e.Kind, e.Items = List, p.blob(ziplist)
+	case typeSetIntset:
+		e.Kind, e.Items = Set, p.blob(intset)
+	case typeZSetZiplist:
+		e.Kind, e.Scores = ZSet, p.scores(p.blob(ziplist))
+	case typeZSetListpack:
+		e.Kind, e.Scores = ZSet, p.scores(p.blob(listpack))
+	case typeHashZiplist:
+		e.Kind, e.Fields = Hash, p.pairs(p.blob(ziplist))
+	case typeHashListpack:
+		e.Kind, e.Fields = Hash, p.pairs(p.blob(listpack))
+	case typeSetListpack:
+		e.Kind, e.Items = Set, p.blob(listpack)
+	case typeListQuicklist:
+		e.Kind = List
+		for n := p.length(); n > 0 && p.err == nil; n-- {
+			e.Items = append(e.Items, p.blob(ziplist)...)
+		}
+	case typeListQuicklist2:
+		e.Kind = List
+		for n := p.length(); n > 0 && p.err == nil; n-- {
+			if container := p.length(); container == 1 {
+				e.Items = append(e.Items, string(p.string()))
+			} else {
+				e.Items = append(e.Items, p.blob(listpack)...)
+			}
+		}
+	case typeStream, typeStream2, typeStream3:
+		e.Kind = Stream
+		p.skipStream(t)
+	case typeModule2:
+		e.Kind, e.Module = Module, moduleName(p.length())
+		p.skipModule()
+	default:
+		p.fail(fmt.Errorf("redisimport: unsupported RDB type %d of %q", t, e.Key))
+	}
+}
+
+// Name of a module from its id, 9 characters of 6 bits then a version of
+// 10 bits
+func moduleName(id uint64) string {
+	const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	name := make([]byte, 9)
+	for i := range name {
+		name[i] = charset[id>>(58-6*uint(i))&63]
+	}
+	return string(name)
+}
+
+// Skip the values saved by a module, each follows its opcode until the EOF
+// opcode
+func (p *rdbReader) skipModule() {
+	for p.err == nil {
+		switch op := p.length(); op {
+		case moduleEOF:
+			return
+		case moduleSInt, moduleUInt:
+			p.length()
+		case moduleFloat:
+			p.bytes(4)
+		case moduleDouble:
+			p.bytes(8)
+		case moduleString:
+			p.string()
+		default:
+			p.fail(fmt.Errorf("redisimport: bad module opcode %d", op))
+		}
+	}
+}
+
+// Skip a stream: its listpacks, ids and consumer groups
+func (p *rdbReader) skipStream(t byte) {
+	for n := p.length(); n > 0 && p.err == nil; n-- {
+		// master id and listpack of the entries
+		p.string()
+		p.string()
+	}
+	// length and last id, then the first id, max deleted id and entries
+	// added of the later versions
+	ids := 3
+	if t >= typeStream2 {
+		ids += 5
+	}
+	for i := 0; i < ids; i++ {
+		p.length()
+	}
+	for groups := p.length(); groups > 0 && p.err == nil; groups-- {
+		p.string()
+		p.length()
+		p.length()
+		if t >= typeStream2 {
+			p.length()
+		}
+		// pending entries: id, delivery time and count
+		for n := p.length(); n > 0 && p.err == nil; n-- {
+			p.bytes(16 + 8)
+			p.length()
+		}
+		for consumers := p.length(); consumers > 0 && p.err == nil; consumers-- {
+			p.string()
+			p.bytes(8)
+			if t >= typeStream3 {
+				p.bytes(8)
+			}
+			for n := p.length(); n > 0 && p.err == nil; n-- {
+				p.bytes(16)
+			}
+		}
+	}
+}
+
+// Decode a string holding a ziplist, a listpack, an intset or a zipmap
+func (p *rdbReader) blob(decode func([]byte) ([]string, error)) []string {
+	b := p.string()
+	if p.err != nil {
+		return nil
+	}
+	list, err := decode(b)
+	if err != nil {
+		p.fail(err)
+	}
+	return list
+}
+
+// Pair up a list of field, value
+func (p *rdbReader) pairs(list []string) map[string]string {
+	if len(list)%2 != 0 {
+		p.fail(fmt.Errorf("redisimport: odd number of hash elements"))
+		return nil
+	}
+	m := make(map[string]string, len(list)/2)
+	for i := 0; i < len(list); i += 2 {
+		m[list[i]] = list[i+1]
+	}
+	return m
+}
+
+// Pair up a list of member, score
+func (p *rdbReader) scores(list []string) map[string]float64 {
+	if len(list)%2 != 0 {
+		p.fail(fmt.Errorf("redisimport: odd number of zset elements"))
+		return nil
+	}
+	m := make(map[string]float64, len(list)/2)
+	for i := 0; i < len(list); i += 2 {
+		f, err := strconv.ParseFloat(list[i+1], 64)
+		if err != nil {
+			p.fail(fmt.Errorf("redisimport: bad score %q", list[i+1]))
+			return nil
+		}
+		m[list[i]] = f
+	}
+	return m
+}
@@ -0,0 +1,323 @@
+package redisimport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// rdb builds the fixtures of the tests in the RDB format
+type rdb struct {
+	bytes.Buffer
+}
+
+func newRDB() *rdb {
+	r := &rdb{}
+	r.WriteString("REDIS0011")
+	return r
+}
+
+func (r *rdb) length(n int) *rdb {
+	switch {
+	case n < 64:
+		r.WriteByte(byte(n))
+	case n < 16384:
+		r.WriteByte(0x40 | byte(n>>8))
+		r.WriteByte(byte(n))
+	default:
+		r.WriteByte(0x80)
+		binary.Write(r, binary.BigEndian, uint32(n))
+	}
+	return r
+}
+
+// A 64 bit length
+func (r *rdb) length64(n uint64) *rdb {
+	r.WriteByte(0x81)
+	binary.Write(r, binary.BigEndian, n)
+	return r
+}
+
+func (r *rdb) string(s string) *rdb {
+	r.length(len(s))
+	r.WriteString(s)
+	return r
+}
+
+func (r *rdb) raw(b ...byte) *rdb {
+	r.Write(b)
+	return r
+}
+
+func (r *rdb) key(t byte, key string) *rdb {
+	r.WriteByte(t)
+	return r.string(key)
+}
+
+func (r *rdb) end() []byte {
+	r.WriteByte(opEOF)
+	r.Write(make([]byte, 8))
+	return r.Bytes()
+}
+
+// ziplist of the encoded entries, each starts with its encoding byte
+func ziplistOf(entries ...[]byte) string {
+	var body []byte
+	for _, e := range entries {
+		body = append(body, 0)
+		body = append(body, e...)
+	}
+	head := make([]byte, 10)
+	binary.LittleEndian.PutUint16(head[8:], uint16(len(entries)))
+	return string(append(append(head, body...), 0xFF))
+}
+
+// listpack of the encoded entries, each is followed by its length
+func listpackOf(entries ...[]byte) string {
+	var body []byte
+	for _, e := range entries {
+		body = append(body, e...)
+		body = append(body, byte(len(e)))
+	}
+	head := make([]byte, 6)
+	binary.LittleEndian.PutUint16(head[4:], uint16(len(entries)))
+	return string(append(append(head, body...), 0xFF))
+}
+
+// short string entry of a ziplist or a listpack
+func zstr(s string) []byte  { return append([]byte{byte(len(s))}, s...) }
+func lpstr(s string) []byte { return append([]byte{0x80 | byte(len(s))}, s...) }
+
+// moduleID encodes a module name and version like Redis
+func moduleID(name string, version uint64) uint64 {
+	const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	var id uint64
+	for i := 0; i < 9; i++ {
+		id = id<<6 | uint64(bytes.IndexByte([]byte(charset), name[i]))
+	}
+	return id<<10 | version
+}
+
+func parse(t *testing.T, data []byte) []*Entry {
+	t.Helper()
+	var entries []*Entry
+	if err := ParseRDB(bytes.NewReader(data), func(e *Entry) error {
+		entries = append(entries, e)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestParseRDB(t *testing.T) {
+	expireAt := time.UnixMilli(1700000000123)
+	ms := make([]byte, 8)
+	binary.LittleEndian.PutUint64(ms, uint64(expireAt.UnixMilli()))
+	double := make([]byte, 8)
+	binary.LittleEndian.PutUint64(double, math.Float64bits(-2.5))
+
+	r := newRDB()
+	r.raw(opAux).string("redis-ver").string("7.2.0")
+	r.raw(opSelectDB).length(3).raw(opResizeDB).length(10).length(1)
+	r.key(typeString, "s").string("hello")
+	r.raw(opExpireTimeMs).raw(ms...)
+	r.key(typeString, "int").raw(0xC0, 0xF6) // int8 -10
+	r.key(typeString, "int32").raw(0xC2, 0x40, 0xE2, 0x01, 0x00)
+	r.key(typeList, "l").length(2).string("a").string("b")
+	r.key(typeSet, "set").length(1).string("m")
+	r.key(typeZSet, "z1").length(3).string("a").raw(3, '1', '.', '5').string("inf").raw(254).string("nan").raw(253)
+	r.key(typeZSet2, "z2").length(1).string("a").raw(double...)
+	r.key(typeHash, "h").length(1).string("f").string("v")
+	r.raw(opIdle).length(5).raw(opFreq, 1)
+	r.key(typeListQuicklist2, "ql").length(2).
+		length(1).string("plain").
+		length(2).string(listpackOf(lpstr("x"), []byte{7}))
+
+	entries := parse(t, r.end())
+	want := []*Entry{
+		{DB: 3, Key: "s", Kind: String, Value: "hello"},
+		{DB: 3, Key: "int", Kind: String, Value: "-10", ExpireAt: expireAt},
+		{DB: 3, Key: "int32", Kind: String, Value: "123456"},
+		{DB: 3, Key: "l", Kind: List, Items: []string{"a", "b"}},
+		{DB: 3, Key: "set", Kind: Set, Items: []string{"m"}},
+		{DB: 3, Key: "z1", Kind: ZSet, Scores: map[string]float64{"a": 1.5, "inf": math.Inf(1)}},
+		{DB: 3, Key: "z2", Kind: ZSet, Scores: map[string]float64{"a": -2.5}},
+		{DB: 3, Key: "h", Kind: Hash, Fields: map[string]string{"f": "v"}},
+		{DB: 3, Key: "ql", Kind: List, Items: []string{"plain", "x", "7"}},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("%d entries, want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		if e.Key == "z1" {
+			// NaN is not equal to itself
+			if !math.IsNaN(e.Scores["nan"]) {
+				t.Fatalf("nan score = %v", e.Scores["nan"])
+			}
+			delete(e.Scores, "nan")
+		}
+		if !reflect.DeepEqual(e, want[i]) {
+			t.Errorf("entry %d = %+v, want %+v", i, e, want[i])
+		}
+	}
+}
+
+func TestCompactEncodings(t *testing.T) {
+	intset := make([]byte, 8, 14)
+	binary.LittleEndian.PutUint32(intset, 2)
+	binary.LittleEndian.PutUint32(intset[4:], 3)
+	intset = append(intset, 0xFF, 0xFF, 0x01, 0x00, 0x00, 0x80)
+
+	// the value of a is followed by a free byte
+	zipmap := "\x02\x01a\x02\x01xyZ\x01b\x00\x00\xff"
+
+	r := newRDB()
+	r.key(typeHashZipmap, "zipmap").string(zipmap)
+	r.key(typeListZiplist, "ziplist").string(ziplistOf(
+		zstr("a"),
+		[]byte{0xFE, 0x85},       // int8 -123
+		[]byte{0xC0, 0x39, 0x30}, // int16 12345
+		[]byte{0xF0, 0x01, 0x00, 0x80},
+		[]byte{0xF3}, // immediate 2
+	))
+	r.key(typeSetIntset, "intset").string(string(intset))
+	r.key(typeZSetZiplist, "zziplist").string(ziplistOf(zstr("m"), []byte{0xF4}))
+	r.key(typeHashZiplist, "hziplist").string(ziplistOf(zstr("f"), zstr("v")))
+	r.key(typeHashListpack, "hlistpack").string(listpackOf(
+		lpstr("f"), lpstr("v"),
+		lpstr("n"), []byte{0xDF, 0xFF}, // 13 bit -1
+	))
+	r.key(typeZSetListpack, "zlistpack").string(listpackOf(lpstr("m"), []byte{0xF1, 0x00, 0x80}))
+	r.key(typeSetListpack, "slistpack").string(listpackOf(lpstr("m"), []byte{100}))
+	r.key(typeListQuicklist, "quicklist").length(2).string(ziplistOf(zstr("a"))).string(ziplistOf(zstr("b")))
+
+	got := make(map[string]*Entry)
+	for _, e := range parse(t, r.end()) {
+		got[e.Key] = e
+	}
+	tests := map[string]interface{}{
+		"zipmap":    map[string]string{"a": "xy", "b": ""},
+		"ziplist":   []string{"a", "-123", "12345", "-8388607", "2"},
+		"intset":    []string{"-1", "1", "-32768"},
+		"zziplist":  map[string]float64{"m": 3},
+		"hziplist":  map[string]string{"f": "v"},
+		"hlistpack": map[string]string{"f": "v", "n": "-1"},
+		"zlistpack": map[string]float64{"m": -32768},
+		"slistpack": []string{"m", "100"},
+		"quicklist": []string{"a", "b"},
+	}
+	for key, want := range tests {
+		e := got[key]
+		if e == nil {
+			t.Errorf("%s missing", key)
+			continue
+		}
+		var value interface{}
+		switch want.(type) {
+		case []string:
+			value = e.Items
+		case map[string]string:
+			value = e.Fields
+		default:
+			value = e.Scores
+		}
+		if !reflect.DeepEqual(value, want) {
+			t.Errorf("%s = %v, want %v", key, value, want)
+		}
+	}
+}
+
+func TestLZF(t *testing.T) {
+	// a literal then a back reference of 9 bytes
+	data := []byte{0x00, 'a', 0xE0, 0x00, 0x00}
+	r := newRDB()
+	r.key(typeString, "k").raw(0xC3).length(len(data)).length(10).raw(data...)
+	if e := parse(t, r.end()); e[0].Value != "aaaaaaaaaa" {
+		t.Fatalf("lzf value = %q", e[0].Value)
+	}
+
+	for _, bad := range [][]byte{
+		{0x01, 'a'},       // literal past the end
+		{0x20, 0x05},      // reference before the start
+		{0x00, 'a', 0x20}, // missing offset
+	} {
+		if _, err := lzfDecompress(bad, 10); err == nil {
+			t.Errorf("decompressed %x", bad)
+		}
+	}
+}
+
+func TestSkipped(t *testing.T) {
+	r := newRDB()
+	// auxiliary data of a module: when, an unsigned and a string
+	r.raw(opModuleAux).length64(moduleID("ReJSON-RL", 3)).
+		length(moduleUInt).length(2).
+		length(moduleUInt).length(7).
+		length(moduleString).string("aux").
+		length(moduleEOF)
+	r.key(typeModule2, "json").length64(moduleID("ReJSON-RL", 3)).
+		length(moduleSInt).length(1).
+		length(moduleFloat).raw(0, 0, 0, 0).
+		length(moduleDouble).raw(make([]byte, 8)...).
+		length(moduleString).string("{}").
+		length(moduleEOF)
+	r.key(typeStream3, "stream").
+		length(1).string(string(make([]byte, 16))).string(listpackOf(lpstr("f"))).
+		length(1).length(5).length(0).                     // length and last id
+		length(5).length(0).length(0).length(0).length(1). // first id, max deleted id and entries added
+		length(1).string("group").length(5).length(0).length(1).
+		length(1).raw(make([]byte, 24)...).length(1). // pending entry
+		length(1).string("consumer").raw(make([]byte, 16)...).
+		length(1).raw(make([]byte, 16)...)
+	r.key(typeStream, "old").
+		length(0).length(0).length(0).length(0).
+		length(0)
+	r.key(typeString, "after").string("v")
+
+	entries := parse(t, r.end())
+	want := []struct {
+		key    string
+		kind   Kind
+		module string
+	}{
+		{"", Module, "ReJSON-RL"},
+		{"json", Module, "ReJSON-RL"},
+		{"stream", Stream, ""},
+		{"old", Stream, ""},
+		{"after", String, ""},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("%d entries, want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		if e.Key != want[i].key || e.Kind != want[i].kind || e.Module != want[i].module {
+			t.Errorf("entry %d = %q %v %q, want %+v", i, e.Key, e.Kind, e.Module, want[i])
+		}
+	}
+}
+
+func TestParseRDBErrors(t *testing.T) {
+	full := newRDB().key(typeString, "k").string("value").end()
+	tests := map[string][]byte{
+		"header":    []byte("RDB0011"),
+		"truncated": full[:len(full)-12],
+		"type":      newRDB().key(99, "k").end(),
+		"ziplist":   newRDB().key(typeListZiplist, "k").string(ziplistOf(zstr("a"))[:12]).end(),
+		"module":    newRDB().key(typeModule2, "k").length(1).length(9).end(),
+	}
+	for name, data := range tests {
+		err := ParseRDB(bytes.NewReader(data), func(e *Entry) error { return nil })
+		if err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+	err := ParseRDB(bytes.NewReader(full[:len(full)-3]), func(e *Entry) error { return nil })
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("cut checksum = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
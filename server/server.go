@@ -0,0 +1,285 @@
+// Package server is a framework for services speaking the SSDB protocol,
+// like proxies and stubs. Commands are routed to handlers by name:
+//
+//	srv := server.NewServer()
+//	srv.HandleFunc("get", func(req *server.Request) []string {
+//		if len(req.Args) < 1 {
+//			return server.ClientError("wrong number of arguments")
+//		}
+//		return server.OK(load(req.Args[0]))
+//	})
+//	log.Fatal(srv.ListenAndServe(":8888"))
+package server
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/bububa/gossdb/protocol"
+)
+
+var ErrServerClosed = fmt.Errorf("server: closed")
+
+// Request is a command received from a client
+type Request struct {
+	// Cmd is the lower-cased name of the command
+	Cmd  string
+	Args []string
+	// RemoteAddr is the address of the client
+	RemoteAddr net.Addr
+}
+
+// HandlerFunc answers a request with a reply block. Handlers are called
+// concurrently by the connections of the server. A handler that panics gets
+// an error reply, the panic is logged and the connection kept.
+type HandlerFunc func(req *Request) []string
+
+// ReplyFunc writes the reply block of a request to the connection, it
+// returns an error to drop the connection. The server flushes w afterwards.
+type ReplyFunc func(conn net.Conn, w *protocol.Writer, resp []string) error
+
+// OK is a successful reply
+func OK(values ...string) []string {
+	return append([]string{"ok"}, values...)
+}
+
+// NotFound is the reply to a missing key
+func NotFound() []string {
+	return []string{"not_found"}
+}
+
+// Error is the reply to a failed command
+func Error(msg string) []string {
+	return []string{"error", msg}
+}
+
+// ClientError is the reply to an invalid command
+func ClientError(msg string) []string {
+	return []string{"client_error", msg}
+}
+
+// Server routes the commands of its clients to handlers
+type Server struct {
+	mutex    sync.RWMutex
+	handlers map[string]HandlerFunc
+	fallback HandlerFunc
+	reply    ReplyFunc
+	password string
+	maxSize  int
+
+	listeners map[net.Listener]bool
+	conns     map[net.Conn]bool
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+func NewServer() *Server {
+	return &Server{
+		handlers:  make(map[string]HandlerFunc),
+		maxSize:   protocol.DefaultMaxSize,
+		listeners: make(map[net.Listener]bool),
+		conns:     make(map[net.Conn]bool),
+	}
+}
+
+// HandleFunc registers the handler of a command
+func (s *Server) HandleFunc(cmd string, fn HandlerFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.handlers[strings.ToLower(cmd)] = fn
+}
+
+// HandleDefault registers the handler of the commands without one, they
+// get a client_error reply otherwise
+func (s *Server) HandleDefault(fn HandlerFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.fallback = fn
+}
+
+// SetReplyFunc replaces the way replies are written, e.g. to simulate
+// network faults in tests
+func (s *Server) SetReplyFunc(fn ReplyFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.reply = fn
+}
+
+// SetPassword requires clients to send the auth command first
+func (s *Server) SetPassword(password string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.password = password
+}
+
+// SetMaxRequestSize bounds the size of a request value
+func (s *Server) SetMaxRequestSize(n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.maxSize = n
+}
+
+// ListenAndServe listens on the TCP address addr and serves it
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until the server is closed, it always
+// returns a non-nil error
+func (s *Server) Serve(l net.Listener) error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = true
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.listeners, l)
+		s.mutex.Unlock()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mutex.RLock()
+			closed := s.closed
+			s.mutex.RUnlock()
+			if closed {
+				return ErrServerClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+		s.mutex.Lock()
+		if s.closed {
+			s.mutex.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = true
+		s.wg.Add(1)
+		s.mutex.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the listeners, drops the connections and waits for the
+// running handlers
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	s.closed = true
+	var err error
+	for l := range s.listeners {
+		if e := l.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mutex.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// CloseConnections drops the open connections, the server keeps accepting
+// new ones
+func (s *Server) CloseConnections() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// Handler of a command, the password in force and the reply writer
+func (s *Server) handler(cmd string) (HandlerFunc, string, ReplyFunc) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	fn, found := s.handlers[cmd]
+	if !found {
+		fn = s.fallback
+	}
+	return fn, s.password, s.reply
+}
+
+// Run a handler, a panic is turned into an error reply
+func call(fn HandlerFunc, req *Request) (resp []string) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("server: panic serving %s %s: %v\n%s", req.RemoteAddr, req.Cmd, r, debug.Stack())
+			resp = Error("internal error")
+		}
+	}()
+	return fn(req)
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+		conn.Close()
+	}()
+	r := protocol.NewReader(conn)
+	w := protocol.NewWriter(conn)
+	s.mutex.RLock()
+	r.SetMaxSize(s.maxSize)
+	s.mutex.RUnlock()
+	authed := false
+	for {
+		block, err := r.ReadBlock()
+		if err != nil {
+			return
+		}
+		req := &Request{
+			Cmd:        strings.ToLower(block[0]),
+			Args:       block[1:],
+			RemoteAddr: conn.RemoteAddr(),
+		}
+		fn, password, reply := s.handler(req.Cmd)
+		var resp []string
+		switch {
+		case req.Cmd == "auth" && password != "":
+			authed = len(req.Args) == 1 && req.Args[0] == password
+			if authed {
+				resp = OK("1")
+			} else {
+				resp = Error("invalid password")
+			}
+		case password != "" && !authed:
+			resp = []string{"noauth", "authentication required"}
+		case fn == nil:
+			resp = ClientError("Unknown Command: " + req.Cmd)
+		default:
+			resp = call(fn, req)
+		}
+		if reply != nil {
+			err = reply(conn, w, resp)
+		} else {
+			err = w.WriteBlock(resp...)
+		}
+		if err != nil {
+			return
+		}
+		// answer a pipeline in one write
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package server_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/bububa/gossdb/protocol"
+	"github.com/bububa/gossdb/server"
+)
+
+func start(t *testing.T, s *server.Server) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(l) }()
+	t.Cleanup(func() {
+		s.Close()
+		if err := <-done; err != server.ErrServerClosed {
+			t.Errorf("serve = %v, want %v", err, server.ErrServerClosed)
+		}
+	})
+	return l.Addr().String()
+}
+
+type conn struct {
+	t *testing.T
+	c net.Conn
+	r *protocol.Reader
+	w *protocol.Writer
+}
+
+func dial(t *testing.T, addr string) *conn {
+	t.Helper()
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return &conn{t: t, c: c, r: protocol.NewReader(c), w: protocol.NewWriter(c)}
+}
+
+// Send a request and check the reply
+func (c *conn) expect(req []string, want ...string) {
+	c.t.Helper()
+	c.w.WriteBlock(req...)
+	if err := c.w.Flush(); err != nil {
+		c.t.Fatal(err)
+	}
+	resp, err := c.r.ReadBlock()
+	if err != nil {
+		c.t.Fatalf("%v: %v", req, err)
+	}
+	if !reflect.DeepEqual(resp, want) {
+		c.t.Fatalf("%v = %q, want %q", req, resp, want)
+	}
+}
+
+func echo(req *server.Request) []string {
+	return server.OK(req.Args...)
+}
+
+func TestRouting(t *testing.T) {
+	s := server.NewServer()
+	s.HandleFunc("ECHO", echo)
+	c := dial(t, start(t, s))
+	c.expect([]string{"echo", "a", "b"}, "ok", "a", "b")
+	c.expect([]string{"Echo"}, "ok")
+	c.expect([]string{"get", "k"}, "client_error", "Unknown Command: get")
+
+	s.HandleDefault(func(req *server.Request) []string {
+		return server.Error("no " + req.Cmd)
+	})
+	c.expect([]string{"get", "k"}, "error", "no get")
+}
+
+func TestAuth(t *testing.T) {
+	s := server.NewServer()
+	s.HandleFunc("echo", echo)
+	s.SetPassword("secret")
+	c := dial(t, start(t, s))
+	c.expect([]string{"echo", "a"}, "noauth", "authentication required")
+	c.expect([]string{"auth", "wrong"}, "error", "invalid password")
+	c.expect([]string{"echo", "a"}, "noauth", "authentication required")
+	c.expect([]string{"auth", "secret"}, "ok", "1")
+	c.expect([]string{"echo", "a"}, "ok", "a")
+}
+
+func TestPanicRecovery(t *testing.T) {
+	s := server.NewServer()
+	s.HandleFunc("echo", echo)
+	s.HandleFunc("boom", func(req *server.Request) []string {
+		panic("boom")
+	})
+	c := dial(t, start(t, s))
+	c.expect([]string{"boom"}, "error", "internal error")
+	// the connection and the server survive
+	c.expect([]string{"echo", "a"}, "ok", "a")
+	dial(t, c.c.RemoteAddr().String()).expect([]string{"echo", "b"}, "ok", "b")
+}
+
+func TestPipeline(t *testing.T) {
+	s := server.NewServer()
+	s.HandleFunc("echo", echo)
+	c := dial(t, start(t, s))
+	for _, v := range []string{"a", "b", "c"} {
+		c.w.WriteBlock("echo", v)
+	}
+	c.w.Flush()
+	for _, v := range []string{"a", "b", "c"} {
+		resp, err := c.r.ReadBlock()
+		if err != nil || !reflect.DeepEqual(resp, []string{"ok", v}) {
+			t.Fatalf("reply = %q, %v", resp, err)
+		}
+	}
+}
+
+func TestMaxRequestSize(t *testing.T) {
+	s := server.NewServer()
+	s.HandleFunc("echo", echo)
+	s.SetMaxRequestSize(4)
+	c := dial(t, start(t, s))
+	c.expect([]string{"echo", "abcd"}, "ok", "abcd")
+	c.w.WriteBlock("echo", "abcde")
+	c.w.Flush()
+	if _, err := c.r.ReadBlock(); err == nil {
+		t.Fatal("oversized request answered, want the connection closed")
+	}
+}
+
+func TestReplyFunc(t *testing.T) {
+	s := server.NewServer()
+	s.HandleFunc("echo", echo)
+	s.SetReplyFunc(func(conn net.Conn, w *protocol.Writer, resp []string) error {
+		return w.WriteBlock(append(resp, "!")...)
+	})
+	c := dial(t, start(t, s))
+	c.expect([]string{"echo", "a"}, "ok", "a", "!")
+}
+
+func TestCloseConnections(t *testing.T) {
+	s := server.NewServer()
+	s.HandleFunc("echo", echo)
+	addr := start(t, s)
+	c := dial(t, addr)
+	c.expect([]string{"echo", "a"}, "ok", "a")
+	s.CloseConnections()
+	if _, err := c.r.ReadBlock(); err == nil {
+		t.Fatal("read on a closed connection succeeded")
+	}
+	dial(t, addr).expect([]string{"echo", "b"}, "ok", "b")
+}
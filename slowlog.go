@@ -0,0 +1,154 @@
+package gossdb
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSlowLogSize is the number of slow commands kept by a client
+	DefaultSlowLogSize = 128
+	// Arguments beyond these limits are cut in slow log entries
+	slowLogMaxArgs   = 8
+	slowLogMaxArgLen = 64
+)
+
+// SlowLogEntry is a command that took longer than the slow threshold
+type SlowLogEntry struct {
+	Time     time.Time
+	Cmd      string
+	Args     []string
+	Duration time.Duration
+	Shard    string
+	// ReplySize is the number of bytes of the reply values
+	ReplySize int
+}
+
+func newSlowLogEntry(cmd *Command, resp []string, d time.Duration) SlowLogEntry {
+	e := SlowLogEntry{
+		Time:     time.Now(),
+		Cmd:      cmd.Name(),
+		Duration: d,
+		Shard:    cmd.Addr,
+	}
+	for _, v := range resp {
+		e.ReplySize += len(v)
+	}
+	args := cmd.Args
+	if len(args) > 0 {
+		args = args[1:]
+	}
+	for i, arg := range args {
+		if i == slowLogMaxArgs {
+			e.Args = append(e.Args, fmt.Sprintf("...(%d more)", len(args)-i))
+			break
+		}
+		s := fmt.Sprint(arg)
+		if len(s) > slowLogMaxArgLen {
+			s = fmt.Sprintf("%s...(%d more bytes)", s[:slowLogMaxArgLen], len(s)-slowLogMaxArgLen)
+		}
+		e.Args = append(e.Args, s)
+	}
+	return e
+}
+
+// slowLog is a ring buffer of the last slow commands
+type slowLog struct {
+	mutex   sync.Mutex
+	entries []SlowLogEntry
+	next    int
+	full    bool
+}
+
+func newSlowLog(size int) *slowLog {
+	return &slowLog{entries: make([]SlowLogEntry, size)}
+}
+
+func (l *slowLog) add(e SlowLogEntry) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if len(l.entries) == 0 {
+		return
+	}
+	l.entries[l.next] = e
+	l.next++
+	if l.next == len(l.entries) {
+		l.next = 0
+		l.full = true
+	}
+}
+
+// Entries from the newest to the oldest
+func (l *slowLog) list() []SlowLogEntry {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	n := l.next
+	if l.full {
+		n = len(l.entries)
+	}
+	res := make([]SlowLogEntry, 0, n)
+	for i := 1; i <= n; i++ {
+		res = append(res, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return res
+}
+
+func (l *slowLog) reset(size int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if size < 0 {
+		size = 0
+	}
+	l.entries = make([]SlowLogEntry, size)
+	l.next = 0
+	l.full = false
+}
+
+// SetSlowLogSize sets the number of slow commands kept and clears the log,
+// 0 or less disables it
+func (c *Client) SetSlowLogSize(n int) {
+	c.slowlog.reset(n)
+}
+
+// SlowLog returns the last slow commands, newest first
+func (c *Client) SlowLog() []SlowLogEntry {
+	return c.slowlog.list()
+}
+
+func (c *Cluster) SetSlowLogSize(n int) {
+	c.configure(func(cli *Client) { cli.SetSlowLogSize(n) })
+}
+
+// SlowLog returns the last slow commands of every shard, newest first
+func (c *Cluster) SlowLog() []SlowLogEntry {
+	var res []SlowLogEntry
+	for _, s := range c.topology().shards {
+		for _, cli := range s.clients() {
+			res = append(res, cli.SlowLog()...)
+		}
+	}
+	sortSlowLog(res)
+	return res
+}
+
+func (p *Pool) SetSlowLogSize(n int) {
+	for _, s := range p.clients {
+		s.SetSlowLogSize(n)
+	}
+}
+
+// SlowLog returns the last slow commands of every connection, newest first
+func (p *Pool) SlowLog() []SlowLogEntry {
+	var res []SlowLogEntry
+	for _, s := range p.clients {
+		res = append(res, s.SlowLog()...)
+	}
+	sortSlowLog(res)
+	return res
+}
+
+func sortSlowLog(entries []SlowLogEntry) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Time.After(entries[j].Time) })
+}
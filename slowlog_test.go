@@ -0,0 +1,46 @@
+package gossdb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bububa/gossdb/ssdbtest"
+)
+
+func TestSlowLog(t *testing.T) {
+	srv, c := newTestClient(t)
+	c.SetSlowThreshold(20 * time.Millisecond)
+	c.SetSlowLogSize(2)
+	if _, err := c.Set("fast", "v"); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		srv.InjectFault(ssdbtest.Fault{Kind: ssdbtest.FaultSlowReply, Delay: 30 * time.Millisecond}, 1)
+		if _, err := c.Get(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries := c.SlowLog()
+	if len(entries) != 2 {
+		t.Fatalf("%d entries, want 2", len(entries))
+	}
+	for i, key := range []string{"c", "b"} {
+		e := entries[i]
+		if e.Cmd != "get" || len(e.Args) != 1 || e.Args[0] != key || e.Duration < 20*time.Millisecond || e.Shard != srv.String() {
+			t.Errorf("entry %d = %+v, want get %s", i, e, key)
+		}
+	}
+}
+
+func TestSlowLogNegativeSize(t *testing.T) {
+	srv, c := newTestClient(t)
+	c.SetSlowThreshold(time.Millisecond)
+	c.SetSlowLogSize(-1)
+	srv.InjectFault(ssdbtest.Fault{Kind: ssdbtest.FaultSlowReply, Delay: 5 * time.Millisecond}, 1)
+	if _, err := c.Get("k"); err != nil {
+		t.Fatal(err)
+	}
+	if entries := c.SlowLog(); len(entries) != 0 {
+		t.Fatalf("%d entries, want 0", len(entries))
+	}
+}
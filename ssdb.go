@@ -2,30 +2,59 @@ package gossdb
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/bububa/gossdb/protocol"
 )
 
 const (
 	MAX_RETRIES = 3
 	TIMEOUT     = time.Duration(time.Second * 15)
 	KEEPALIVE   = true
+	// MAX_REPLY_SIZE bounds the memory used to buffer a single reply
+	MAX_REPLY_SIZE = 64 << 20
 )
 
 var (
 	ErrBadResponse     = fmt.Errorf("bad response")
 	ErrNotEnoughParams = fmt.Errorf("not enougn params")
+	ErrAuthFailed      = fmt.Errorf("auth failed")
+	ErrMalformedReply  = fmt.Errorf("malformed reply")
+	ErrReplyTooLarge   = fmt.Errorf("reply too large")
 )
 
 type Client struct {
+	*conn
+	// ctx is passed to the middleware chain by the typed commands
+	ctx context.Context
+}
+
+// conn is the connection state shared by a Client and its WithContext copies
+type conn struct {
 	sock     *net.TCPConn
 	recv_buf bytes.Buffer
 	addr     *net.TCPAddr
+	auth     string
 	mutex    *sync.Mutex
+	logger   Logger
+	levels   LogLevels
+	slow     time.Duration
+	slowlog  *slowLog
+	mws      []Middleware
+	chain    Handler
+	metrics  MetricsCollector
+	timeout  time.Duration
+	maxReply int
+	codec    Codec
+	// retired clients were removed from a cluster, their connection is
+	// closed after every round trip
+	retired bool
 }
 
 type KVPair struct {
@@ -38,7 +67,20 @@ func NewKVPair(k string, v interface{}) *KVPair {
 }
 
 func NewClient(sock *net.TCPConn, addr *net.TCPAddr) *Client {
-	return &Client{sock: sock, addr: addr, mutex: new(sync.Mutex)}
+	return &Client{conn: &conn{sock: sock, addr: addr, mutex: new(sync.Mutex), levels: DefaultLogLevels, slowlog: newSlowLog(DefaultSlowLogSize), timeout: TIMEOUT, maxReply: MAX_REPLY_SIZE}}
+}
+
+// WithContext returns a client sharing the connection of c whose commands
+// carry ctx through the middleware chain, e.g. to link tracing spans
+func (c *Client) WithContext(ctx context.Context) *Client {
+	return &Client{conn: c.conn, ctx: ctx}
+}
+
+func (c *Client) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
 }
 
 func Connect(addr *net.TCPAddr) (*Client, error) {
@@ -49,6 +91,68 @@ func Connect(addr *net.TCPAddr) (*Client, error) {
 	return NewClient(sock, addr), nil
 }
 
+// SetAuth sets the password sent with the auth command on every connect
+func (c *Client) SetAuth(password string) {
+	c.lock()
+	defer c.unlock()
+	c.auth = password
+}
+
+// SetLogger sets the logger receiving connection events, nil disables logging
+func (c *Client) SetLogger(l Logger) {
+	c.lock()
+	defer c.unlock()
+	c.logger = l
+}
+
+// SetLogLevels sets the level each kind of event is logged at
+func (c *Client) SetLogLevels(levels LogLevels) {
+	c.lock()
+	defer c.unlock()
+	c.levels = levels
+}
+
+// SetTimeout sets the connect timeout and the read and write deadline of a
+// round trip, TIMEOUT by default
+func (c *Client) SetTimeout(d time.Duration) {
+	c.lock()
+	defer c.unlock()
+	c.timeout = d
+}
+
+// SetMaxReplySize sets the size above which a reply is rejected with
+// ErrReplyTooLarge, MAX_REPLY_SIZE by default
+func (c *Client) SetMaxReplySize(n int) {
+	c.lock()
+	defer c.unlock()
+	c.maxReply = n
+}
+
+// SetSlowThreshold logs the commands taking longer than d and keeps them in
+// the slow log, 0 disables it
+func (c *Client) SetSlowThreshold(d time.Duration) {
+	c.lock()
+	defer c.unlock()
+	c.slow = d
+}
+
+// SetCodec sets the codec of the typed helpers such as GetAs, DefaultCodec
+// by default
+func (c *Client) SetCodec(codec Codec) {
+	c.lock()
+	defer c.unlock()
+	c.codec = codec
+}
+
+func (c *Client) Codec() Codec {
+	c.lock()
+	defer c.unlock()
+	if c.codec == nil {
+		return DefaultCodec
+	}
+	return c.codec
+}
+
 func (c *Client) lock() {
 	c.mutex.Lock()
 }
@@ -60,45 +164,133 @@ func (c *Client) unlock() {
 func (c *Client) Reconnect() error {
 	c.lock()
 	defer c.unlock()
-	c.Close()
-	sock, err := net.DialTCP("tcp", nil, c.addr)
+	return c.reconnect()
+}
+
+func (c *Client) reconnect() error {
+	if c.sock != nil {
+		c.sock.Close()
+		c.sock = nil
+	}
+	c.log(c.levels.Reconnect, "ssdb reconnect")
+	if c.metrics != nil {
+		c.metrics.IncReconnects(c.addr.String())
+	}
+	return c.connect()
+}
+
+func (c *Client) connect() error {
+	// the timeout bounds the connect too, a dead host would block for the
+	// TCP timeout of the system
+	sock, err := net.DialTimeout("tcp", c.addr.String(), c.timeout)
 	if err != nil {
+		c.log(c.levels.Connect, "ssdb connect failed", "error", err)
 		return err
 	}
-	c.sock = sock
+	c.sock = sock.(*net.TCPConn)
 	if c.recv_buf.Len() > 0 {
 		c.recv_buf.Reset()
 	}
+	if c.auth == "" {
+		c.log(c.levels.Connect, "ssdb connected")
+		return nil
+	}
+	if err = c.send([]interface{}{"auth", c.auth}); err == nil {
+		var resp []string
+		resp, err = c.recv()
+		if err == nil && (len(resp) == 0 || resp[0] != "ok") {
+			err = ErrAuthFailed
+		}
+	}
+	if err != nil {
+		c.log(c.levels.Connect, "ssdb auth failed", "error", err)
+		c.sock.Close()
+		c.sock = nil
+		return err
+	}
+	c.log(c.levels.Connect, "ssdb connected")
 	return nil
 }
 
+// Addr returns the host:port of the server
+func (c *Client) Addr() string {
+	return c.addr.String()
+}
+
+// Do sends a raw command and waits for its reply. The connection is held
+// for the whole round trip so a Client is safe for concurrent use.
 func (c *Client) Do(retries int, args ...interface{}) ([]string, error) {
+	cmd := &Command{Args: args, Addr: c.addr.String(), Retries: retries}
+	return c.handler()(c.context(), cmd)
+}
+
+// DoContext sends a raw command through the middleware chain and waits for
+// its reply
+func (c *Client) DoContext(ctx context.Context, args ...interface{}) ([]string, error) {
+	cmd := &Command{Args: args, Addr: c.addr.String()}
+	return c.handler()(ctx, cmd)
+}
+
+// exec is the end of the middleware chain. The connection is held for the
+// whole round trip so a Client is safe for concurrent use.
+func (c *Client) exec(ctx context.Context, cmd *Command) ([]string, error) {
+	c.lock()
+	defer c.unlock()
+	start := time.Now()
+	resp, err := c.do(cmd.Retries, cmd)
+	c.observe(cmd, resp, err, time.Since(start))
+	if c.retired {
+		c.close()
+	}
+	return resp, err
+}
+
+// Report a completed command to the metrics collector and the slow log
+func (c *Client) observe(cmd *Command, resp []string, err error, d time.Duration) {
+	if c.metrics != nil {
+		c.metrics.ObserveCommand(cmd.Name(), c.addr.String(), replyStatus(resp, err), d)
+	}
+	if c.slow > 0 && d >= c.slow {
+		c.log(c.levels.Slow, "ssdb slow command", "cmd", cmd.Name(), "duration", d)
+		c.slowlog.add(newSlowLogEntry(cmd, resp, d))
+	}
+}
+
+func (c *Client) do(retries int, cmd *Command) ([]string, error) {
 	if c.sock == nil {
-		c.lock()
-		sock, err := net.DialTCP("tcp", nil, c.addr)
-		if err != nil {
-			c.unlock()
+		if err := c.connect(); err != nil {
 			return nil, err
 		}
-		c.sock = sock
-		c.unlock()
 	}
 
+	args := cmd.Args
 	err := c.send(args)
 	if err != nil {
 		if !strings.Contains(fmt.Sprintf("%s", err), "bad request") && retries < MAX_RETRIES {
 			retries++
-			c.Reconnect()
-			return c.Do(retries, args...)
+			cmd.Retries = retries
+			c.countRetry()
+			c.log(c.levels.Retry, "ssdb retry", "cmd", cmd.Name(), "retries", retries, "error", err)
+			c.reconnect()
+			return c.do(retries, cmd)
 		}
 		return nil, err
 	}
 	resp, err := c.recv()
-	fmt.Println(resp)
+	if err == ErrMalformedReply || err == ErrReplyTooLarge {
+		// the stream can not be trusted anymore and the server already
+		// ran the command, drop the connection without retrying
+		c.sock.Close()
+		c.sock = nil
+		return nil, err
+	}
 	if err != nil && retries < MAX_RETRIES {
 		retries++
-		c.Reconnect()
-		return c.Do(retries, args...)
+		cmd.Retries = retries
+		c.countRetry()
+		c.log(c.levels.Retry, "ssdb retry", "cmd", cmd.Name(), "retries", retries, "error", err)
+		c.reconnect()
+		return c.do(retries, cmd)
 	}
 	return resp, err
 }
@@ -151,8 +343,8 @@ func (c *Client) Get(key string) (interface{}, error) {
 	return nil, ErrBadResponse
 }
 
-func (c *Client) Getset(key string) (interface{}, error) {
-	resp, err := c.Do(0, "getset", key)
+func (c *Client) Getset(key string, val string) (interface{}, error) {
+	resp, err := c.Do(0, "getset", key, val)
 	if err != nil {
 		return nil, err
 	}
@@ -216,6 +408,24 @@ func (c *Client) MultiGet(ks ...string) ([]*KVPair, error) {
 	return nil, ErrBadResponse
 }
 
+// MultiGetOrdered returns one result per requested key, in request order
+func (c *Client) MultiGetOrdered(ks ...string) ([]*KVResult, error) {
+	pairs, err := c.MultiGet(ks...)
+	if err != nil {
+		return nil, err
+	}
+	return alignPairs(ks, pairs), nil
+}
+
+// MultiGetMap returns the values of the existing keys indexed by key
+func (c *Client) MultiGetMap(ks ...string) (map[string]interface{}, error) {
+	pairs, err := c.MultiGet(ks...)
+	if err != nil {
+		return nil, err
+	}
+	return pairsMap(pairs), nil
+}
+
 func (c *Client) MultiDel(ks ...string) (bool, error) {
 	var args []interface{}
 	args = append(args, "multi_del")
@@ -256,8 +466,8 @@ func (c *Client) Exists(key string) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	if len(resp) > 0 && resp[0] == "ok" {
-		return true, nil
+	if len(resp) == 2 && resp[0] == "ok" {
+		return resp[1] == "1", nil
 	}
 	return false, ErrBadResponse
 }
@@ -274,6 +484,18 @@ func (c *Client) Expire(key string, ttl int) (int, error) {
 	return 0, ErrBadResponse
 }
 
+// TTL returns the seconds before key expires, -1 when it has no ttl
+func (c *Client) TTL(key string) (int64, error) {
+	resp, err := c.Do(0, "ttl", key)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp) == 2 && resp[0] == "ok" {
+		return strconv.ParseInt(resp[1], 10, 64)
+	}
+	return 0, ErrBadResponse
+}
+
 func (c *Client) Incr(key string, num int) (int64, error) {
 	resp, err := c.Do(0, "incr", key, num)
 	if err != nil {
@@ -498,7 +720,7 @@ func (c *Client) MultiHDel(key string, fieldList []string) (success bool, err er
 	if len(fieldList) == 0 {
 		return false, ErrNotEnoughParams
 	}
-	args := []interface{}{"multi_del", key}
+	args := []interface{}{"multi_hdel", key}
 	for _, f := range fieldList {
 		args = append(args, f)
 	}
@@ -792,7 +1014,7 @@ func (c *Client) MultiZDel(key string, eleList []string) (success bool, err erro
 }
 
 //Key-List/Queue
-func (c *Client) QSzie(key string) (size int64, err error) {
+func (c *Client) QSize(key string) (size int64, err error) {
 	resp, err := c.Do(0, "qsize", key)
 	if err != nil {
 		return 0, err
@@ -803,6 +1025,11 @@ func (c *Client) QSzie(key string) (size int64, err error) {
 	return 0, ErrBadResponse
 }
 
+// QSzie is kept for compatibility, use QSize instead.
+func (c *Client) QSzie(key string) (size int64, err error) {
+	return c.QSize(key)
+}
+
 func (c *Client) QClear(key string) (success bool, err error) {
 	resp, err := c.Do(0, "qclear", key)
 	if err != nil {
@@ -865,6 +1092,19 @@ func (c *Client) QSlice(key string, begin, end int) (itemList []string, err erro
 	return nil, ErrBadResponse
 }
 
+// QList lists the queue names in (startKey, endKey]
+func (c *Client) QList(startKey, endKey string, limit int) (keyList []string, err error) {
+	resp, err := c.Do(0, "qlist", startKey, endKey, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) > 0 && resp[0] == "ok" {
+		keyList = resp[1:]
+		return keyList, nil
+	}
+	return nil, ErrBadResponse
+}
+
 func (c *Client) QPush(key, item string) (success bool, err error) {
 	return c.QPushBack(key, item)
 }
@@ -874,7 +1114,7 @@ func (c *Client) QPushFront(key, item string) (success bool, err error) {
 	if err != nil {
 		return false, err
 	}
-	if len(resp) == 1 && resp[0] == "ok" {
+	if len(resp) > 0 && resp[0] == "ok" {
 		return true, nil
 	}
 	return false, ErrBadResponse
@@ -886,7 +1126,7 @@ func (c *Client) QPushBack(key, item string) (success bool, err error) {
 	if err != nil {
 		return false, err
 	}
-	if len(resp) == 1 && resp[0] == "ok" {
+	if len(resp) > 0 && resp[0] == "ok" {
 		return true, nil
 	}
 	return false, ErrBadResponse
@@ -928,122 +1168,79 @@ func (c *Client) QPopBack(key string) (ele interface{}, err error) {
 
 func (c *Client) send(args []interface{}) error {
 	var buf bytes.Buffer
-	for _, arg := range args {
-		var s string
-		switch arg := arg.(type) {
-		case string:
-			s = arg
-		case []byte:
-			s = string(arg)
-		case []string:
-			for _, s := range arg {
-				p := strconv.Itoa(len(s))
-				buf.WriteString(p)
-				buf.WriteByte('\n')
-				buf.WriteString(s)
-				buf.WriteByte('\n')
-			}
-			continue
-		case int, int32, int64, uint, uint32, uint64:
-			s = fmt.Sprintf("%d", arg)
-		case float32, float64:
-			s = fmt.Sprintf("%f", arg)
-		case bool:
-			if arg {
-				s = "1"
-			} else {
-				s = "0"
-			}
-		case nil:
-			s = ""
-		default:
-			return fmt.Errorf("bad request:%v", arg)
-		}
-		p := strconv.Itoa(len(s))
-		buf.WriteString(p)
-		buf.WriteByte('\n')
-		buf.WriteString(s)
-		buf.WriteByte('\n')
+	if err := protocol.Encode(&buf, args...); err != nil {
+		return err
+	}
+	c.sock.SetWriteDeadline(time.Now().Add(c.timeout))
+	n, err := c.sock.Write(buf.Bytes())
+	if c.metrics != nil {
+		c.metrics.AddBytesSent(c.addr.String(), n)
 	}
-	buf.WriteByte('\n')
-	c.lock()
-	defer c.unlock()
-	c.sock.SetWriteDeadline(time.Now().Add(TIMEOUT))
-	_, err := c.sock.Write(buf.Bytes())
 	return err
 }
 
 func (c *Client) recv() ([]string, error) {
 	var tmp [1024 * 128]byte
-	c.lock()
-	defer c.unlock()
-	c.sock.SetReadDeadline(time.Now().Add(TIMEOUT))
+	c.sock.SetReadDeadline(time.Now().Add(c.timeout))
 	for {
+		// pipelined replies may already be buffered
+		if c.recv_buf.Len() > 0 {
+			resp, err := c.parse()
+			if err != nil || len(resp) > 0 {
+				return resp, err
+			}
+			if c.recv_buf.Len() > c.maxReply {
+				return nil, ErrReplyTooLarge
+			}
+		}
 		n, err := c.sock.Read(tmp[0:])
+		if c.metrics != nil && n > 0 {
+			c.metrics.AddBytesReceived(c.addr.String(), n)
+		}
 		if err != nil {
 			return nil, err
 		}
 		c.recv_buf.Write(tmp[0:n])
-		resp := c.parse()
-		if resp == nil || len(resp) > 0 {
-			return resp, nil
-		}
 	}
-	return nil, nil
 }
 
-func (c *Client) parse() []string {
-	resp := []string{}
-	/*sl := strings.Split(c.recv_buf.String(), "\n")
-	for i, v := range sl {
-		if v == "" {
-			continue
-		}
-
-		if i%2 == 1 {
-			resp = append(resp, v)
-		}
+// Parse the first buffered reply, an empty reply means more data is needed
+func (c *Client) parse() ([]string, error) {
+	resp, n, err := protocol.Parse(c.recv_buf.Bytes(), c.maxReply)
+	switch err {
+	case protocol.ErrMalformed:
+		return nil, ErrMalformedReply
+	case protocol.ErrTooLarge:
+		return nil, ErrReplyTooLarge
 	}
-	return resp*/
-	buf := c.recv_buf.Bytes()
-	var idx, offset int
-	idx = 0
-	offset = 0
-
-	for {
-		idx = bytes.IndexByte(buf[offset:], '\n')
-		if idx == -1 {
-			break
-		}
-		p := buf[offset : offset+idx]
-		offset += idx + 1
-		//fmt.Printf("> [%s]\n", p);
-		if len(p) == 0 || (len(p) == 1 && p[0] == '\r') {
-			if len(resp) == 0 {
-				continue
-			} else {
-				c.recv_buf.Next(offset)
-				return resp
-			}
-		}
-
-		size, err := strconv.Atoi(string(p))
-		if err != nil || size < 0 {
-			return nil
-		}
-		if offset+size >= c.recv_buf.Len() {
-			break
-		}
-
-		v := buf[offset : offset+size]
-		resp = append(resp, string(v))
-		offset += size + 1
+	if n == 0 {
+		return []string{}, nil
 	}
-
-	return []string{}
+	c.recv_buf.Next(n)
+	return resp, nil
 }
 
 // Close The Client Connection
 func (c *Client) Close() error {
-	return c.sock.Close()
+	c.lock()
+	defer c.unlock()
+	return c.close()
+}
+
+// Close the connection once the round trip in progress is done, the
+// commands sent later reconnect and close the connection again
+func (c *Client) retire() {
+	c.lock()
+	defer c.unlock()
+	c.retired = true
+	c.close()
+}
+
+func (c *Client) close() error {
+	if c.sock == nil {
+		return nil
+	}
+	err := c.sock.Close()
+	c.sock = nil
+	return err
 }
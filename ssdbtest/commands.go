@@ -0,0 +1,1008 @@
+package ssdbtest
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+type command struct {
+	// minimal number of arguments after the command name
+	args int
+	fn   func(s *Server, args []string) []string
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"ping": {0, func(s *Server, args []string) []string { return ok() }},
+
+		// Key-Value
+		"set":          {2, (*Server).set},
+		"setx":         {3, (*Server).setx},
+		"setnx":        {2, (*Server).setnx},
+		"get":          {1, (*Server).get},
+		"getset":       {2, (*Server).getset},
+		"del":          {1, (*Server).del},
+		"incr":         {1, (*Server).incr},
+		"decr":         {1, (*Server).decr},
+		"exists":       {1, (*Server).exists},
+		"expire":       {2, (*Server).expireKey},
+		"ttl":          {1, (*Server).ttl},
+		"multi_set":    {2, (*Server).multiSet},
+		"multi_get":    {1, (*Server).multiGet},
+		"multi_del":    {1, (*Server).multiDel},
+		"scan":         {3, (*Server).scan},
+		"rscan":        {3, (*Server).rscan},
+		"keys":         {3, (*Server).keys},
+		"rkeys":        {3, (*Server).rkeys},
+		"flushdb":      {0, (*Server).flushdb},
+		"dbsize":       {0, (*Server).dbsize},
+		"multi_exists": {1, (*Server).multiExists},
+
+		// Key-Map
+		"hset":       {3, (*Server).hset},
+		"hget":       {2, (*Server).hget},
+		"hdel":       {2, (*Server).hdel},
+		"hincr":      {2, (*Server).hincr},
+		"hdecr":      {2, (*Server).hdecr},
+		"hexists":    {2, (*Server).hexists},
+		"hsize":      {1, (*Server).hsize},
+		"hlist":      {3, (*Server).hlist},
+		"hrlist":     {3, (*Server).hrlist},
+		"hkeys":      {4, (*Server).hkeys},
+		"hgetall":    {1, (*Server).hgetall},
+		"hscan":      {4, (*Server).hscan},
+		"hrscan":     {4, (*Server).hrscan},
+		"hclear":     {1, (*Server).hclear},
+		"multi_hset": {3, (*Server).multiHSet},
+		"multi_hget": {2, (*Server).multiHGet},
+		"multi_hdel": {2, (*Server).multiHDel},
+
+		// Key-Zset
+		"zset":       {3, (*Server).zset},
+		"zget":       {2, (*Server).zget},
+		"zdel":       {2, (*Server).zdel},
+		"zincr":      {2, (*Server).zincr},
+		"zdecr":      {2, (*Server).zdecr},
+		"zexists":    {2, (*Server).zexists},
+		"zsize":      {1, (*Server).zsize},
+		"zlist":      {3, (*Server).zlist},
+		"zrlist":     {3, (*Server).zrlist},
+		"zkeys":      {5, (*Server).zkeys},
+		"zscan":      {5, (*Server).zscan},
+		"zrscan":     {5, (*Server).zrscan},
+		"zrank":      {2, (*Server).zrank},
+		"zrrank":     {2, (*Server).zrrank},
+		"zrange":     {3, (*Server).zrange},
+		"zrrange":    {3, (*Server).zrrange},
+		"zclear":     {1, (*Server).zclear},
+		"multi_zset": {3, (*Server).multiZSet},
+		"multi_zget": {2, (*Server).multiZGet},
+		"multi_zdel": {2, (*Server).multiZDel},
+
+		// Key-List/Queue
+		"qsize":       {1, (*Server).qsize},
+		"qclear":      {1, (*Server).qclear},
+		"qfront":      {1, (*Server).qfront},
+		"qback":       {1, (*Server).qback},
+		"qget":        {2, (*Server).qget},
+		"qslice":      {3, (*Server).qslice},
+		"qrange":      {3, (*Server).qrange},
+		"qlist":       {3, (*Server).qlist},
+		"qrlist":      {3, (*Server).qrlist},
+		"qpush":       {2, (*Server).qpushBack},
+		"qpush_back":  {2, (*Server).qpushBack},
+		"qpush_front": {2, (*Server).qpushFront},
+		"qpop":        {1, (*Server).qpopFront},
+		"qpop_front":  {1, (*Server).qpopFront},
+		"qpop_back":   {1, (*Server).qpopBack},
+	}
+}
+
+// Run a command, the caller holds the server lock
+func (s *Server) exec(req []string) []string {
+	cmd, found := commands[req[0]]
+	if !found {
+		return clientError("Unknown Command: " + req[0])
+	}
+	if len(req)-1 < cmd.args {
+		return clientError("wrong number of arguments")
+	}
+	return cmd.fn(s, req[1:])
+}
+
+func ok(vals ...string) []string {
+	return append([]string{"ok"}, vals...)
+}
+
+func notFound() []string {
+	return []string{"not_found"}
+}
+
+func clientError(msg string) []string {
+	return []string{"client_error", msg}
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+func boolStr(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// Parse an optional limit argument, negative or missing means no limit
+func limitArg(args []string, i int) int {
+	if len(args) <= i {
+		return -1
+	}
+	n, err := strconv.Atoi(args[i])
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// Keys in (start, end], an empty bound is open
+func inRange(k, start, end string) bool {
+	return (start == "" || k > start) && (end == "" || k <= end)
+}
+
+// Keys in [end, start) for reverse scans, an empty bound is open
+func inRRange(k, start, end string) bool {
+	return (start == "" || k < start) && (end == "" || k >= end)
+}
+
+// Select the names in range from a sorted list
+func rangeNames(names []string, start, end string, limit int, reverse bool) []string {
+	sort.Strings(names)
+	if reverse {
+		sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	}
+	var res []string
+	for _, n := range names {
+		if limit >= 0 && len(res) >= limit {
+			break
+		}
+		if (!reverse && inRange(n, start, end)) || (reverse && inRRange(n, start, end)) {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+// Key-Value
+
+func (s *Server) getKV(k string) (string, bool) {
+	if t, ok := s.expire[k]; ok && !s.now().Before(t) {
+		delete(s.kv, k)
+		delete(s.expire, k)
+	}
+	v, ok := s.kv[k]
+	return v, ok
+}
+
+func (s *Server) setKV(k, v string) {
+	s.kv[k] = v
+	delete(s.expire, k)
+}
+
+func (s *Server) delKV(k string) bool {
+	_, ok := s.getKV(k)
+	delete(s.kv, k)
+	delete(s.expire, k)
+	return ok
+}
+
+func (s *Server) set(args []string) []string {
+	s.setKV(args[0], args[1])
+	return ok("1")
+}
+
+func (s *Server) setx(args []string) []string {
+	ttl, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return clientError("invalid ttl")
+	}
+	s.setKV(args[0], args[1])
+	s.expire[args[0]] = s.now().Add(time.Duration(ttl) * time.Second)
+	return ok("1")
+}
+
+func (s *Server) setnx(args []string) []string {
+	if _, found := s.getKV(args[0]); found {
+		return ok("0")
+	}
+	s.setKV(args[0], args[1])
+	return ok("1")
+}
+
+func (s *Server) get(args []string) []string {
+	v, found := s.getKV(args[0])
+	if !found {
+		return notFound()
+	}
+	return ok(v)
+}
+
+func (s *Server) getset(args []string) []string {
+	v, found := s.getKV(args[0])
+	s.setKV(args[0], args[1])
+	if !found {
+		return notFound()
+	}
+	return ok(v)
+}
+
+func (s *Server) del(args []string) []string {
+	s.delKV(args[0])
+	return ok("1")
+}
+
+func (s *Server) incrBy(k, by string, sign int64) []string {
+	n := int64(1)
+	if by != "" {
+		var err error
+		if n, err = strconv.ParseInt(by, 10, 64); err != nil {
+			return clientError("invalid increment")
+		}
+	}
+	cur := int64(0)
+	if v, found := s.getKV(k); found {
+		var err error
+		if cur, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return []string{"error", "value is not an integer or out of range"}
+		}
+	}
+	cur += sign * n
+	s.kv[k] = itoa(cur)
+	return ok(itoa(cur))
+}
+
+func (s *Server) incr(args []string) []string {
+	return s.incrBy(args[0], optional(args, 1), 1)
+}
+
+func (s *Server) decr(args []string) []string {
+	return s.incrBy(args[0], optional(args, 1), -1)
+}
+
+func optional(args []string, i int) string {
+	if len(args) > i {
+		return args[i]
+	}
+	return ""
+}
+
+func (s *Server) exists(args []string) []string {
+	_, found := s.getKV(args[0])
+	return ok(boolStr(found))
+}
+
+func (s *Server) multiExists(args []string) []string {
+	res := ok()
+	for _, k := range args {
+		_, found := s.getKV(k)
+		res = append(res, k, boolStr(found))
+	}
+	return res
+}
+
+func (s *Server) expireKey(args []string) []string {
+	ttl, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return clientError("invalid ttl")
+	}
+	if _, found := s.getKV(args[0]); !found {
+		return ok("0")
+	}
+	s.expire[args[0]] = s.now().Add(time.Duration(ttl) * time.Second)
+	return ok("1")
+}
+
+func (s *Server) ttl(args []string) []string {
+	if _, found := s.getKV(args[0]); !found {
+		return ok("-1")
+	}
+	t, found := s.expire[args[0]]
+	if !found {
+		return ok("-1")
+	}
+	return ok(itoa(int64(t.Sub(s.now()).Seconds() + 0.5)))
+}
+
+func (s *Server) multiSet(args []string) []string {
+	if len(args)%2 != 0 {
+		return clientError("wrong number of arguments")
+	}
+	for i := 0; i < len(args); i += 2 {
+		s.setKV(args[i], args[i+1])
+	}
+	return ok(itoa(int64(len(args) / 2)))
+}
+
+func (s *Server) multiGet(args []string) []string {
+	res := ok()
+	for _, k := range args {
+		if v, found := s.getKV(k); found {
+			res = append(res, k, v)
+		}
+	}
+	return res
+}
+
+func (s *Server) multiDel(args []string) []string {
+	for _, k := range args {
+		s.delKV(k)
+	}
+	return ok(itoa(int64(len(args))))
+}
+
+func (s *Server) liveKeys() []string {
+	keys := make([]string, 0, len(s.kv))
+	for k := range s.kv {
+		if _, found := s.getKV(k); found {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func (s *Server) scan(args []string) []string {
+	res := ok()
+	for _, k := range rangeNames(s.liveKeys(), args[0], args[1], limitArg(args, 2), false) {
+		res = append(res, k, s.kv[k])
+	}
+	return res
+}
+
+func (s *Server) rscan(args []string) []string {
+	res := ok()
+	for _, k := range rangeNames(s.liveKeys(), args[0], args[1], limitArg(args, 2), true) {
+		res = append(res, k, s.kv[k])
+	}
+	return res
+}
+
+func (s *Server) keys(args []string) []string {
+	return ok(rangeNames(s.liveKeys(), args[0], args[1], limitArg(args, 2), false)...)
+}
+
+func (s *Server) rkeys(args []string) []string {
+	return ok(rangeNames(s.liveKeys(), args[0], args[1], limitArg(args, 2), true)...)
+}
+
+func (s *Server) flushdb(args []string) []string {
+	s.kv = make(map[string]string)
+	s.expire = make(map[string]time.Time)
+	s.hashes = make(map[string]map[string]string)
+	s.zsets = make(map[string]map[string]int64)
+	s.queues = make(map[string][]string)
+	return ok()
+}
+
+func (s *Server) dbsize(args []string) []string {
+	n := len(s.liveKeys()) + len(s.hashes) + len(s.zsets) + len(s.queues)
+	return ok(itoa(int64(n)))
+}
+
+// Key-Map
+
+func (s *Server) hash(name string, create bool) map[string]string {
+	h := s.hashes[name]
+	if h == nil && create {
+		h = make(map[string]string)
+		s.hashes[name] = h
+	}
+	return h
+}
+
+func (s *Server) cleanHash(name string) {
+	if len(s.hashes[name]) == 0 {
+		delete(s.hashes, name)
+	}
+}
+
+func (s *Server) hset(args []string) []string {
+	h := s.hash(args[0], true)
+	_, found := h[args[1]]
+	h[args[1]] = args[2]
+	return ok(boolStr(!found))
+}
+
+func (s *Server) hget(args []string) []string {
+	v, found := s.hash(args[0], false)[args[1]]
+	if !found {
+		return notFound()
+	}
+	return ok(v)
+}
+
+func (s *Server) hdel(args []string) []string {
+	h := s.hash(args[0], false)
+	_, found := h[args[1]]
+	delete(h, args[1])
+	s.cleanHash(args[0])
+	return ok(boolStr(found))
+}
+
+func (s *Server) hincrBy(args []string, sign int64) []string {
+	n := int64(1)
+	if len(args) > 2 {
+		var err error
+		if n, err = strconv.ParseInt(args[2], 10, 64); err != nil {
+			return clientError("invalid increment")
+		}
+	}
+	h := s.hash(args[0], true)
+	cur := int64(0)
+	if v, found := h[args[1]]; found {
+		var err error
+		if cur, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return []string{"error", "value is not an integer or out of range"}
+		}
+	}
+	cur += sign * n
+	h[args[1]] = itoa(cur)
+	return ok(itoa(cur))
+}
+
+func (s *Server) hincr(args []string) []string {
+	return s.hincrBy(args, 1)
+}
+
+func (s *Server) hdecr(args []string) []string {
+	return s.hincrBy(args, -1)
+}
+
+func (s *Server) hexists(args []string) []string {
+	_, found := s.hash(args[0], false)[args[1]]
+	return ok(boolStr(found))
+}
+
+func (s *Server) hsize(args []string) []string {
+	return ok(itoa(int64(len(s.hash(args[0], false)))))
+}
+
+func (s *Server) hashNames() []string {
+	names := make([]string, 0, len(s.hashes))
+	for n := range s.hashes {
+		names = append(names, n)
+	}
+	return names
+}
+
+func (s *Server) hlist(args []string) []string {
+	return ok(rangeNames(s.hashNames(), args[0], args[1], limitArg(args, 2), false)...)
+}
+
+func (s *Server) hrlist(args []string) []string {
+	return ok(rangeNames(s.hashNames(), args[0], args[1], limitArg(args, 2), true)...)
+}
+
+func (s *Server) hashFields(name string) []string {
+	h := s.hash(name, false)
+	fields := make([]string, 0, len(h))
+	for f := range h {
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func (s *Server) hkeys(args []string) []string {
+	return ok(rangeNames(s.hashFields(args[0]), args[1], args[2], limitArg(args, 3), false)...)
+}
+
+func (s *Server) hgetall(args []string) []string {
+	h := s.hash(args[0], false)
+	res := ok()
+	for _, f := range rangeNames(s.hashFields(args[0]), "", "", -1, false) {
+		res = append(res, f, h[f])
+	}
+	return res
+}
+
+func (s *Server) hscan(args []string) []string {
+	h := s.hash(args[0], false)
+	res := ok()
+	for _, f := range rangeNames(s.hashFields(args[0]), args[1], args[2], limitArg(args, 3), false) {
+		res = append(res, f, h[f])
+	}
+	return res
+}
+
+func (s *Server) hrscan(args []string) []string {
+	h := s.hash(args[0], false)
+	res := ok()
+	for _, f := range rangeNames(s.hashFields(args[0]), args[1], args[2], limitArg(args, 3), true) {
+		res = append(res, f, h[f])
+	}
+	return res
+}
+
+func (s *Server) hclear(args []string) []string {
+	n := len(s.hashes[args[0]])
+	delete(s.hashes, args[0])
+	return ok(itoa(int64(n)))
+}
+
+func (s *Server) multiHSet(args []string) []string {
+	if len(args)%2 != 1 {
+		return clientError("wrong number of arguments")
+	}
+	h := s.hash(args[0], true)
+	for i := 1; i < len(args); i += 2 {
+		h[args[i]] = args[i+1]
+	}
+	return ok(itoa(int64(len(args) / 2)))
+}
+
+func (s *Server) multiHGet(args []string) []string {
+	h := s.hash(args[0], false)
+	res := ok()
+	for _, f := range args[1:] {
+		if v, found := h[f]; found {
+			res = append(res, f, v)
+		}
+	}
+	return res
+}
+
+func (s *Server) multiHDel(args []string) []string {
+	h := s.hash(args[0], false)
+	n := 0
+	for _, f := range args[1:] {
+		if _, found := h[f]; found {
+			delete(h, f)
+			n++
+		}
+	}
+	s.cleanHash(args[0])
+	return ok(itoa(int64(n)))
+}
+
+// Key-Zset
+
+type zentry struct {
+	key   string
+	score int64
+}
+
+func (s *Server) zsetOf(name string, create bool) map[string]int64 {
+	z := s.zsets[name]
+	if z == nil && create {
+		z = make(map[string]int64)
+		s.zsets[name] = z
+	}
+	return z
+}
+
+func (s *Server) cleanZSet(name string) {
+	if len(s.zsets[name]) == 0 {
+		delete(s.zsets, name)
+	}
+}
+
+// Entries ordered by score then key
+func (s *Server) zsorted(name string, reverse bool) []zentry {
+	z := s.zsetOf(name, false)
+	res := make([]zentry, 0, len(z))
+	for k, v := range z {
+		res = append(res, zentry{k, v})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		less := res[i].score < res[j].score || (res[i].score == res[j].score && res[i].key < res[j].key)
+		if reverse {
+			return !less
+		}
+		return less
+	})
+	return res
+}
+
+func (s *Server) zset(args []string) []string {
+	score, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return clientError("invalid score")
+	}
+	z := s.zsetOf(args[0], true)
+	_, found := z[args[1]]
+	z[args[1]] = score
+	return ok(boolStr(!found))
+}
+
+func (s *Server) zget(args []string) []string {
+	v, found := s.zsetOf(args[0], false)[args[1]]
+	if !found {
+		return notFound()
+	}
+	return ok(itoa(v))
+}
+
+func (s *Server) zdel(args []string) []string {
+	z := s.zsetOf(args[0], false)
+	_, found := z[args[1]]
+	delete(z, args[1])
+	s.cleanZSet(args[0])
+	return ok(boolStr(found))
+}
+
+func (s *Server) zincrBy(args []string, sign int64) []string {
+	n := int64(1)
+	if len(args) > 2 {
+		var err error
+		if n, err = strconv.ParseInt(args[2], 10, 64); err != nil {
+			return clientError("invalid increment")
+		}
+	}
+	z := s.zsetOf(args[0], true)
+	z[args[1]] += sign * n
+	return ok(itoa(z[args[1]]))
+}
+
+func (s *Server) zincr(args []string) []string {
+	return s.zincrBy(args, 1)
+}
+
+func (s *Server) zdecr(args []string) []string {
+	return s.zincrBy(args, -1)
+}
+
+func (s *Server) zexists(args []string) []string {
+	_, found := s.zsetOf(args[0], false)[args[1]]
+	return ok(boolStr(found))
+}
+
+func (s *Server) zsize(args []string) []string {
+	return ok(itoa(int64(len(s.zsetOf(args[0], false)))))
+}
+
+func (s *Server) zsetNames() []string {
+	names := make([]string, 0, len(s.zsets))
+	for n := range s.zsets {
+		names = append(names, n)
+	}
+	return names
+}
+
+func (s *Server) zlist(args []string) []string {
+	return ok(rangeNames(s.zsetNames(), args[0], args[1], limitArg(args, 2), false)...)
+}
+
+func (s *Server) zrlist(args []string) []string {
+	return ok(rangeNames(s.zsetNames(), args[0], args[1], limitArg(args, 2), true)...)
+}
+
+// Entries of a score range starting after key_start, like zscan does
+func (s *Server) zscanEntries(args []string, reverse bool) ([]zentry, bool) {
+	name, keyStart := args[0], args[1]
+	var (
+		start, end       int64
+		hasStart, hasEnd bool
+		err              error
+	)
+	if args[2] != "" {
+		if start, err = strconv.ParseInt(args[2], 10, 64); err != nil {
+			return nil, false
+		}
+		hasStart = true
+	}
+	if args[3] != "" {
+		if end, err = strconv.ParseInt(args[3], 10, 64); err != nil {
+			return nil, false
+		}
+		hasEnd = true
+	}
+	limit := limitArg(args, 4)
+	var res []zentry
+	for _, e := range s.zsorted(name, reverse) {
+		if limit >= 0 && len(res) >= limit {
+			break
+		}
+		if !reverse {
+			if hasStart && (e.score < start || (keyStart != "" && e.score == start && e.key <= keyStart)) {
+				continue
+			}
+			if hasEnd && e.score > end {
+				break
+			}
+		} else {
+			if hasStart && (e.score > start || (keyStart != "" && e.score == start && e.key >= keyStart)) {
+				continue
+			}
+			if hasEnd && e.score < end {
+				break
+			}
+		}
+		res = append(res, e)
+	}
+	return res, true
+}
+
+func (s *Server) zkeys(args []string) []string {
+	entries, valid := s.zscanEntries(args, false)
+	if !valid {
+		return clientError("invalid score")
+	}
+	res := ok()
+	for _, e := range entries {
+		res = append(res, e.key)
+	}
+	return res
+}
+
+func (s *Server) zscan(args []string) []string {
+	return s.zscanReply(args, false)
+}
+
+func (s *Server) zrscan(args []string) []string {
+	return s.zscanReply(args, true)
+}
+
+func (s *Server) zscanReply(args []string, reverse bool) []string {
+	entries, valid := s.zscanEntries(args, reverse)
+	if !valid {
+		return clientError("invalid score")
+	}
+	res := ok()
+	for _, e := range entries {
+		res = append(res, e.key, itoa(e.score))
+	}
+	return res
+}
+
+func (s *Server) zrankOf(args []string, reverse bool) []string {
+	for i, e := range s.zsorted(args[0], reverse) {
+		if e.key == args[1] {
+			return ok(itoa(int64(i)))
+		}
+	}
+	return notFound()
+}
+
+func (s *Server) zrank(args []string) []string {
+	return s.zrankOf(args, false)
+}
+
+func (s *Server) zrrank(args []string) []string {
+	return s.zrankOf(args, true)
+}
+
+func (s *Server) zrangeOf(args []string, reverse bool) []string {
+	offset, err := strconv.Atoi(args[1])
+	if err != nil || offset < 0 {
+		return clientError("invalid offset")
+	}
+	limit := limitArg(args, 2)
+	entries := s.zsorted(args[0], reverse)
+	res := ok()
+	for i := offset; i < len(entries) && (limit < 0 || i < offset+limit); i++ {
+		res = append(res, entries[i].key, itoa(entries[i].score))
+	}
+	return res
+}
+
+func (s *Server) zrange(args []string) []string {
+	return s.zrangeOf(args, false)
+}
+
+func (s *Server) zrrange(args []string) []string {
+	return s.zrangeOf(args, true)
+}
+
+func (s *Server) zclear(args []string) []string {
+	n := len(s.zsets[args[0]])
+	delete(s.zsets, args[0])
+	return ok(itoa(int64(n)))
+}
+
+func (s *Server) multiZSet(args []string) []string {
+	if len(args)%2 != 1 {
+		return clientError("wrong number of arguments")
+	}
+	z := s.zsetOf(args[0], true)
+	for i := 1; i < len(args); i += 2 {
+		score, err := strconv.ParseInt(args[i+1], 10, 64)
+		if err != nil {
+			return clientError("invalid score")
+		}
+		z[args[i]] = score
+	}
+	return ok(itoa(int64(len(args) / 2)))
+}
+
+func (s *Server) multiZGet(args []string) []string {
+	z := s.zsetOf(args[0], false)
+	res := ok()
+	for _, k := range args[1:] {
+		if v, found := z[k]; found {
+			res = append(res, k, itoa(v))
+		}
+	}
+	return res
+}
+
+func (s *Server) multiZDel(args []string) []string {
+	z := s.zsetOf(args[0], false)
+	n := 0
+	for _, k := range args[1:] {
+		if _, found := z[k]; found {
+			delete(z, k)
+			n++
+		}
+	}
+	s.cleanZSet(args[0])
+	return ok(itoa(int64(n)))
+}
+
+// Key-List/Queue
+
+// Resolve a possibly negative queue index
+func qindex(i, size int) int {
+	if i < 0 {
+		i += size
+	}
+	return i
+}
+
+func (s *Server) qsize(args []string) []string {
+	return ok(itoa(int64(len(s.queues[args[0]]))))
+}
+
+func (s *Server) qclear(args []string) []string {
+	n := len(s.queues[args[0]])
+	delete(s.queues, args[0])
+	return ok(itoa(int64(n)))
+}
+
+func (s *Server) qfront(args []string) []string {
+	q := s.queues[args[0]]
+	if len(q) == 0 {
+		return notFound()
+	}
+	return ok(q[0])
+}
+
+func (s *Server) qback(args []string) []string {
+	q := s.queues[args[0]]
+	if len(q) == 0 {
+		return notFound()
+	}
+	return ok(q[len(q)-1])
+}
+
+func (s *Server) qget(args []string) []string {
+	q := s.queues[args[0]]
+	i, err := strconv.Atoi(args[1])
+	if err != nil {
+		return clientError("invalid index")
+	}
+	i = qindex(i, len(q))
+	if i < 0 || i >= len(q) {
+		return notFound()
+	}
+	return ok(q[i])
+}
+
+func (s *Server) qslice(args []string) []string {
+	q := s.queues[args[0]]
+	begin, err1 := strconv.Atoi(args[1])
+	end, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return clientError("invalid index")
+	}
+	begin, end = qindex(begin, len(q)), qindex(end, len(q))
+	if begin < 0 {
+		begin = 0
+	}
+	if end >= len(q) {
+		end = len(q) - 1
+	}
+	res := ok()
+	for i := begin; i <= end; i++ {
+		res = append(res, q[i])
+	}
+	return res
+}
+
+func (s *Server) qrange(args []string) []string {
+	q := s.queues[args[0]]
+	offset, err1 := strconv.Atoi(args[1])
+	limit, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return clientError("invalid index")
+	}
+	offset = qindex(offset, len(q))
+	if offset < 0 {
+		offset = 0
+	}
+	res := ok()
+	for i := offset; i < len(q) && (limit < 0 || i < offset+limit); i++ {
+		res = append(res, q[i])
+	}
+	return res
+}
+
+func (s *Server) queueNames() []string {
+	names := make([]string, 0, len(s.queues))
+	for n := range s.queues {
+		names = append(names, n)
+	}
+	return names
+}
+
+func (s *Server) qlist(args []string) []string {
+	return ok(rangeNames(s.queueNames(), args[0], args[1], limitArg(args, 2), false)...)
+}
+
+func (s *Server) qrlist(args []string) []string {
+	return ok(rangeNames(s.queueNames(), args[0], args[1], limitArg(args, 2), true)...)
+}
+
+func (s *Server) qpushBack(args []string) []string {
+	s.queues[args[0]] = append(s.queues[args[0]], args[1:]...)
+	return ok(itoa(int64(len(s.queues[args[0]]))))
+}
+
+func (s *Server) qpushFront(args []string) []string {
+	q := s.queues[args[0]]
+	for _, item := range args[1:] {
+		q = append([]string{item}, q...)
+	}
+	s.queues[args[0]] = q
+	return ok(itoa(int64(len(q))))
+}
+
+// Number of items to pop, the optional size argument defaults to 1
+func popSize(args []string) int {
+	if len(args) < 2 {
+		return 1
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+func (s *Server) qpopFront(args []string) []string {
+	q := s.queues[args[0]]
+	if len(q) == 0 {
+		return notFound()
+	}
+	n := popSize(args)
+	if n > len(q) {
+		n = len(q)
+	}
+	res := ok(q[:n]...)
+	s.queues[args[0]] = q[n:]
+	if len(q) == n {
+		delete(s.queues, args[0])
+	}
+	return res
+}
+
+func (s *Server) qpopBack(args []string) []string {
+	q := s.queues[args[0]]
+	if len(q) == 0 {
+		return notFound()
+	}
+	n := popSize(args)
+	if n > len(q) {
+		n = len(q)
+	}
+	res := ok()
+	for i := 0; i < n; i++ {
+		res = append(res, q[len(q)-1-i])
+	}
+	s.queues[args[0]] = q[:len(q)-n]
+	if len(q) == n {
+		delete(s.queues, args[0])
+	}
+	return res
+}
@@ -0,0 +1,108 @@
+package ssdbtest
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/bububa/gossdb/protocol"
+)
+
+type FaultKind int
+
+const (
+	// FaultDrop closes the connection instead of replying
+	FaultDrop FaultKind = iota + 1
+	// FaultDropMidReply writes the first half of the reply then closes the
+	// connection
+	FaultDropMidReply
+	// FaultPartialWrite writes the reply in chunks of Bytes bytes, pausing
+	// Delay between them
+	FaultPartialWrite
+	// FaultSlowReply waits Delay before replying
+	FaultSlowReply
+	// FaultMalformedHeader replies with a length header that is not a number
+	FaultMalformedHeader
+	// FaultOversizedReply replies ok followed by a value of Bytes bytes
+	FaultOversizedReply
+)
+
+// Fault alters the way the server writes a reply, the command itself is
+// executed normally
+type Fault struct {
+	Kind  FaultKind
+	Delay time.Duration
+	Bytes int
+}
+
+// InjectFault applies f to the next n replies, whatever the connection.
+// Faults queue up and are consumed in order.
+func (s *Server) InjectFault(f Fault, n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := 0; i < n; i++ {
+		s.faults = append(s.faults, f)
+	}
+}
+
+// ClearFaults discards the faults not consumed yet
+func (s *Server) ClearFaults() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.faults = nil
+}
+
+// Pop the next fault, the caller holds the server lock
+func (s *Server) nextFault() *Fault {
+	if len(s.faults) == 0 {
+		return nil
+	}
+	f := s.faults[0]
+	s.faults = s.faults[1:]
+	return &f
+}
+
+// Write resp according to the fault, it returns false when the connection
+// was closed
+func writeFault(conn net.Conn, w *protocol.Writer, f *Fault, resp []string) bool {
+	raw := protocol.Append(nil, resp...)
+
+	switch f.Kind {
+	case FaultDrop:
+		conn.Close()
+		return false
+	case FaultDropMidReply:
+		w.Write(raw[:len(raw)/2])
+		w.Flush()
+		conn.Close()
+		return false
+	case FaultPartialWrite:
+		size := f.Bytes
+		if size <= 0 {
+			size = 1
+		}
+		for len(raw) > 0 {
+			n := size
+			if n > len(raw) {
+				n = len(raw)
+			}
+			w.Write(raw[:n])
+			if err := w.Flush(); err != nil {
+				return false
+			}
+			raw = raw[n:]
+			time.Sleep(f.Delay)
+		}
+		return true
+	case FaultSlowReply:
+		time.Sleep(f.Delay)
+		w.Write(raw)
+	case FaultMalformedHeader:
+		w.Write([]byte("2x\nok\n\n"))
+	case FaultOversizedReply:
+		w.WriteBlock("ok", strings.Repeat("x", f.Bytes))
+	default:
+		w.Write(raw)
+	}
+	return w.Flush() == nil
+}
@@ -0,0 +1,126 @@
+// Package ssdbtest provides an in-memory SSDB server for tests.
+//
+//	srv := ssdbtest.NewServer()
+//	defer srv.Close()
+//	c, err := gossdb.Connect(srv.Addr())
+package ssdbtest
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bububa/gossdb/protocol"
+	"github.com/bububa/gossdb/server"
+)
+
+// Server speaks the SSDB protocol on a local port and keeps its data in
+// memory
+type Server struct {
+	srv      *server.Server
+	listener net.Listener
+
+	mutex  sync.Mutex
+	kv     map[string]string
+	expire map[string]time.Time
+	hashes map[string]map[string]string
+	zsets  map[string]map[string]int64
+	queues map[string][]string
+	offset time.Duration
+	faults []Fault
+
+	wg sync.WaitGroup
+}
+
+// The connection was closed by a fault
+var errFault = errors.New("ssdbtest: connection closed by a fault")
+
+// NewServer starts a server on a random local port, it panics when no port
+// can be opened like httptest.NewServer does
+func NewServer() *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("ssdbtest: failed to listen: " + err.Error())
+	}
+	s := &Server{srv: server.NewServer(), listener: l}
+	s.FlushAll()
+	s.srv.HandleDefault(s.handle)
+	s.srv.SetReplyFunc(s.reply)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.srv.Serve(l)
+	}()
+	return s
+}
+
+// Addr returns the address to give to gossdb.Connect
+func (s *Server) Addr() *net.TCPAddr {
+	return s.listener.Addr().(*net.TCPAddr)
+}
+
+// String returns the host:port of the server
+func (s *Server) String() string {
+	return s.listener.Addr().String()
+}
+
+// SetPassword requires clients to send the auth command first
+func (s *Server) SetPassword(password string) {
+	s.srv.SetPassword(password)
+}
+
+// FlushAll removes every key
+func (s *Server) FlushAll() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.kv = make(map[string]string)
+	s.expire = make(map[string]time.Time)
+	s.hashes = make(map[string]map[string]string)
+	s.zsets = make(map[string]map[string]int64)
+	s.queues = make(map[string][]string)
+}
+
+// FastForward moves the clock of the server forward to expire keys without
+// sleeping
+func (s *Server) FastForward(d time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.offset += d
+}
+
+// CloseClientConnections drops every open client connection
+func (s *Server) CloseClientConnections() {
+	s.srv.CloseConnections()
+}
+
+// Close stops the server and drops the client connections
+func (s *Server) Close() error {
+	err := s.srv.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) now() time.Time {
+	return time.Now().Add(s.offset)
+}
+
+func (s *Server) handle(req *server.Request) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.exec(append([]string{req.Cmd}, req.Args...))
+}
+
+// Write a reply, altered by the next fault
+func (s *Server) reply(conn net.Conn, w *protocol.Writer, resp []string) error {
+	s.mutex.Lock()
+	fault := s.nextFault()
+	s.mutex.Unlock()
+	if fault == nil {
+		return w.WriteBlock(resp...)
+	}
+	if !writeFault(conn, w, fault, resp) {
+		return errFault
+	}
+	return nil
+}
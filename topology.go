@@ -0,0 +1,97 @@
+package gossdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// MaxTotalWeight bounds the sum of the shard weights, keys are hashed to 16
+// bits and each unit of weight owns one value
+const MaxTotalWeight = 1 << 16
+
+// ShardConfig describes one shard of a cluster
+type ShardConfig struct {
+	// Name identifies the shard in logs and errors, defaults to Master
+	Name string `json:"name"`
+	// Weight is the share of the key space owned by the shard, defaults to 1
+	Weight int `json:"weight"`
+	// Master is the host:port receiving writes, IPv6 hosts go in brackets
+	Master string `json:"master"`
+	// Replicas are optional host:port serving reads
+	Replicas []string `json:"replicas"`
+	// Auth is the password sent with the auth command on connect
+	Auth string `json:"auth"`
+}
+
+// Topology describes the shards of a cluster
+type Topology struct {
+	Shards []ShardConfig `json:"shards"`
+}
+
+// NewTopology builds a topology of equally weighted shards from host:port
+func NewTopology(shardsAddr []string) *Topology {
+	t := &Topology{}
+	for _, addr := range shardsAddr {
+		t.Shards = append(t.Shards, ShardConfig{Master: addr})
+	}
+	return t
+}
+
+// LoadTopology decodes a JSON topology
+func LoadTopology(r io.Reader) (*Topology, error) {
+	t := &Topology{}
+	if err := json.NewDecoder(r).Decode(t); err != nil {
+		return nil, err
+	}
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// LoadTopologyFile decodes the JSON topology stored in a file
+func LoadTopologyFile(path string) (*Topology, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadTopology(f)
+}
+
+// Validate checks the topology can be turned into a cluster
+func (t *Topology) Validate() error {
+	if len(t.Shards) == 0 {
+		return fmt.Errorf("topology: no shards")
+	}
+	total := 0
+	names := make(map[string]bool)
+	for i, s := range t.Shards {
+		if s.Master == "" {
+			return fmt.Errorf("topology: shard %d has no master", i)
+		}
+		// a shard without a name is named after its master
+		name := s.Name
+		if name == "" {
+			name = s.Master
+		}
+		if names[name] {
+			return fmt.Errorf("topology: shard %d has the duplicate name %q", i, name)
+		}
+		names[name] = true
+		if s.Weight < 0 {
+			return fmt.Errorf("topology: shard %d has negative weight", i)
+		}
+		if s.Weight == 0 {
+			total++
+		} else {
+			total += s.Weight
+		}
+		if total > MaxTotalWeight {
+			return fmt.Errorf("topology: total weight above %d", MaxTotalWeight)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package gossdb
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/bububa/gossdb/ssdbtest"
+)
+
+func TestValidateTotalWeight(t *testing.T) {
+	tests := []struct {
+		weights []int
+		ok      bool
+	}{
+		{[]int{MaxTotalWeight}, true},
+		{[]int{MaxTotalWeight - 1, 0}, true},
+		{[]int{MaxTotalWeight + 1}, false},
+		{[]int{MaxTotalWeight, 0}, false},
+		{[]int{MaxTotalWeight / 2, MaxTotalWeight/2 + 1}, false},
+	}
+	for _, tt := range tests {
+		topo := &Topology{}
+		for i, w := range tt.weights {
+			topo.Shards = append(topo.Shards, ShardConfig{Master: fmt.Sprintf("127.0.0.1:%d", 8888+i), Weight: w})
+		}
+		if err := topo.Validate(); (err == nil) != tt.ok {
+			t.Errorf("Validate(%v) = %v, want ok %v", tt.weights, err, tt.ok)
+		}
+	}
+}
+
+func TestValidateDuplicateNames(t *testing.T) {
+	tests := []struct {
+		shards []ShardConfig
+		ok     bool
+	}{
+		{[]ShardConfig{{Name: "a", Master: "127.0.0.1:8888"}, {Name: "b", Master: "127.0.0.1:8889"}}, true},
+		{[]ShardConfig{{Name: "a", Master: "127.0.0.1:8888"}, {Name: "a", Master: "127.0.0.1:8889"}}, false},
+		{[]ShardConfig{{Master: "127.0.0.1:8888"}, {Master: "127.0.0.1:8888"}}, false},
+		{[]ShardConfig{{Master: "127.0.0.1:8888"}, {Name: "127.0.0.1:8888", Master: "127.0.0.1:8889"}}, false},
+	}
+	for _, tt := range tests {
+		topo := &Topology{Shards: tt.shards}
+		if err := topo.Validate(); (err == nil) != tt.ok {
+			t.Errorf("Validate(%+v) = %v, want ok %v", tt.shards, err, tt.ok)
+		}
+	}
+}
+
+// Start a server per weight and count the keys hashed to each shard
+func ringShares(t *testing.T, weights ...int) []int {
+	t.Helper()
+	topo := &Topology{}
+	for _, w := range weights {
+		srv := ssdbtest.NewServer()
+		t.Cleanup(func() { srv.Close() })
+		topo.Shards = append(topo.Shards, ShardConfig{Master: srv.String(), Weight: w})
+	}
+	c, err := NewClusterFromTopology(topo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	counts := make([]int, len(weights))
+	r := c.topology()
+	for i := 0; i < 100000; i++ {
+		counts[r.locate([]byte(fmt.Sprintf("key:%d", i)))]++
+	}
+	return counts
+}
+
+func expectShares(t *testing.T, counts []int, weights ...int) {
+	t.Helper()
+	total, keys := 0, 0
+	for i, w := range weights {
+		if w == 0 {
+			weights[i] = 1
+		}
+		total += weights[i]
+		keys += counts[i]
+	}
+	for i, w := range weights {
+		want := float64(w) / float64(total)
+		got := float64(counts[i]) / float64(keys)
+		if math.Abs(got-want) > 0.01 {
+			t.Errorf("shard %d owns %.3f of the keys, want %.3f", i, got, want)
+		}
+	}
+}
+
+func TestRingWeighted(t *testing.T) {
+	counts := ringShares(t, 1, 2, 5, 0)
+	expectShares(t, counts, 1, 2, 5, 0)
+}
+
+func TestRingLargeWeights(t *testing.T) {
+	counts := ringShares(t, MaxTotalWeight/2, MaxTotalWeight/2)
+	expectShares(t, counts, MaxTotalWeight/2, MaxTotalWeight/2)
+
+	counts = ringShares(t, MaxTotalWeight-1, 1)
+	if counts[0] == 0 {
+		t.Errorf("shard 0 owns no key")
+	}
+}
+
+func TestRingTooLarge(t *testing.T) {
+	topo := &Topology{Shards: []ShardConfig{{Master: "127.0.0.1:8888", Weight: MaxTotalWeight + 1}}}
+	if _, err := NewClusterFromTopology(topo); err == nil {
+		t.Fatal("NewClusterFromTopology succeeded, want an error")
+	}
+}
+
+func TestUpdateTopologyRetiresClients(t *testing.T) {
+	a, b := ssdbtest.NewServer(), ssdbtest.NewServer()
+	defer a.Close()
+	defer b.Close()
+	c, err := NewCluster([]string{a.String(), b.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	old := c.topology().shards[1].master
+	if err := c.UpdateTopology(NewTopology([]string{a.String()})); err != nil {
+		t.Fatal(err)
+	}
+	// a request routed with the previous ring still succeeds
+	if _, err := old.Set("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		old.lock()
+		closed := old.retired && old.sock == nil
+		old.unlock()
+		if closed {
+			break
+		}
+		if i == 100 {
+			t.Fatal("the retired client kept its connection")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(c.topology().shards) != 1 {
+		t.Fatalf("%d shards, want 1", len(c.topology().shards))
+	}
+}
+
+func TestUpdateTopologyResolveError(t *testing.T) {
+	a, b := ssdbtest.NewServer(), ssdbtest.NewServer()
+	defer a.Close()
+	defer b.Close()
+	c, err := NewCluster([]string{a.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.UpdateTopology(NewTopology([]string{b.String(), "127.0.0.1:port"})); err == nil {
+		t.Fatal("UpdateTopology succeeded with an unresolvable address")
+	}
+	// the cluster keeps its previous ring
+	if shards := c.topology().shards; len(shards) != 1 || shards[0].name != a.String() {
+		t.Fatalf("ring changed to %d shards", len(shards))
+	}
+	if _, err := c.Set("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,78 @@
+package gossdb
+
+import (
+	"context"
+)
+
+// Tracer starts spans, it is a small subset of the OpenTelemetry tracer so
+// an adapter is a few lines:
+//
+//	type otelTracer struct{ t trace.Tracer }
+//
+//	func (o otelTracer) Start(ctx context.Context, name string) (context.Context, gossdb.Span) {
+//		ctx, span := o.t.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+//		return ctx, otelSpan{span}
+//	}
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a traced operation
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Attribute is a key value pair attached to a span
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Tracing returns a middleware creating one span per command, child of the
+// span found in the context given to DoContext or WithContext
+func Tracing(t Tracer) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, cmd *Command) ([]string, error) {
+			ctx, span := t.Start(ctx, "ssdb."+cmd.Name())
+			defer span.End()
+			resp, err := next(ctx, cmd)
+			span.SetAttributes(
+				Attribute{Key: "db.system", Value: "ssdb"},
+				Attribute{Key: "db.operation", Value: cmd.Name()},
+				Attribute{Key: "net.peer.name", Value: cmd.Addr},
+				Attribute{Key: "ssdb.keys", Value: keyCount(cmd.Args)},
+				Attribute{Key: "ssdb.retries", Value: cmd.Retries},
+				Attribute{Key: "ssdb.status", Value: replyStatus(resp, err)},
+			)
+			if err != nil {
+				span.RecordError(err)
+			}
+			return resp, err
+		}
+	}
+}
+
+// SetTracer traces every shard command as well as the fan-out of the
+// multi-key commands, it should be called once
+func (c *Cluster) SetTracer(t Tracer) {
+	c.mutex.Lock()
+	c.tracer = t
+	c.mutex.Unlock()
+	c.Use(Tracing(t))
+}
+
+// Number of keys a command works on
+func keyCount(args []interface{}) int {
+	if len(args) < 2 {
+		return 0
+	}
+	switch cmdName(args) {
+	case "multi_get", "multi_del", "multi_exists":
+		return len(args) - 1
+	case "multi_set":
+		return (len(args) - 1) / 2
+	}
+	return 1
+}